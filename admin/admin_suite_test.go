@@ -0,0 +1,13 @@
+package admin_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDiferenciaAdmin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Diferencia Admin Client Suite")
+}
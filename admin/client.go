@@ -0,0 +1,253 @@
+// Package admin is a client of Diferencia admin API
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lordofthejars/diferencia/core"
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/snapshot"
+	"github.com/lordofthejars/diferencia/verdict"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// validationPrefix starts the message of configurations rejected by core.ValidationError
+	validationPrefix = "Invalid configuration: "
+)
+
+// Options to connect to admin API
+type Options struct {
+	// Token sent as bearer token. Empty means not sent.
+	Token string
+	// Username and Password sent using basic authentication. Empty username means not sent.
+	Username string
+	Password string
+	// HTTPClient used to send requests, for example with client certificates. If nil, a client with a 30 seconds timeout is used.
+	HTTPClient *http.Client
+}
+
+// Client calls admin API of a Diferencia instance
+type Client struct {
+	url     string
+	options Options
+}
+
+// Error is returned when admin API responds with a status code that is not 2xx.
+// Configurations rejected by validation are returned as core.ValidationError instead.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("Admin API responded with %d status code", e.StatusCode)
+	}
+	return fmt.Sprintf("Admin API responded with %d status code. %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound checks if err is a 404 response, returned for unknown configuration versions and endpoints
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// IsUnauthorized checks if err is a 401 response, returned when credentials are missing or wrong
+func IsUnauthorized(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusUnauthorized
+}
+
+// IsForbidden checks if err is a 403 response, returned when the role of the credentials does not allow the operation
+func IsForbidden(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusForbidden
+}
+
+// NewClient creates a client of the admin API listening at url (ie http://localhost:8082)
+func NewClient(url string, options Options) *Client {
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Client{
+		url:     strings.TrimSuffix(url, "/"),
+		options: options,
+	}
+}
+
+// Configuration currently applied
+func (c *Client) Configuration() (core.DiferenciaConfiguration, error) {
+	var configuration core.DiferenciaConfiguration
+	err := c.do(http.MethodGet, "/configuration", nil, nil, &configuration)
+	return configuration, err
+}
+
+// UpdateConfiguration changes the fields set in update
+func (c *Client) UpdateConfiguration(update core.DiferenciaConfigurationUpdate) error {
+	return c.do(http.MethodPut, "/configuration", nil, update, nil)
+}
+
+// PatchConfiguration merges the JSON document patch into the configuration, returning the version created
+func (c *Client) PatchConfiguration(patch []byte) (core.ConfigurationVersion, error) {
+	var version core.ConfigurationVersion
+	err := c.do(http.MethodPatch, "/configuration", nil, json.RawMessage(patch), &version)
+	return version, err
+}
+
+// ConfigurationHistory returns the applied configurations from oldest to newest
+func (c *Client) ConfigurationHistory() ([]core.ConfigurationVersion, error) {
+	var versions []core.ConfigurationVersion
+	err := c.do(http.MethodGet, "/configuration/history", nil, nil, &versions)
+	return versions, err
+}
+
+// Rollback restores the configuration of version, returning the version created
+func (c *Client) Rollback(version int) (core.ConfigurationVersion, error) {
+	var rollback core.ConfigurationVersion
+	err := c.do(http.MethodPost, "/configuration/rollback/"+strconv.Itoa(version), nil, nil, &rollback)
+	return rollback, err
+}
+
+// Stats of every endpoint
+func (c *Client) Stats() ([]exporter.Entry, error) {
+	var entries []exporter.Entry
+	err := c.do(http.MethodGet, "/stats", nil, nil, &entries)
+	return entries, err
+}
+
+// ResetStats removes stats of given method and path. Empty method or path matches any value.
+// It returns the number of removed entries.
+func (c *Client) ResetStats(method, path string) (int, error) {
+	query := url.Values{}
+	if len(method) > 0 {
+		query.Set("method", method)
+	}
+	if len(path) > 0 {
+		query.Set("path", path)
+	}
+
+	var removed struct {
+		Removed int `json:"removed"`
+	}
+	err := c.do(http.MethodDelete, "/stats", query, nil, &removed)
+	return removed.Removed, err
+}
+
+// ExportStats returns a full dump of stats
+func (c *Client) ExportStats() (exporter.Snapshot, error) {
+	var dump exporter.Snapshot
+	err := c.do(http.MethodGet, "/stats/export", nil, nil, &dump)
+	return dump, err
+}
+
+// ImportStats restores stats from a dump. If merge is true they are added to current stats instead of replacing them.
+func (c *Client) ImportStats(dump exporter.Snapshot, merge bool) error {
+	query := url.Values{}
+	if merge {
+		query.Set("merge", "true")
+	}
+	return c.do(http.MethodPost, "/stats/import", query, dump, nil)
+}
+
+// Verdict of the candidate using the rules of the configuration
+func (c *Client) Verdict() (verdict.Verdict, error) {
+	var result verdict.Verdict
+	err := c.do(http.MethodGet, "/verdict", nil, nil, &result)
+	return result, err
+}
+
+// VerdictWithRules evaluates the candidate with given rules instead of the ones of the configuration
+func (c *Client) VerdictWithRules(rules verdict.Rules) (verdict.Verdict, error) {
+	query := url.Values{}
+	query.Set("maxRegressionRate", strconv.FormatFloat(rules.MaxRegressionRate, 'f', -1, 64))
+	query.Set("maxRouteRegressionRate", strconv.FormatFloat(rules.MaxRouteRegressionRate, 'f', -1, 64))
+	query.Set("minSamples", strconv.Itoa(rules.MinSamples))
+	query.Set("maxLatencyRatio", strconv.FormatFloat(rules.MaxLatencyRatio, 'f', -1, 64))
+	query.Set("minConfidence", strconv.FormatFloat(rules.MinConfidence, 'f', -1, 64))
+
+	var result verdict.Verdict
+	err := c.do(http.MethodGet, "/verdict", query, nil, &result)
+	return result, err
+}
+
+// Snapshots returns missing and stale snapshots found while comparing against recorded responses
+func (c *Client) Snapshots() (snapshot.Report, error) {
+	var report snapshot.Report
+	err := c.do(http.MethodGet, "/snapshots", nil, nil, &report)
+	return report, err
+}
+
+// do sends body as JSON to the endpoint and decodes the response into result. Nil body or result means nothing is sent or read.
+func (c *Client) do(method, endpoint string, query url.Values, body, result interface{}) error {
+
+	target := c.url + endpoint
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var content io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, target, content)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Header.Set("Accept", "application/json")
+	if len(c.options.Token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+c.options.Token)
+	}
+	if len(c.options.Username) > 0 {
+		request.SetBasicAuth(c.options.Username, c.options.Password)
+	}
+
+	response, err := c.options.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return responseError(response)
+	}
+
+	if result == nil {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("Response of %s %s is not valid. %s", method, endpoint, err.Error())
+	}
+	return nil
+}
+
+// responseError creates the error of a response that is not 2xx
+func responseError(response *http.Response) error {
+	message, _ := ioutil.ReadAll(response.Body)
+	text := strings.TrimSpace(string(message))
+
+	if response.StatusCode == http.StatusBadRequest && strings.HasPrefix(text, validationPrefix) {
+		return &core.ValidationError{Problems: strings.Split(strings.TrimPrefix(text, validationPrefix), "; ")}
+	}
+
+	return &Error{StatusCode: response.StatusCode, Message: text}
+}
@@ -0,0 +1,190 @@
+package admin_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/lordofthejars/diferencia/admin"
+	"github.com/lordofthejars/diferencia/core"
+	"github.com/lordofthejars/diferencia/verdict"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Admin Client", func() {
+
+	var (
+		upstream *httptest.Server
+		server   *httptest.Server
+		proxy    *core.Proxy
+	)
+
+	start := func(conf core.DiferenciaConfiguration) {
+		conf.Primary = upstream.URL
+		conf.Candidate = upstream.URL
+		conf.AdminInsecure = true
+		p, err := core.NewProxy(conf)
+		Expect(err).Should(Succeed())
+		handler, err := p.AdminHandler()
+		Expect(err).Should(Succeed())
+		proxy = p
+		server = httptest.NewServer(handler)
+	}
+
+	BeforeEach(func() {
+		upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"name": "Alex"}`)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		upstream.Close()
+		proxy.Close()
+	})
+
+	Describe("Configuration", func() {
+		Context("With valid changes", func() {
+			It("should get, update, patch and rollback configuration", func() {
+
+				// Given
+				start(core.DiferenciaConfiguration{DifferenceMode: core.Strict})
+				client := admin.NewClient(server.URL, admin.Options{})
+
+				// When
+				Expect(client.UpdateConfiguration(core.DiferenciaConfigurationUpdate{Mode: "Subset"})).Should(Succeed())
+				patched, err := client.PatchConfiguration([]byte(`{"headers": true}`))
+				Expect(err).Should(Succeed())
+				configuration, err := client.Configuration()
+				Expect(err).Should(Succeed())
+				history, err := client.ConfigurationHistory()
+				Expect(err).Should(Succeed())
+				rollback, err := client.Rollback(1)
+				Expect(err).Should(Succeed())
+
+				// Then
+				Expect(configuration.DifferenceMode).Should(Equal(core.Subset))
+				Expect(configuration.Headers).Should(Equal(true))
+				Expect(patched.Version).Should(Equal(3))
+				Expect(history).Should(HaveLen(3))
+				Expect(rollback.RollbackOf).Should(Equal(1))
+				Expect(proxy.Configuration().DifferenceMode).Should(Equal(core.Strict))
+			})
+		})
+
+		Context("With invalid changes", func() {
+			It("should return a validation error", func() {
+
+				// Given
+				start(core.DiferenciaConfiguration{DifferenceMode: core.Strict})
+				client := admin.NewClient(server.URL, admin.Options{})
+
+				// When
+				_, err := client.PatchConfiguration([]byte(`{"levenshteinPercentage": 200, "mirroring": true, "returnResult": true}`))
+
+				// Then
+				validation, ok := err.(*core.ValidationError)
+				Expect(ok).Should(Equal(true))
+				Expect(validation.Problems).Should(HaveLen(2))
+			})
+
+			It("should return not found for unknown versions", func() {
+
+				// Given
+				start(core.DiferenciaConfiguration{DifferenceMode: core.Strict})
+				client := admin.NewClient(server.URL, admin.Options{})
+
+				// When
+				_, err := client.Rollback(10)
+
+				// Then
+				Expect(admin.IsNotFound(err)).Should(Equal(true))
+			})
+		})
+	})
+
+	Describe("Stats", func() {
+		Context("With compared requests", func() {
+			It("should query, export, import and reset stats", func() {
+
+				// Given
+				start(core.DiferenciaConfiguration{DifferenceMode: core.Strict})
+				proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+				proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+				client := admin.NewClient(server.URL, admin.Options{})
+
+				// When
+				entries, err := client.Stats()
+				Expect(err).Should(Succeed())
+				dump, err := client.ExportStats()
+				Expect(err).Should(Succeed())
+				removed, err := client.ResetStats("", "/users")
+				Expect(err).Should(Succeed())
+				Expect(client.ImportStats(dump, false)).Should(Succeed())
+				restored, err := client.Stats()
+				Expect(err).Should(Succeed())
+
+				// Then
+				Expect(entries).Should(HaveLen(2))
+				paths := []string{entries[0].Endpoint.Path, entries[1].Endpoint.Path}
+				Expect(paths).Should(ConsistOf("/users", "/orders"))
+				Expect(entries[0].Success).Should(Equal(1))
+				Expect(removed).Should(Equal(1))
+				Expect(restored).Should(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("Verdict", func() {
+		Context("With configured rules", func() {
+			It("should evaluate them or the given ones", func() {
+
+				// Given
+				start(core.DiferenciaConfiguration{DifferenceMode: core.Strict, VerdictMinSamples: 2})
+				proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+				client := admin.NewClient(server.URL, admin.Options{})
+
+				// When
+				configured, err := client.Verdict()
+				Expect(err).Should(Succeed())
+				given, err := client.VerdictWithRules(verdict.Rules{MinSamples: 1})
+				Expect(err).Should(Succeed())
+				_, invalid := client.VerdictWithRules(verdict.Rules{MaxRegressionRate: 200})
+
+				// Then
+				Expect(configured.Result).Should(Equal(verdict.Inconclusive))
+				Expect(given.Result).Should(Equal(verdict.Pass))
+				Expect(invalid.(*admin.Error).StatusCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+	})
+
+	Describe("Authentication", func() {
+		Context("With bearer tokens", func() {
+			It("should send the token", func() {
+
+				// Given
+				tokens, err := ioutil.TempFile("", "tokens")
+				Expect(err).Should(Succeed())
+				defer os.Remove(tokens.Name())
+				fmt.Fprintln(tokens, "alex readonly secret")
+				tokens.Close()
+				start(core.DiferenciaConfiguration{DifferenceMode: core.Strict, AdminTokensFile: tokens.Name()})
+
+				// When
+				_, authorized := admin.NewClient(server.URL, admin.Options{Token: "secret"}).Configuration()
+				_, unauthorized := admin.NewClient(server.URL, admin.Options{Token: "wrong"}).Configuration()
+				forbidden := admin.NewClient(server.URL, admin.Options{Token: "secret"}).UpdateConfiguration(core.DiferenciaConfigurationUpdate{Mode: "Subset"})
+
+				// Then
+				Expect(authorized).Should(Succeed())
+				Expect(admin.IsUnauthorized(unauthorized)).Should(Equal(true))
+				Expect(admin.IsForbidden(forbidden)).Should(Equal(true))
+			})
+		})
+	})
+})
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role granted to an identity
+type Role int
+
+const (
+	// ReadOnly identities can query configuration, stats and dashboard
+	ReadOnly Role = 1
+	// Admin identities can also modify Diferencia
+	Admin Role = 2
+)
+
+func (role Role) String() string {
+	switch role {
+	case ReadOnly:
+		return "readonly"
+	case Admin:
+		return "admin"
+	}
+	return "Unknown"
+}
+
+// NewRole creator from String
+func NewRole(role string) (Role, error) {
+
+	switch strings.ToLower(role) {
+	case "readonly":
+		return ReadOnly, nil
+	case "admin":
+		return Admin, nil
+	}
+
+	return 0, fmt.Errorf("Cannot find %s role", role)
+}
+
+// Identity of the caller of a request
+type Identity struct {
+	Name   string `json:"name"`
+	Role   Role   `json:"-"`
+	Method string `json:"method"`
+}
+
+// Anonymous identity used when authentication is disabled
+var Anonymous = Identity{Name: "anonymous", Role: Admin, Method: "none"}
+
+// Insecure authenticator grants Anonymous identity to every request, so anyone can query and modify Diferencia
+var Insecure Authenticator = anonymous{identity: Anonymous}
+
+type anonymous struct {
+	identity Identity
+}
+
+func (a anonymous) Authenticate(r *http.Request) (Identity, bool, error) {
+	return a.identity, true, nil
+}
+
+func (a anonymous) Challenge() string {
+	return ""
+}
+
+// Authenticator resolves the identity of the caller of a request
+type Authenticator interface {
+	// Authenticate returns false if the request does not contain credentials handled by this authenticator,
+	// and an error if the credentials are present but not valid.
+	Authenticate(r *http.Request) (Identity, bool, error)
+	// Challenge is the value of WWW-Authenticate header, empty if the authenticator does not need any
+	Challenge() string
+}
+
+// Chain of authenticators where the first one accepting the credentials wins
+type Chain []Authenticator
+
+// Authenticate with the first authenticator accepting the request credentials.
+// Invalid credentials of one authenticator do not prevent others from accepting theirs, the first error is only returned if none does.
+func (c Chain) Authenticate(r *http.Request) (Identity, bool, error) {
+	var firstErr error
+	for _, authenticator := range c {
+		identity, ok, err := authenticator.Authenticate(r)
+		if err == nil && ok {
+			return identity, true, nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return Identity{}, false, firstErr
+}
+
+// Challenge returns all challenges of the chain
+func (c Chain) Challenge() string {
+	var challenges []string
+	for _, authenticator := range c {
+		if challenge := authenticator.Challenge(); len(challenge) > 0 {
+			challenges = append(challenges, challenge)
+		}
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// RequiredRole returns the role needed to execute the request. Safe methods only require read access.
+func RequiredRole(r *http.Request) Role {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return ReadOnly
+	}
+	return Admin
+}
+
+type identityKey struct{}
+
+// FromRequest returns the identity that made the request
+func FromRequest(r *http.Request) Identity {
+	if identity, ok := r.Context().Value(identityKey{}).(Identity); ok {
+		return identity
+	}
+	return Anonymous
+}
+
+// Protect wraps handler so only identities with enough role can call it.
+// If authenticator is nil, every request is rejected since stats and configuration might contain sensitive data. Use Insecure to allow anonymous requests.
+func Protect(authenticator Authenticator, next http.HandlerFunc) http.HandlerFunc {
+
+	if authenticator == nil {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "Admin authentication must be configured to use admin endpoints, or anonymous access allowed with adminInsecure.")
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok, err := authenticator.Authenticate(r)
+
+		if err != nil || !ok {
+			if challenge := authenticator.Challenge(); len(challenge) > 0 {
+				w.Header().Set("WWW-Authenticate", challenge)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			if err != nil {
+				fmt.Fprint(w, err.Error())
+			}
+			return
+		}
+
+		if identity.Role < RequiredRole(r) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "%s is not allowed to execute %s %s", identity.Name, r.Method, r.URL.Path)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	}
+}
@@ -0,0 +1,13 @@
+package auth_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDiferenciaAuth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Diferencia Auth Suite")
+}
@@ -0,0 +1,266 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/lordofthejars/diferencia/auth"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ = Describe("Auth", func() {
+
+	var called bool
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}
+
+	BeforeEach(func() {
+		called = false
+	})
+
+	Describe("Protect endpoints", func() {
+		Context("Without authenticator", func() {
+			It("should reject anonymous queries", func() {
+
+				// Given
+				request := httptest.NewRequest(http.MethodGet, "/stats", nil)
+				recorder := httptest.NewRecorder()
+
+				// When
+				auth.Protect(nil, handler)(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusUnauthorized))
+				Expect(recorder.Body.String()).Should(ContainSubstring("adminInsecure"))
+				Expect(called).Should(Equal(false))
+			})
+
+			It("should reject anonymous changes", func() {
+
+				// Given
+				request := httptest.NewRequest(http.MethodPatch, "/configuration", nil)
+				recorder := httptest.NewRecorder()
+
+				// When
+				auth.Protect(nil, handler)(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusUnauthorized))
+				Expect(recorder.Body.String()).Should(ContainSubstring("Admin authentication must be configured"))
+				Expect(called).Should(Equal(false))
+			})
+		})
+
+		Context("With insecure authenticator", func() {
+			It("should allow anonymous changes", func() {
+
+				// Given
+				request := httptest.NewRequest(http.MethodPost, "/configuration/rollback/1", nil)
+				recorder := httptest.NewRecorder()
+				var identity auth.Identity
+
+				// When
+				auth.Protect(auth.Insecure, func(w http.ResponseWriter, r *http.Request) {
+					identity = auth.FromRequest(r)
+				})(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusOK))
+				Expect(identity).Should(Equal(auth.Anonymous))
+			})
+		})
+
+		Context("With chain of authenticators", func() {
+			It("should accept valid token when client certificate has no role", func() {
+
+				// Given
+				certificates, _ := auth.NewCertificateAuthenticator([]string{"ci-pipeline=admin"})
+				tokens := auth.NewTokenAuthenticator()
+				tokens.LoadEnv("ops:admin:secret1")
+				chain := auth.Chain{certificates, tokens}
+
+				request := httptest.NewRequest(http.MethodPatch, "/configuration", nil)
+				certificate := &x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}}
+				request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+				request.Header.Set("Authorization", "Bearer secret1")
+				recorder := httptest.NewRecorder()
+
+				// When
+				auth.Protect(chain, handler)(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusOK))
+				Expect(called).Should(Equal(true))
+			})
+
+			It("should reject request if no authenticator accepts it", func() {
+
+				// Given
+				certificates, _ := auth.NewCertificateAuthenticator([]string{"ci-pipeline=admin"})
+				tokens := auth.NewTokenAuthenticator()
+				tokens.LoadEnv("ops:admin:secret1")
+				chain := auth.Chain{certificates, tokens}
+
+				request := httptest.NewRequest(http.MethodGet, "/stats", nil)
+				certificate := &x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}}
+				request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+				recorder := httptest.NewRecorder()
+
+				// When
+				auth.Protect(chain, handler)(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusUnauthorized))
+				Expect(recorder.Body.String()).Should(ContainSubstring("unknown"))
+				Expect(called).Should(Equal(false))
+			})
+		})
+
+		Context("With bearer tokens", func() {
+			tokens := auth.NewTokenAuthenticator()
+			tokens.LoadEnv("ops:admin:secret1, dev:readonly:secret2")
+
+			It("should reject requests without credentials", func() {
+
+				// Given
+				request := httptest.NewRequest(http.MethodGet, "/stats", nil)
+				recorder := httptest.NewRecorder()
+
+				// When
+				auth.Protect(tokens, handler)(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusUnauthorized))
+				Expect(recorder.Header().Get("WWW-Authenticate")).Should(ContainSubstring("Bearer"))
+				Expect(called).Should(Equal(false))
+			})
+
+			It("should reject invalid tokens", func() {
+
+				// Given
+				request := httptest.NewRequest(http.MethodGet, "/stats", nil)
+				request.Header.Set("Authorization", "Bearer wrong")
+				recorder := httptest.NewRecorder()
+
+				// When
+				auth.Protect(tokens, handler)(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusUnauthorized))
+				Expect(called).Should(Equal(false))
+			})
+
+			It("should allow read only identities to query", func() {
+
+				// Given
+				request := httptest.NewRequest(http.MethodGet, "/stats", nil)
+				request.Header.Set("Authorization", "Bearer secret2")
+				recorder := httptest.NewRecorder()
+
+				// When
+				auth.Protect(tokens, handler)(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusOK))
+			})
+
+			It("should forbid read only identities to modify", func() {
+
+				// Given
+				request := httptest.NewRequest(http.MethodPatch, "/configuration", nil)
+				request.Header.Set("Authorization", "Bearer secret2")
+				recorder := httptest.NewRecorder()
+
+				// When
+				auth.Protect(tokens, handler)(recorder, request)
+
+				// Then
+				Expect(recorder.Code).Should(Equal(http.StatusForbidden))
+				Expect(called).Should(Equal(false))
+			})
+
+			It("should propagate identity to handler", func() {
+
+				// Given
+				request := httptest.NewRequest(http.MethodPatch, "/configuration", nil)
+				request.Header.Set("Authorization", "Bearer secret1")
+				recorder := httptest.NewRecorder()
+				var identity auth.Identity
+
+				// When
+				auth.Protect(tokens, func(w http.ResponseWriter, r *http.Request) {
+					identity = auth.FromRequest(r)
+				})(recorder, request)
+
+				// Then
+				Expect(identity.Name).Should(Equal("ops"))
+				Expect(identity.Role).Should(Equal(auth.Admin))
+				Expect(identity.Method).Should(Equal("bearer"))
+			})
+		})
+
+		Context("With basic authentication", func() {
+			It("should validate bcrypt passwords", func() {
+
+				// Given
+				hash, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+				basic := auth.NewBasicAuthenticator()
+				basic.Add("alex", auth.Admin, string(hash))
+
+				valid := httptest.NewRequest(http.MethodPut, "/configuration", nil)
+				valid.SetBasicAuth("alex", "password")
+				invalid := httptest.NewRequest(http.MethodPut, "/configuration", nil)
+				invalid.SetBasicAuth("alex", "wrong")
+
+				// When
+				_, validOk, validErr := basic.Authenticate(valid)
+				_, invalidOk, invalidErr := basic.Authenticate(invalid)
+
+				// Then
+				Expect(validOk).Should(Equal(true))
+				Expect(validErr).Should(Succeed())
+				Expect(invalidOk).Should(Equal(false))
+				Expect(invalidErr).Should(HaveOccurred())
+			})
+		})
+
+		Context("With client certificates", func() {
+			It("should take identity from verified certificate common name", func() {
+
+				// Given
+				certificates, err := auth.NewCertificateAuthenticator([]string{"ci-pipeline=admin"})
+				Expect(err).Should(Succeed())
+
+				request := httptest.NewRequest(http.MethodPut, "/configuration", nil)
+				certificate := &x509.Certificate{Subject: pkix.Name{CommonName: "ci-pipeline"}}
+				request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+
+				// When
+				identity, ok, err := certificates.Authenticate(request)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(ok).Should(Equal(true))
+				Expect(identity.Name).Should(Equal("ci-pipeline"))
+				Expect(identity.Role).Should(Equal(auth.Admin))
+			})
+
+			It("should fail with incorrect role definition", func() {
+
+				// When
+				_, err := auth.NewCertificateAuthenticator([]string{"ci-pipeline"})
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
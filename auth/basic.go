@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type user struct {
+	passwordHash []byte
+	identity     Identity
+}
+
+// BasicAuthenticator validates HTTP Basic credentials against bcrypt hashed passwords
+type BasicAuthenticator struct {
+	users map[string]user
+}
+
+// NewBasicAuthenticator creates an authenticator without any user
+func NewBasicAuthenticator() *BasicAuthenticator {
+	return &BasicAuthenticator{users: make(map[string]user)}
+}
+
+// Add a user with the given role and bcrypt password hash
+func (b *BasicAuthenticator) Add(name string, role Role, passwordHash string) {
+	b.users[name] = user{passwordHash: []byte(passwordHash), identity: Identity{Name: name, Role: role, Method: "basic"}}
+}
+
+// LoadFile reads users from a file where each line is `name role bcrypt-hash`. Empty lines and lines starting with # are ignored.
+func (b *BasicAuthenticator) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return readCredentials(file, b.Add)
+}
+
+// Authenticate the basic credentials of the request
+func (b *BasicAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return Identity{}, false, nil
+	}
+
+	user, found := b.users[name]
+	if !found || bcrypt.CompareHashAndPassword(user.passwordHash, []byte(password)) != nil {
+		return Identity{}, false, fmt.Errorf("Invalid user or password")
+	}
+
+	return user.identity, true, nil
+}
+
+// Challenge for basic authentication
+func (b *BasicAuthenticator) Challenge() string {
+	return `Basic realm="diferencia"`
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CertificateAuthenticator takes the identity from the Common Name of a verified client certificate
+type CertificateAuthenticator struct {
+	roles map[string]Role
+}
+
+// NewCertificateAuthenticator creates an authenticator from a list of CommonName=role
+func NewCertificateAuthenticator(commonNameRoles []string) (*CertificateAuthenticator, error) {
+	roles := make(map[string]Role)
+
+	for _, commonNameRole := range commonNameRoles {
+		index := strings.LastIndex(commonNameRole, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("Client certificate role %s must follow CommonName=role format", commonNameRole)
+		}
+		role, err := NewRole(commonNameRole[index+1:])
+		if err != nil {
+			return nil, err
+		}
+		roles[commonNameRole[:index]] = role
+	}
+
+	return &CertificateAuthenticator{roles: roles}, nil
+}
+
+// Authenticate the client certificate of the request. Only certificates verified by the TLS server are taken into account.
+func (c *CertificateAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Identity{}, false, nil
+	}
+
+	commonName := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	role, ok := c.roles[commonName]
+	if !ok {
+		return Identity{}, false, fmt.Errorf("Client certificate %s has no role assigned", commonName)
+	}
+
+	return Identity{Name: commonName, Role: role, Method: "certificate"}, true, nil
+}
+
+// Challenge is not required for client certificates
+func (c *CertificateAuthenticator) Challenge() string {
+	return ""
+}
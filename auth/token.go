@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TokensEnv is the environment variable where bearer tokens can be set as a comma separated list of name:role:token
+const TokensEnv = "DIFERENCIA_ADMIN_TOKENS"
+
+type token struct {
+	value    string
+	identity Identity
+}
+
+// TokenAuthenticator validates bearer tokens of Authorization header
+type TokenAuthenticator struct {
+	tokens []token
+}
+
+// NewTokenAuthenticator creates an authenticator without any token
+func NewTokenAuthenticator() *TokenAuthenticator {
+	return &TokenAuthenticator{}
+}
+
+// Add a token for the given name and role
+func (t *TokenAuthenticator) Add(name string, role Role, value string) {
+	t.tokens = append(t.tokens, token{value: value, identity: Identity{Name: name, Role: role, Method: "bearer"}})
+}
+
+// Len returns the number of registered tokens
+func (t *TokenAuthenticator) Len() int {
+	return len(t.tokens)
+}
+
+// LoadFile reads tokens from a file where each line is `name role token`. Empty lines and lines starting with # are ignored.
+func (t *TokenAuthenticator) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return readCredentials(file, func(name string, role Role, value string) {
+		t.Add(name, role, value)
+	})
+}
+
+// LoadEnv reads tokens from a comma separated list of name:role:token
+func (t *TokenAuthenticator) LoadEnv(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("Token definition must follow name:role:token format")
+		}
+		role, err := NewRole(parts[1])
+		if err != nil {
+			return err
+		}
+		t.Add(parts[0], role, parts[2])
+	}
+	return nil
+}
+
+// Authenticate the bearer token of the request
+func (t *TokenAuthenticator) Authenticate(r *http.Request) (Identity, bool, error) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return Identity{}, false, nil
+	}
+
+	value := strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer "))
+	for _, token := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.value), []byte(value)) == 1 {
+			return token.identity, true, nil
+		}
+	}
+
+	return Identity{}, false, fmt.Errorf("Invalid bearer token")
+}
+
+// Challenge for bearer tokens
+func (t *TokenAuthenticator) Challenge() string {
+	return `Bearer realm="diferencia"`
+}
+
+func readCredentials(reader io.Reader, add func(name string, role Role, secret string)) error {
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return fmt.Errorf("Line %d must follow `name role secret` format", line)
+		}
+		role, err := NewRole(fields[1])
+		if err != nil {
+			return fmt.Errorf("Line %d: %s", line, err.Error())
+		}
+		add(fields[0], role, fields[2])
+	}
+	return scanner.Err()
+}
@@ -3,8 +3,14 @@ package core
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+
+	"github.com/lordofthejars/diferencia/auth"
+	"github.com/lordofthejars/diferencia/verdict"
 )
 
 type DiferenciaConfigurationUpdate struct {
@@ -57,41 +63,185 @@ func (config DiferenciaConfigurationUpdate) getNoiseDetection() (bool, error) {
 	return strconv.ParseBool(config.NoiseDetection)
 }
 
-func adminHandler(w http.ResponseWriter, r *http.Request) {
+func (p *Proxy) adminHandler(w http.ResponseWriter, r *http.Request) {
 
-	mutex.Lock()
-	defer mutex.Unlock()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
-	if r.Method == http.MethodPut {
+	switch r.Method {
+	case http.MethodPut:
 		var updateConfig DiferenciaConfigurationUpdate
 
 		if err := json.NewDecoder(r.Body).Decode(&updateConfig); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, err.Error())
+			fmt.Fprint(w, err.Error())
+			return
+		}
+
+		if err := p.config.UpdateConfiguration(updateConfig); err != nil {
+			writeConfigurationError(w, err)
 			return
 		}
 
-		if err := Config.UpdateConfiguration(updateConfig); err != nil {
+		p.recordConfigurationChange(r, OriginUpdate, 0)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		patch, err := ioutil.ReadAll(r.Body)
+		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, err.Error())
+			fmt.Fprint(w, err.Error())
+			return
+		}
+
+		if err := p.config.PatchConfiguration(patch); err != nil {
+			writeConfigurationError(w, err)
 			return
 		}
 
+		writeConfigurationVersion(w, p.recordConfigurationChange(r, OriginUpdate, 0))
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Configuration-Version", strconv.Itoa(p.history.Current()))
 		w.WriteHeader(http.StatusOK)
-	} else {
-		if r.Method == http.MethodGet {
-			w.WriteHeader(http.StatusOK)
-			type Alias DiferenciaConfiguration
-			json.NewEncoder(w).Encode(&struct {
-				Mode string `json:"differenceMode,omitempty"`
-				*Alias
-			}{
-				Mode:  Config.DifferenceMode.String(),
-				Alias: (*Alias)(Config),
-			})
-		} else {
-			w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(p.config)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+}
+
+func (p *Proxy) configurationHistoryHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p.history.Versions())
+}
+
+func (p *Proxy) snapshotsHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p.snapshots.Report())
+}
+
+// verdictHandler evaluates stats with the verdict rules of the configuration. Query parameters override any of them.
+func (p *Proxy) verdictHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	p.mutex.Lock()
+	rules := p.config.verdictRules()
+	p.mutex.Unlock()
+
+	rules, err := overrideRules(rules, r.URL.Query())
+	if err == nil {
+		err = rules.Validate()
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(verdict.Evaluate(p.stats.Entries(), rules))
+}
+
+func overrideRules(rules verdict.Rules, query url.Values) (verdict.Rules, error) {
+
+	rates := map[string]*float64{
+		"maxRegressionRate":      &rules.MaxRegressionRate,
+		"maxRouteRegressionRate": &rules.MaxRouteRegressionRate,
+		"maxLatencyRatio":        &rules.MaxLatencyRatio,
+		"minConfidence":          &rules.MinConfidence,
+	}
+	for name, rate := range rates {
+		if value := query.Get(name); len(value) > 0 {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return rules, fmt.Errorf("%s must be a number. %s", name, err.Error())
+			}
+			*rate = parsed
+		}
+	}
+
+	if value := query.Get("minSamples"); len(value) > 0 {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return rules, fmt.Errorf("minSamples must be a number. %s", err.Error())
 		}
+		rules.MinSamples = parsed
+	}
+
+	return rules, nil
+}
+
+func (p *Proxy) configurationRollbackHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/configuration/rollback/"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Version to rollback must be a number. %s", err.Error())
+		return
 	}
 
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	previous, ok := p.history.Find(version)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Configuration version %d not found", version)
+		return
+	}
+
+	if err := p.config.apply(previous.Configuration.clone()); err != nil {
+		writeConfigurationError(w, err)
+		return
+	}
+
+	writeConfigurationVersion(w, p.recordConfigurationChange(r, OriginRollback, version))
+}
+
+// recordConfigurationChange stores current configuration as a new version and audits who did the change
+func (p *Proxy) recordConfigurationChange(r *http.Request, origin string, rollbackOf int) ConfigurationVersion {
+	identity := auth.FromRequest(r)
+	version := p.history.Record(*p.config, origin, rollbackOf, identity.Name)
+	p.auditLog.configurationChanged(identity, r.RemoteAddr, version)
+
+	return version
+}
+
+func writeConfigurationVersion(w http.ResponseWriter, version ConfigurationVersion) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(version)
+}
+
+func writeConfigurationError(w http.ResponseWriter, err error) {
+	if _, ok := err.(*ValidationError); ok {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	fmt.Fprint(w, err.Error())
 }
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lordofthejars/diferencia/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditEntry registers who changed the configuration and when
+type AuditEntry struct {
+	Date       time.Time `json:"date"`
+	User       string    `json:"user"`
+	AuthMethod string    `json:"authMethod"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Action     string    `json:"action"`
+	Version    int       `json:"version"`
+	RollbackOf int       `json:"rollbackOf,omitempty"`
+}
+
+// AuditLog appends configuration changes as JSON lines to a file
+type AuditLog struct {
+	sync.Mutex
+	file string
+}
+
+// NewAuditLog creates an audit log writing to file. If file is empty, entries are only logged.
+func NewAuditLog(file string) *AuditLog {
+	return &AuditLog{file: file}
+}
+
+// Write a new entry to audit log
+func (a *AuditLog) Write(entry AuditEntry) error {
+
+	logrus.WithFields(logrus.Fields{
+		"user":       entry.User,
+		"authMethod": entry.AuthMethod,
+		"remoteAddr": entry.RemoteAddr,
+		"version":    entry.Version,
+	}).Infof("Configuration %s", entry.Action)
+
+	if len(a.file) == 0 {
+		return nil
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	f, err := os.OpenFile(a.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(entry)
+}
+
+// configurationChanged writes who changed the configuration and which version was created
+func (a *AuditLog) configurationChanged(identity auth.Identity, remoteAddr string, version ConfigurationVersion) {
+	entry := AuditEntry{
+		Date:       version.Applied,
+		User:       identity.Name,
+		AuthMethod: identity.Method,
+		RemoteAddr: remoteAddr,
+		Action:     version.Origin,
+		Version:    version.Version,
+		RollbackOf: version.RollbackOf,
+	}
+
+	if err := a.Write(entry); err != nil {
+		logrus.Errorf("Error writing audit log %s. %s", a.file, err.Error())
+	}
+}
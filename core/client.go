@@ -4,7 +4,9 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
 )
 
 // Client interface
@@ -26,6 +28,8 @@ func (httpClient *HTTPClient) MakeRequest(r *http.Request, url string) (*http.Re
 		return nil, err
 	}
 
+	newRequest = newRequest.WithContext(r.Context())
+
 	newRequest.Header = r.Header
 
 	newRequest.ContentLength = r.ContentLength
@@ -78,3 +82,25 @@ func (httpClient *HTTPClient) MakeRequest(r *http.Request, url string) (*http.Re
 	return client.Do(newRequest)
 
 }
+
+// upstreamErrorType classifies errors returned by Client
+func upstreamErrorType(err error) string {
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return "timeout"
+	}
+
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "connection refused"):
+		return "connection_refused"
+	case strings.Contains(message, "no such host"):
+		return "dns"
+	case strings.Contains(message, "tls:") || strings.Contains(message, "x509:"):
+		return "tls"
+	case strings.Contains(message, "connection reset"):
+		return "connection_reset"
+	}
+
+	return "other"
+}
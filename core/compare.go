@@ -0,0 +1,39 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lordofthejars/diferencia/status"
+)
+
+// Compare primary and candidate responses with the rules of the configuration, like the proxy does but without calling any upstream.
+// If secondary is not nil, noise detected between primary and secondary is removed before comparing.
+func Compare(conf DiferenciaConfiguration, primary Communicationcontent, secondary *Communicationcontent, candidate Communicationcontent) (Result, error) {
+
+	primaryContent := primary.Content
+	candidateContent := candidate.Content
+
+	if secondary != nil {
+		if primary.StatusCode != secondary.StatusCode {
+			return Result{EqualContent: false}, &DiferenciaError{http.StatusBadRequest, fmt.Sprintf("Status code between primary(%d) and secondary(%d) are different", primary.StatusCode, secondary.StatusCode)}
+		}
+
+		var err error
+		primaryContent, candidateContent, err = conf.removeNoise(primary.Header, primary.Content, secondary.Content, candidate.Content)
+		if err != nil {
+			return Result{EqualContent: false}, &DiferenciaError{http.StatusBadRequest, fmt.Sprintf("Error detecting noise between primary and secondary. (%s)", err.Error())}
+		}
+	}
+
+	// There is no request, so only equivalences of any method and route apply
+	statuses, err := status.New(conf.StatusEquivalences)
+	if err != nil {
+		return Result{EqualContent: false}, &DiferenciaError{http.StatusBadRequest, err.Error()}
+	}
+	statusEquivalent := statuses.Equivalent("", status.AnyRoute, primary.StatusCode, candidate.StatusCode)
+
+	equal, diff := conf.compareResult(candidateContent, primaryContent, candidate.StatusCode, primary.StatusCode, statusEquivalent, candidate.Header, primary.Header)
+
+	return Result{EqualContent: equal, Diff: diff}, nil
+}
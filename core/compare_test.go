@@ -0,0 +1,130 @@
+package core_test
+
+import (
+	"net/http"
+
+	"github.com/lordofthejars/diferencia/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compare", func() {
+
+	json := http.Header{"Content-Type": []string{"application/json"}}
+
+	Describe("Compare saved responses", func() {
+		Context("Without noise reduction", func() {
+			It("should return true if both documents are equal", func() {
+
+				// Given
+				primary := core.Communicationcontent{Content: []byte(loadFromFile("test_fixtures/document-a.json")), StatusCode: 200, Header: json}
+				candidate := core.Communicationcontent{Content: []byte(loadFromFile("test_fixtures/document-a.json")), StatusCode: 200, Header: json}
+
+				// When
+				result, err := core.Compare(core.DiferenciaConfiguration{DifferenceMode: core.Strict}, primary, nil, candidate)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(result.EqualContent).Should(Equal(true))
+			})
+
+			It("should describe status differences", func() {
+
+				// Given
+				primary := core.Communicationcontent{Content: []byte(`{}`), StatusCode: 200, Header: json}
+				candidate := core.Communicationcontent{Content: []byte(`{}`), StatusCode: 500, Header: json}
+
+				// When
+				result, err := core.Compare(core.DiferenciaConfiguration{DifferenceMode: core.Strict}, primary, nil, candidate)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(result.EqualContent).Should(Equal(false))
+				Expect(result.Diff.StatusDiff).Should(Equal(`"status": 200 => 500`))
+			})
+
+			It("should compare headers and body of equivalent status codes", func() {
+
+				// Given
+				primary := core.Communicationcontent{Content: []byte(`{}`), StatusCode: 404, Header: json}
+				candidate := core.Communicationcontent{Content: []byte(`{}`), StatusCode: 410, Header: json}
+				headers := http.Header{"Content-Type": []string{"application/json"}, "Etag": []string{"2"}}
+				conf := core.DiferenciaConfiguration{DifferenceMode: core.Strict, Headers: true, StatusEquivalences: []string{"*=404,410"}}
+
+				// When
+				equivalent, err := core.Compare(conf, primary, nil, candidate)
+				different, _ := core.Compare(conf, primary, nil, core.Communicationcontent{Content: []byte(`{}`), StatusCode: 410, Header: headers})
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(equivalent.EqualContent).Should(Equal(true))
+				Expect(different.EqualContent).Should(Equal(false))
+				Expect(different.Diff.HeadersDiff).Should(ContainSubstring("Etag"))
+				Expect(different.Diff.StatusDiff).Should(Equal(`"status": 404 => 410 (equivalent)`))
+				Expect(equivalent.Diff.StatusDiff).Should(BeEmpty())
+			})
+
+			It("should compare headers if enabled", func() {
+
+				// Given
+				primary := core.Communicationcontent{Content: []byte(`{}`), StatusCode: 200, Header: http.Header{"Content-Type": []string{"application/json"}, "Etag": []string{"1"}}}
+				candidate := core.Communicationcontent{Content: []byte(`{}`), StatusCode: 200, Header: http.Header{"Content-Type": []string{"application/json"}, "Etag": []string{"2"}}}
+
+				// When
+				result, _ := core.Compare(core.DiferenciaConfiguration{DifferenceMode: core.Strict, Headers: true}, primary, nil, candidate)
+				ignored, _ := core.Compare(core.DiferenciaConfiguration{DifferenceMode: core.Strict, Headers: true, IgnoreHeadersValues: []string{"Etag"}}, primary, nil, candidate)
+
+				// Then
+				Expect(result.EqualContent).Should(Equal(false))
+				Expect(result.Diff.HeadersDiff).Should(ContainSubstring("Etag"))
+				Expect(ignored.EqualContent).Should(Equal(true))
+			})
+
+			It("should use levenshtein for text", func() {
+
+				// Given
+				text := http.Header{"Content-Type": []string{"text/plain"}}
+				primary := core.Communicationcontent{Content: []byte("Hello World"), StatusCode: 200, Header: text}
+				candidate := core.Communicationcontent{Content: []byte("Hello Wordl"), StatusCode: 200, Header: text}
+
+				// When
+				strict, _ := core.Compare(core.DiferenciaConfiguration{LevenshteinPercentage: 100}, primary, nil, candidate)
+				similar, _ := core.Compare(core.DiferenciaConfiguration{LevenshteinPercentage: 70}, primary, nil, candidate)
+
+				// Then
+				Expect(strict.EqualContent).Should(Equal(false))
+				Expect(similar.EqualContent).Should(Equal(true))
+			})
+		})
+
+		Context("With noise reduction", func() {
+			It("should return true if both documents are same but with different values", func() {
+
+				// Given
+				primary := core.Communicationcontent{Content: []byte(loadFromFile("test_fixtures/document-a.json")), StatusCode: 200, Header: json}
+				secondary := core.Communicationcontent{Content: []byte(loadFromFile("test_fixtures/document-a-change-date.json")), StatusCode: 200, Header: json}
+				candidate := core.Communicationcontent{Content: []byte(loadFromFile("test_fixtures/document-a-change-date.json")), StatusCode: 200, Header: json}
+
+				// When
+				result, err := core.Compare(core.DiferenciaConfiguration{DifferenceMode: core.Strict}, primary, &secondary, candidate)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(result.EqualContent).Should(Equal(true))
+			})
+
+			It("should fail if primary and secondary status codes are different", func() {
+
+				// Given
+				primary := core.Communicationcontent{Content: []byte(`{}`), StatusCode: 200, Header: json}
+				secondary := core.Communicationcontent{Content: []byte(`{}`), StatusCode: 404, Header: json}
+
+				// When
+				_, err := core.Compare(core.DiferenciaConfiguration{DifferenceMode: core.Strict}, primary, &secondary, primary)
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
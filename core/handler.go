@@ -0,0 +1,309 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/lordofthejars/diferencia/auth"
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/metrics"
+	"github.com/lordofthejars/diferencia/redact"
+	"github.com/lordofthejars/diferencia/route"
+	"github.com/lordofthejars/diferencia/snapshot"
+	"github.com/lordofthejars/diferencia/status"
+	"github.com/lordofthejars/diferencia/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// Proxy compares responses of primary and candidate for every request it serves.
+// Each Proxy has its own configuration, stats and metrics registry, so several proxies can run in the same process or be embedded in any server.
+type Proxy struct {
+	mutex        sync.Mutex
+	config       *DiferenciaConfiguration
+	client       Client
+	stats        *exporter.URLCounterMap
+	metrics      *metrics.Comparison
+	interactions *exporter.InteractionLog
+	sinks        exporter.Sinks
+	tracer       *tracing.Exporter
+	snapshots    *snapshot.Store
+	history      *ConfigurationHistory
+	auditLog     *AuditLog
+
+	// Built from the applied configuration
+	applied  *DiferenciaConfiguration
+	routes   *route.Matcher
+	redactor *redact.Redactor
+	statuses *status.Equivalences
+}
+
+// NewProxy creates a proxy of given configuration calling upstreams over HTTP
+func NewProxy(conf DiferenciaConfiguration) (*Proxy, error) {
+	return NewProxyWithClient(conf, nil)
+}
+
+// NewProxyWithClient creates a proxy of given configuration calling upstreams with client.
+// If client is nil, upstreams are called over HTTP.
+func NewProxyWithClient(conf DiferenciaConfiguration, client Client) (*Proxy, error) {
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	config := conf.clone()
+	if len(config.ServiceName) == 0 {
+		config.SetServiceName("")
+	}
+
+	if client == nil {
+		client = &HTTPClient{
+			config: &config,
+		}
+	}
+
+	p := &Proxy{
+		config:   &config,
+		client:   client,
+		stats:    exporter.NewURLCounterMap(),
+		history:  NewConfigurationHistory(),
+		auditLog: NewAuditLog(config.AdminAuditLog),
+	}
+
+	// Initialize interaction log if required
+	if config.IsStoreResultsSet() {
+		interactions, err := exporter.NewInteractionLog(config.StoreResults, config.rotationPolicy())
+		if err != nil {
+			logrus.Errorf("Error opening interaction log %s. %s. Interactions are not going to be stored.", config.StoreResults, err.Error())
+		} else {
+			p.interactions = interactions
+		}
+	}
+
+	// Initialize snapshots if required
+	if config.IsSnapshotModeSet() {
+		// Validated before
+		maxAge, _ := time.ParseDuration(config.SnapshotMaxAge)
+		store, err := snapshot.NewStore(config.SnapshotDir, maxAge)
+		if err != nil {
+			logrus.Errorf("Error opening snapshots %s. %s. Snapshots are not going to be used.", config.SnapshotDir, err.Error())
+		} else {
+			p.snapshots = store
+		}
+	}
+
+	// Initialize result sinks if required
+	if len(config.Sinks) > 0 {
+		sinks, err := exporter.NewSinks(config.Sinks, config.webhookOptions())
+		if err != nil {
+			logrus.Errorf("Error creating sinks %v. %s. Results are not going to be sent to sinks.", config.Sinks, err.Error())
+		} else {
+			p.sinks = sinks
+		}
+	}
+
+	// Initialize OTLP exporter if required
+	if config.IsTracingEndpointSet() {
+		tracer, err := tracing.NewExporter(config.TracingEndpoint, config.ServiceName)
+		if err != nil {
+			logrus.Errorf("Error exporting traces to %s. %s. Spans are not going to be exported.", config.TracingEndpoint, err.Error())
+		} else {
+			p.tracer = tracer
+		}
+	}
+
+	// Initialize persistent stats if required
+	if config.IsStatsStoreSet() {
+		store, err := exporter.NewBoltStore(config.StatsStore)
+		if err != nil {
+			logrus.Errorf("Error opening stats store %s. %s. Stats are going to be stored in memory.", config.StatsStore, err.Error())
+		} else {
+			p.stats = exporter.NewURLCounterMapWithStore(store)
+		}
+	}
+
+	//Initialize Prometheus if required
+	if config.Prometheus {
+		p.metrics = metrics.NewComparison()
+	}
+
+	p.refresh()
+	p.history.Record(config, OriginStartup, 0, "")
+
+	return p, nil
+}
+
+// refresh rebuilds everything that depends on configuration if it has changed since last time.
+// Configuration might be changed at any moment using the admin endpoints or PatchConfiguration.
+func (p *Proxy) refresh() {
+
+	if p.applied != nil && reflect.DeepEqual(*p.applied, *p.config) {
+		return
+	}
+
+	if p.applied != nil && (p.applied.ServiceName != p.config.ServiceName || p.applied.Candidate != p.config.Candidate) {
+		p.metrics.Retire(p.applied.ServiceName, p.applied.Candidate)
+	}
+
+	p.stats.SetErrorSampling(p.config.errorSampling())
+	// Validated before
+	p.routes, _ = route.NewMatcher(p.config.RouteTemplates, p.config.InferRouteTemplates)
+	p.redactor, _ = redact.New(p.config.redactionRules())
+	p.stats.SetRedactor(p.redactor)
+	p.statuses, _ = status.New(p.config.StatusEquivalences)
+
+	applied := p.config.clone()
+	p.applied = &applied
+}
+
+// Configuration currently applied by the proxy
+func (p *Proxy) Configuration() DiferenciaConfiguration {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.config.clone()
+}
+
+// Stats of the comparisons served by the proxy
+func (p *Proxy) Stats() *exporter.URLCounterMap {
+	return p.stats
+}
+
+// Metrics of the proxy. It is nil if Prometheus is not enabled.
+func (p *Proxy) Metrics() *metrics.Comparison {
+	return p.metrics
+}
+
+// Compare sends the request to all upstreams and compares their responses. Result is not added to stats.
+func (p *Proxy) Compare(r *http.Request) (Result, Communicationcontent, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.compare(r)
+}
+
+// ServeHTTP compares the request and returns the result, or primary response in mirroring mode. Result is added to stats.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logrus.Errorf("Error reading body: %v", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	result, primaryCommunication, err := p.compare(r)
+	routeTemplate := p.routes.Template(r.URL.Path)
+	if err != nil {
+		if de, ok := err.(*DiferenciaError); ok {
+			w.WriteHeader(de.code)
+			fmt.Fprint(w, de.message)
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	observation := exporter.Observation{
+		PrimaryElapsedTime:   result.PrimaryElapsedTime,
+		CandidateElapsedTime: result.CandidateElapsedTime,
+		PrimaryStatus:        result.PrimaryStatus,
+		CandidateStatus:      result.CandidateStatus,
+		PrimaryFailure:       result.PrimaryFailure,
+		CandidateFailure:     result.CandidateFailure,
+		Slow:                 result.Slow,
+	}
+	if result.EqualContent {
+		if p.config.Mirroring {
+			p.mirror(w, result, primaryCommunication)
+		} else {
+			if p.config.ReturnResult {
+				content, _ := result.MarshallJson()
+				w.Write(content)
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+		p.stats.IncSuccess(r.Method, routeTemplate, observation)
+	} else {
+		// If there is a regression
+		if p.config.Mirroring {
+			p.mirror(w, result, primaryCommunication)
+		} else {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			if p.config.ReturnResult {
+				content, _ := result.MarshallJson()
+				w.Write(content)
+			}
+		}
+		p.stats.IncErr(r.Method, routeTemplate, observation, exporter.ErrorData{
+			FullURI:         p.redactor.Text(r.URL.RequestURI()),
+			OriginalBody:    p.redactor.Body(string(body[:])),
+			OriginalHeaders: p.redactor.Headers(r.Header),
+			HeaderDiff:      result.Diff.HeadersDiff,
+			BodyDiff:        result.Diff.BodyDiff,
+			StatusDiff:      result.Diff.StatusDiff,
+			TransportDiff:   result.Diff.TransportDiff,
+		})
+	}
+}
+
+// mirror writes primary response, or 503 if primary could not be called
+func (p *Proxy) mirror(w http.ResponseWriter, result Result, primaryCommunication Communicationcontent) {
+	if len(result.PrimaryFailure) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "Error while connecting to Primary site (%s) with %s", p.config.Primary, result.PrimaryFailure)
+		return
+	}
+	MirrorResponse(primaryCommunication, w)
+}
+
+// AdminHandler exposes configuration, stats, verdict, snapshots and dashboard of the proxy.
+// Endpoints are protected with the admin authentication of the configuration.
+func (p *Proxy) AdminHandler() (http.Handler, error) {
+
+	authenticator, err := newAdminAuthenticator(*p.config)
+	if err != nil {
+		return nil, err
+	}
+
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/configuration", auth.Protect(authenticator, p.adminHandler))
+	adminMux.HandleFunc("/configuration/history", auth.Protect(authenticator, p.configurationHistoryHandler))
+	adminMux.HandleFunc("/configuration/rollback/", auth.Protect(authenticator, p.configurationRollbackHandler))
+	adminMux.HandleFunc("/stats", auth.Protect(authenticator, p.stats.StatsHandler))
+	adminMux.HandleFunc("/stats/export", auth.Protect(authenticator, p.stats.ExportHandler))
+	adminMux.HandleFunc("/stats/import", auth.Protect(authenticator, p.stats.ImportHandler))
+	adminMux.HandleFunc("/snapshots", auth.Protect(authenticator, p.snapshotsHandler))
+	adminMux.HandleFunc("/verdict", auth.Protect(authenticator, p.verdictHandler))
+	adminMux.HandleFunc("/dashboard/details", auth.Protect(authenticator, p.dashboardDetailsHandler))
+	adminMux.HandleFunc("/dashboard/", auth.Protect(authenticator, p.dashboardHandler))
+
+	return adminMux, nil
+}
+
+// MetricsHandler exposes Prometheus metrics of the proxy. It returns 404 if Prometheus is not enabled.
+func (p *Proxy) MetricsHandler() http.Handler {
+	if p.metrics == nil {
+		return http.NotFoundHandler()
+	}
+	return p.metrics.Handler()
+}
+
+// Close writes pending interactions, results and spans and closes stats store
+func (p *Proxy) Close() error {
+	var first error
+	for _, closer := range []func() error{p.interactions.Close, p.sinks.Close, p.tracer.Close, p.stats.Close} {
+		if err := closer(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
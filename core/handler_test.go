@@ -0,0 +1,432 @@
+package core_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lordofthejars/diferencia/core"
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/redact"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Embedded Proxy", func() {
+
+	var (
+		primary   *httptest.Server
+		candidate *httptest.Server
+	)
+
+	BeforeEach(func() {
+		primary = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Version", "1")
+			fmt.Fprint(w, `{"name": "Alex"}`)
+		}))
+		candidate = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Version", "2")
+			fmt.Fprint(w, `{"name": "Alex"}`)
+		}))
+	})
+
+	AfterEach(func() {
+		primary.Close()
+		candidate.Close()
+	})
+
+	Describe("Serve requests", func() {
+		Context("With two proxies in the same process", func() {
+			It("should compare with their own configuration and stats", func() {
+
+				// Given
+				headers, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, DifferenceMode: core.Strict, Headers: true})
+				Expect(err).Should(Succeed())
+				defer headers.Close()
+
+				body, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, DifferenceMode: core.Strict})
+				Expect(err).Should(Succeed())
+				defer body.Close()
+
+				// When
+				headersResponse := httptest.NewRecorder()
+				headers.ServeHTTP(headersResponse, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+				bodyResponse := httptest.NewRecorder()
+				body.ServeHTTP(bodyResponse, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(headersResponse.Code).Should(Equal(http.StatusPreconditionFailed))
+				Expect(bodyResponse.Code).Should(Equal(http.StatusOK))
+				Expect(headers.Stats().FindEntry(http.MethodGet, "/users/1").Errors).Should(Equal(1))
+				Expect(headers.Stats().FindEntry(http.MethodGet, "/users/1").Success).Should(Equal(0))
+				Expect(body.Stats().FindEntry(http.MethodGet, "/users/1").Success).Should(Equal(1))
+				Expect(body.Stats().FindEntry(http.MethodGet, "/users/1").Errors).Should(Equal(0))
+			})
+		})
+
+		Context("With an invalid configuration", func() {
+			It("should not create the proxy", func() {
+
+				// When
+				_, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, DifferenceMode: core.Strict})
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("With a latency budget", func() {
+			It("should report slow candidate beside the comparison result", func() {
+
+				// Given
+				slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(50 * time.Millisecond)
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprint(w, `{"name": "Alex"}`)
+				}))
+				defer slow.Close()
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: slow.URL, DifferenceMode: core.Strict, LatencyBudget: "20ms", ReturnResult: true})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusOK))
+				Expect(response.Body.String()).Should(ContainSubstring(`"Slow":true`))
+				entry := proxy.Stats().FindEntry(http.MethodGet, "/users/1")
+				Expect(entry.Success).Should(Equal(1))
+				Expect(entry.Slow).Should(Equal(1))
+				Expect(entry.CandidateLatency.P50).Should(BeNumerically(">=", 50))
+			})
+		})
+
+		Context("With status equivalences", func() {
+			It("should only apply equivalences of the route", func() {
+
+				// Given
+				created := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprint(w, `{"name": "Alex"}`)
+				}))
+				defer created.Close()
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: created.URL, DifferenceMode: core.Strict,
+					RouteTemplates: []string{"/users/{id}"}, StatusEquivalences: []string{"GET /users/{id}=200,201"}})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+
+				// When
+				users := httptest.NewRecorder()
+				proxy.ServeHTTP(users, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+				orders := httptest.NewRecorder()
+				proxy.ServeHTTP(orders, httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+
+				// Then
+				Expect(users.Code).Should(Equal(http.StatusOK))
+				Expect(orders.Code).Should(Equal(http.StatusPreconditionFailed))
+			})
+		})
+
+		Context("With redaction pointers", func() {
+			It("should redact values of body diffs", func() {
+
+				// Given
+				changed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprint(w, `{"name": "Ada", "age": 36}`)
+				}))
+				defer changed.Close()
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: changed.URL, DifferenceMode: core.Strict, RedactPointers: []string{"/name"}})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusPreconditionFailed))
+				diff := proxy.Stats().FindEntry(http.MethodGet, "/users/1").ErrorDetails[0].BodyDiff
+				Expect(diff).Should(ContainSubstring("age"))
+				Expect(diff).Should(ContainSubstring(redact.Mask))
+				Expect(diff).ShouldNot(ContainSubstring("Ada"))
+				Expect(diff).ShouldNot(ContainSubstring("Alex"))
+			})
+		})
+
+		Context("With upstreams that cannot be called", func() {
+
+			closedURL := func() string {
+				closed := httptest.NewServer(http.NotFoundHandler())
+				closed.Close()
+				return closed.URL
+			}
+
+			It("should count a regression when only candidate fails", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: closedURL(), DifferenceMode: core.Strict, ReturnResult: true, AdminInsecure: true})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+				admin, err := proxy.AdminHandler()
+				Expect(err).Should(Succeed())
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusPreconditionFailed))
+				Expect(response.Body.String()).Should(ContainSubstring(`"CandidateFailure":"connection_refused"`))
+				entry := proxy.Stats().FindEntry(http.MethodGet, "/users/1")
+				Expect(entry.Errors).Should(Equal(1))
+				Expect(entry.CandidateFailures).Should(Equal(map[string]int{"connection_refused": 1}))
+				Expect(entry.ErrorDetails[0].TransportDiff).Should(Equal(`"transport": 200 => connection_refused`))
+
+				dashboard := httptest.NewRecorder()
+				admin.ServeHTTP(dashboard, httptest.NewRequest(http.MethodGet, "/dashboard/", nil))
+				Expect(dashboard.Body.String()).Should(ContainSubstring("Candidate connection_refused"))
+			})
+
+			It("should redact urls of error messages", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, Secondary: closedURL(), DifferenceMode: core.Strict,
+					NoiseDetection: true, RedactPatterns: []string{"token=[^&]+"}})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1?token=secret", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusServiceUnavailable))
+				Expect(response.Body.String()).Should(ContainSubstring(redact.Mask))
+				Expect(response.Body.String()).ShouldNot(ContainSubstring("secret"))
+			})
+
+			It("should return error messages as they are", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, Secondary: closedURL(), DifferenceMode: core.Strict, NoiseDetection: true})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1?discount=100%25", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusServiceUnavailable))
+				Expect(response.Body.String()).Should(ContainSubstring("/users/1?discount=100%25"))
+			})
+
+			It("should count a match when both fail the same way", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: closedURL(), Candidate: closedURL(), DifferenceMode: core.Strict})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusOK))
+				entry := proxy.Stats().FindEntry(http.MethodGet, "/users/1")
+				Expect(entry.Success).Should(Equal(1))
+				Expect(entry.PrimaryFailures).Should(Equal(map[string]int{"connection_refused": 1}))
+				Expect(entry.CandidateFailures).Should(Equal(map[string]int{"connection_refused": 1}))
+			})
+
+			It("should count a regression and store the interaction when only primary fails", func() {
+
+				// Given
+				dir, err := ioutil.TempDir("", "interactions")
+				Expect(err).Should(Succeed())
+				defer os.RemoveAll(dir)
+				log := filepath.Join(dir, "interactions.log")
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: closedURL(), Candidate: candidate.URL, DifferenceMode: core.Strict, StoreResults: log})
+				Expect(err).Should(Succeed())
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+				entry := proxy.Stats().FindEntry(http.MethodGet, "/users/1")
+				Expect(proxy.Close()).Should(Succeed())
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusPreconditionFailed))
+				Expect(entry.Errors).Should(Equal(1))
+				Expect(entry.PrimaryFailures).Should(Equal(map[string]int{"connection_refused": 1}))
+				Expect(entry.ErrorDetails[0].TransportDiff).Should(Equal(`"transport": connection_refused => 200`))
+
+				interactions, err := exporter.LoadInteractions(log)
+				Expect(err).Should(Succeed())
+				Expect(interactions).Should(HaveLen(1))
+				Expect(interactions[0].Result).Should(BeFalse())
+				Expect(interactions[0].Primary.Error).Should(Equal("connection_refused"))
+				Expect(interactions[0].Candidate.StatusCode).Should(Equal(http.StatusOK))
+			})
+
+			It("should return service unavailable when only primary fails mirroring", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: closedURL(), Candidate: candidate.URL, DifferenceMode: core.Strict, Mirroring: true})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusServiceUnavailable))
+				Expect(proxy.Stats().FindEntry(http.MethodGet, "/users/1").Errors).Should(Equal(1))
+			})
+		})
+
+		Context("With requests that cannot be compared", func() {
+			It("should only write the error", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, DifferenceMode: core.Strict})
+				Expect(err).Should(Succeed())
+				defer proxy.Close()
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+				Expect(response.Body.String()).Should(Equal("Unsafe operations are not allowed and POST method has been received"))
+			})
+		})
+
+		Context("With a stubbed client", func() {
+			It("should call upstreams using the client", func() {
+
+				// Given
+				httpClient := &StubHttpClient{}
+				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a.json")
+				recordStatus(httpClient, 200, 200)
+				proxy, err := core.NewProxyWithClient(core.DiferenciaConfiguration{Primary: "http://primary", Candidate: "http://candidate", DifferenceMode: core.Strict}, httpClient)
+				Expect(err).Should(Succeed())
+
+				// When
+				result, _, err := proxy.Compare(httptest.NewRequest(http.MethodGet, "/", nil))
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(result.EqualContent).Should(Equal(true))
+				Expect(httpClient.requests).Should(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("Admin", func() {
+		Context("With configuration endpoint", func() {
+			It("should change only the configuration of its proxy", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, DifferenceMode: core.Strict, Headers: true, AdminInsecure: true})
+				Expect(err).Should(Succeed())
+				other, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, DifferenceMode: core.Strict, Headers: true})
+				Expect(err).Should(Succeed())
+				admin, err := proxy.AdminHandler()
+				Expect(err).Should(Succeed())
+
+				// When
+				patch := httptest.NewRecorder()
+				admin.ServeHTTP(patch, httptest.NewRequest(http.MethodPatch, "/configuration", strings.NewReader(`{"headers": false}`)))
+				response := httptest.NewRecorder()
+				proxy.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(patch.Code).Should(Equal(http.StatusOK))
+				Expect(response.Code).Should(Equal(http.StatusOK))
+				Expect(proxy.Configuration().Headers).Should(Equal(false))
+				Expect(other.Configuration().Headers).Should(Equal(true))
+
+				stats := httptest.NewRecorder()
+				admin.ServeHTTP(stats, httptest.NewRequest(http.MethodGet, "/stats", nil))
+				var entries []map[string]interface{}
+				Expect(json.NewDecoder(stats.Body).Decode(&entries)).Should(Succeed())
+				Expect(entries).Should(HaveLen(1))
+			})
+
+			It("should reject anonymous requests without admin authentication", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, DifferenceMode: core.Strict, Headers: true})
+				Expect(err).Should(Succeed())
+				admin, err := proxy.AdminHandler()
+				Expect(err).Should(Succeed())
+
+				// When
+				query := httptest.NewRecorder()
+				admin.ServeHTTP(query, httptest.NewRequest(http.MethodGet, "/configuration", nil))
+				patch := httptest.NewRecorder()
+				admin.ServeHTTP(patch, httptest.NewRequest(http.MethodPatch, "/configuration", strings.NewReader(`{"headers": false}`)))
+				rollback := httptest.NewRecorder()
+				admin.ServeHTTP(rollback, httptest.NewRequest(http.MethodPost, "/configuration/rollback/1", nil))
+
+				// Then
+				Expect(query.Code).Should(Equal(http.StatusUnauthorized))
+				Expect(patch.Code).Should(Equal(http.StatusUnauthorized))
+				Expect(rollback.Code).Should(Equal(http.StatusUnauthorized))
+				Expect(proxy.Configuration().Headers).Should(Equal(true))
+			})
+		})
+	})
+
+	Describe("Metrics", func() {
+		Context("With Prometheus enabled", func() {
+			It("should expose metrics of its own registry", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, DifferenceMode: core.Strict, Prometheus: true})
+				Expect(err).Should(Succeed())
+				proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.MetricsHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusOK))
+				Expect(response.Body.String()).Should(ContainSubstring("diferencia"))
+			})
+		})
+
+		Context("With Prometheus disabled", func() {
+			It("should not expose metrics", func() {
+
+				// Given
+				proxy, err := core.NewProxy(core.DiferenciaConfiguration{Primary: primary.URL, Candidate: candidate.URL, DifferenceMode: core.Strict})
+				Expect(err).Should(Succeed())
+
+				// When
+				response := httptest.NewRecorder()
+				proxy.MetricsHandler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+				// Then
+				Expect(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+})
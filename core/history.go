@@ -0,0 +1,95 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// OriginStartup is set to the configuration provided when Diferencia is started
+	OriginStartup = "startup"
+	// OriginUpdate is set to configurations modified using admin API
+	OriginUpdate = "update"
+	// OriginRollback is set to configurations restored from a previous version
+	OriginRollback = "rollback"
+)
+
+const maxConfigurationVersions = 100
+
+// ConfigurationVersion is a snapshot of a configuration applied at a given moment
+type ConfigurationVersion struct {
+	Version       int                     `json:"version"`
+	Origin        string                  `json:"origin"`
+	RollbackOf    int                     `json:"rollbackOf,omitempty"`
+	Author        string                  `json:"author,omitempty"`
+	Applied       time.Time               `json:"appliedDate"`
+	Configuration DiferenciaConfiguration `json:"configuration"`
+}
+
+// ConfigurationHistory is a concurrent list of the applied configurations
+type ConfigurationHistory struct {
+	sync.RWMutex
+	versions    []ConfigurationVersion
+	lastVersion int
+}
+
+// NewConfigurationHistory creates an empty history
+func NewConfigurationHistory() *ConfigurationHistory {
+	return &ConfigurationHistory{}
+}
+
+// Record stores a new version of the configuration. Only the latest versions are kept.
+func (h *ConfigurationHistory) Record(conf DiferenciaConfiguration, origin string, rollbackOf int, author string) ConfigurationVersion {
+	h.Lock()
+	defer h.Unlock()
+
+	h.lastVersion++
+	version := ConfigurationVersion{
+		Version:       h.lastVersion,
+		Origin:        origin,
+		RollbackOf:    rollbackOf,
+		Author:        author,
+		Applied:       time.Now(),
+		Configuration: conf.clone(),
+	}
+
+	h.versions = append(h.versions, version)
+	if len(h.versions) > maxConfigurationVersions {
+		h.versions = h.versions[len(h.versions)-maxConfigurationVersions:]
+	}
+
+	return version
+}
+
+// Versions returns all stored versions from oldest to newest
+func (h *ConfigurationHistory) Versions() []ConfigurationVersion {
+	h.RLock()
+	defer h.RUnlock()
+
+	versions := make([]ConfigurationVersion, len(h.versions))
+	copy(versions, h.versions)
+
+	return versions
+}
+
+// Find a version by its number
+func (h *ConfigurationHistory) Find(version int) (ConfigurationVersion, bool) {
+	h.RLock()
+	defer h.RUnlock()
+
+	for _, v := range h.versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+
+	return ConfigurationVersion{}, false
+}
+
+// Current returns the number of the latest applied version
+func (h *ConfigurationHistory) Current() int {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.lastVersion
+}
@@ -0,0 +1,61 @@
+package core_test
+
+import (
+	"github.com/lordofthejars/diferencia/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Configuration History", func() {
+
+	Describe("Record versions", func() {
+		Context("With several configurations", func() {
+			It("should assign increasing versions", func() {
+
+				// Given
+				history := core.NewConfigurationHistory()
+				conf := core.DiferenciaConfiguration{Primary: "http://primary", Candidate: "http://candidate"}
+
+				// When
+				history.Record(conf, core.OriginStartup, 0, "")
+				conf.Candidate = "http://candidate2"
+				history.Record(conf, core.OriginUpdate, 0, "")
+
+				// Then
+				versions := history.Versions()
+				Expect(versions).Should(HaveLen(2))
+				Expect(versions[0].Version).Should(Equal(1))
+				Expect(versions[1].Version).Should(Equal(2))
+				Expect(history.Current()).Should(Equal(2))
+			})
+
+			It("should not share slices with the recorded configuration", func() {
+
+				// Given
+				history := core.NewConfigurationHistory()
+				conf := core.DiferenciaConfiguration{IgnoreValues: []string{"/a"}}
+
+				// When
+				history.Record(conf, core.OriginStartup, 0, "")
+				conf.IgnoreValues[0] = "/b"
+
+				// Then
+				version, ok := history.Find(1)
+				Expect(ok).Should(Equal(true))
+				Expect(version.Configuration.IgnoreValues).Should(Equal([]string{"/a"}))
+			})
+
+			It("should not find unknown versions", func() {
+
+				// Given
+				history := core.NewConfigurationHistory()
+
+				// When
+				_, ok := history.Find(3)
+
+				// Then
+				Expect(ok).Should(Equal(false))
+			})
+		})
+	})
+})
@@ -29,9 +29,22 @@ func duplicate(request *http.Request) (dup *http.Request) {
 	copyTransferEncoding(request, dup)
 	copyHeaders(request, dup)
 
+	// keeps the trace of the request
+	dup = dup.WithContext(request.Context())
+
 	return
 }
 
+// readBody returns the body of the request leaving it ready to be read again
+func readBody(request *http.Request) []byte {
+	if request.Body == nil {
+		return nil
+	}
+	bodyBytes, _ := ioutil.ReadAll(request.Body)
+	request.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	return bodyBytes
+}
+
 func copyTransferEncoding(original, dup *http.Request) {
 	copy(dup.TransferEncoding, original.TransferEncoding)
 }
@@ -4,13 +4,16 @@ import (
 	"bufio"
 	"bytes"
 	jsonenc "encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/lordofthejars/diferencia/difference/header"
@@ -19,7 +22,10 @@ import (
 	"github.com/lordofthejars/diferencia/difference/json"
 	"github.com/lordofthejars/diferencia/exporter"
 	"github.com/lordofthejars/diferencia/metrics"
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/lordofthejars/diferencia/redact"
+	"github.com/lordofthejars/diferencia/snapshot"
+	"github.com/lordofthejars/diferencia/tracing"
+	"github.com/lordofthejars/diferencia/verdict"
 
 	"github.com/sirupsen/logrus"
 )
@@ -54,15 +60,22 @@ func NewDifference(difference string) (Difference, error) {
 	return -1, fmt.Errorf("Cannot find %s difference mode", difference)
 }
 
-// Config object
-var Config *DiferenciaConfiguration
-
-// HttpClient interface to make requests with changed URL
-var HttpClient Client = &HTTPClient{
-	config: Config,
+// MarshalText serializes difference mode using its name
+func (difference Difference) MarshalText() ([]byte, error) {
+	return []byte(difference.String()), nil
 }
 
-var prometheusCounter *prometheus.CounterVec
+// UnmarshalText parses difference mode from its name
+func (difference *Difference) UnmarshalText(text []byte) error {
+	mode, err := NewDifference(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*difference = mode
+	return nil
+}
 
 const (
 	// Strict mode everything should be exactly the same
@@ -75,62 +88,103 @@ const (
 
 // DiferenciaConfiguration object
 type DiferenciaConfiguration struct {
-	Port                  int        `json:"port,omitempty"`
-	ServiceName           string     `json:"serviceName,omitempty"`
-	Primary               string     `json:"primary,omitempty"`
-	Secondary             string     `json:"secondary,omitempty"`
-	Candidate             string     `json:"candidate,omitempty"`
-	StoreResults          string     `json:"storeResults,omitempty"`
-	DifferenceMode        Difference `json:"-"`
-	NoiseDetection        bool       `json:"noiseDetection,omitempty"`
-	AllowUnsafeOperations bool       `json:"allowUnsafeOperartions,omitempty"`
-	Prometheus            bool       `json:"prometheus,omitempty"`
-	PrometheusPort        int        `json:"prometheusPort,omitempty"`
-	Headers               bool       `json:"headers,omitempty"`
-	IgnoreHeadersValues   []string   `json:"ignoreHeadersValues,omitempty"`
-	IgnoreValues          []string   `json:"ignoreValues,omitempty"`
-	IgnoreValuesFile      string     `json:"ignoreValuesFile,omitempty"`
-	InsecureSkipVerify    bool       `json:"insecureSkipVerify,omitempty"`
-	CaCert                string     `json:"caCert,omitempty"`
-	ClientCert            string     `json:"clientCert,omitempty"`
-	ClientKey             string     `json:"clientKey,omitempty"`
-	AdminPort             int        `json:"adminPort,omitempty"`
-	ForcePlainText        bool       `json:"forcePlainText,omitempty"`
-	LevenshteinPercentage int        `json:"levenshteinPercentage,omitempty"`
-	Mirroring             bool       `json:"mirroring,omitempty"`
-	ReturnResult          bool       `json:"returnResult,omitempty"`
+	Port                          int        `json:"port,omitempty"`
+	ServiceName                   string     `json:"serviceName,omitempty"`
+	Primary                       string     `json:"primary,omitempty"`
+	Secondary                     string     `json:"secondary,omitempty"`
+	Candidate                     string     `json:"candidate,omitempty"`
+	StoreResults                  string     `json:"storeResults,omitempty"`
+	StoreResultsMaxSize           int        `json:"storeResultsMaxSize,omitempty"`
+	StoreResultsMaxAge            string     `json:"storeResultsMaxAge,omitempty"`
+	StoreResultsCompress          bool       `json:"storeResultsCompress,omitempty"`
+	StoreResultsBackups           int        `json:"storeResultsBackups,omitempty"`
+	SnapshotMode                  string     `json:"snapshotMode,omitempty"`
+	SnapshotDir                   string     `json:"snapshotDir,omitempty"`
+	SnapshotMaxAge                string     `json:"snapshotMaxAge,omitempty"`
+	DifferenceMode                Difference `json:"differenceMode"`
+	NoiseDetection                bool       `json:"noiseDetection,omitempty"`
+	AllowUnsafeOperations         bool       `json:"allowUnsafeOperartions,omitempty"`
+	Prometheus                    bool       `json:"prometheus,omitempty"`
+	PrometheusPort                int        `json:"prometheusPort,omitempty"`
+	Headers                       bool       `json:"headers,omitempty"`
+	IgnoreHeadersValues           []string   `json:"ignoreHeadersValues,omitempty"`
+	IgnoreValues                  []string   `json:"ignoreValues,omitempty"`
+	IgnoreValuesFile              string     `json:"ignoreValuesFile,omitempty"`
+	InsecureSkipVerify            bool       `json:"insecureSkipVerify,omitempty"`
+	CaCert                        string     `json:"caCert,omitempty"`
+	ClientCert                    string     `json:"clientCert,omitempty"`
+	ClientKey                     string     `json:"clientKey,omitempty"`
+	AdminPort                     int        `json:"adminPort,omitempty"`
+	ForcePlainText                bool       `json:"forcePlainText,omitempty"`
+	LevenshteinPercentage         int        `json:"levenshteinPercentage,omitempty"`
+	Mirroring                     bool       `json:"mirroring,omitempty"`
+	ReturnResult                  bool       `json:"returnResult,omitempty"`
+	AdminTokensFile               string     `json:"adminTokensFile,omitempty"`
+	AdminBasicAuthFile            string     `json:"adminBasicAuthFile,omitempty"`
+	AdminCert                     string     `json:"adminCert,omitempty"`
+	AdminKey                      string     `json:"adminKey,omitempty"`
+	AdminClientCa                 string     `json:"adminClientCa,omitempty"`
+	AdminClientCertRoles          []string   `json:"adminClientCertRoles,omitempty"`
+	AdminAuditLog                 string     `json:"adminAuditLog,omitempty"`
+	AdminInsecure                 bool       `json:"adminInsecure,omitempty"`
+	StatsStore                    string     `json:"statsStore,omitempty"`
+	ErrorDetailsSampling          string     `json:"errorDetailsSampling,omitempty"`
+	ErrorDetailsEndpoint          int        `json:"errorDetailsEndpoint,omitempty"`
+	ErrorDetailsTotal             int        `json:"errorDetailsTotal,omitempty"`
+	ErrorDetailsMaxSize           int        `json:"errorDetailsMaxSize,omitempty"`
+	RouteTemplates                []string   `json:"routeTemplates,omitempty"`
+	InferRouteTemplates           bool       `json:"inferRouteTemplates,omitempty"`
+	TracingEndpoint               string     `json:"tracingEndpoint,omitempty"`
+	Sinks                         []string   `json:"sinks,omitempty"`
+	WebhookSecret                 string     `json:"-"`
+	WebhookBatchSize              int        `json:"webhookBatchSize,omitempty"`
+	WebhookBatchInterval          string     `json:"webhookBatchInterval,omitempty"`
+	WebhookMaxRetries             int        `json:"webhookMaxRetries,omitempty"`
+	WebhookRateLimit              float64    `json:"webhookRateLimit,omitempty"`
+	RedactHeaders                 []string   `json:"redactHeaders,omitempty"`
+	RedactPointers                []string   `json:"redactPointers,omitempty"`
+	RedactPatterns                []string   `json:"redactPatterns,omitempty"`
+	RedactMode                    string     `json:"redactMode,omitempty"`
+	VerdictMaxRegressionRate      float64    `json:"verdictMaxRegressionRate,omitempty"`
+	VerdictMaxRouteRegressionRate float64    `json:"verdictMaxRouteRegressionRate,omitempty"`
+	VerdictMinSamples             int        `json:"verdictMinSamples,omitempty"`
+	VerdictMaxLatencyRatio        float64    `json:"verdictMaxLatencyRatio,omitempty"`
+	VerdictMinConfidence          float64    `json:"verdictMinConfidence,omitempty"`
+	LatencyBudget                 string     `json:"latencyBudget,omitempty"`
+	LatencyBudgetRatio            float64    `json:"latencyBudgetRatio,omitempty"`
+	StatusEquivalences            []string   `json:"statusEquivalences,omitempty"`
 }
 
 // UpdateConfiguration with configured params
 func (conf *DiferenciaConfiguration) UpdateConfiguration(updateConfig DiferenciaConfigurationUpdate) error {
 
+	updated := conf.clone()
+
 	if updateConfig.isReturnResultSet() {
 		returnResult, err := updateConfig.getReturnResult()
 		if err != nil {
 			return err
 		}
-		conf.ReturnResult = returnResult
+		updated.ReturnResult = returnResult
 	}
 
 	if updateConfig.isServiceNameSet() {
-		conf.SetServiceName(updateConfig.ServiceName)
-		prometheusCounter = metrics.RegisterNumberOfRegressions(Config.ServiceName)
+		updated.SetServiceName(updateConfig.ServiceName)
 	}
 
 	if updateConfig.isPrimarySet() {
-		conf.Primary = updateConfig.Primary
+		updated.Primary = updateConfig.Primary
 	}
 
 	if updateConfig.isSecondarySet() {
-		conf.Secondary = updateConfig.Secondary
+		updated.Secondary = updateConfig.Secondary
 	}
 
 	if updateConfig.isCandidateSet() {
-		conf.Candidate = updateConfig.Candidate
+		updated.Candidate = updateConfig.Candidate
 		// Updates service name for new candidate in case of service name not set
 		if !updateConfig.isServiceNameSet() {
-			conf.SetServiceName(updateConfig.ServiceName)
-			prometheusCounter = metrics.RegisterNumberOfRegressions(Config.ServiceName)
+			updated.SetServiceName("")
 		}
 	}
 
@@ -141,7 +195,7 @@ func (conf *DiferenciaConfiguration) UpdateConfiguration(updateConfig Diferencia
 			return err
 		}
 
-		conf.DifferenceMode = mode
+		updated.DifferenceMode = mode
 	}
 
 	if updateConfig.isNoiseDetectionSet() {
@@ -151,13 +205,146 @@ func (conf *DiferenciaConfiguration) UpdateConfiguration(updateConfig Diferencia
 			return err
 		}
 
-		conf.NoiseDetection = noise
+		updated.NoiseDetection = noise
+
+	}
+
+	return conf.apply(updated)
+}
+
+// PatchConfiguration merges the given JSON document into the configuration.
+// Only fields present in the document are changed, and the resulting configuration is validated as a whole.
+func (conf *DiferenciaConfiguration) PatchConfiguration(patch []byte) error {
+
+	var fields map[string]jsonenc.RawMessage
+	if err := jsonenc.Unmarshal(patch, &fields); err != nil {
+		return &ValidationError{Problems: []string{fmt.Sprintf("Configuration patch is not a valid JSON object. %s", err.Error())}}
+	}
+
+	updated := conf.clone()
+	if err := jsonenc.Unmarshal(patch, &updated); err != nil {
+		return &ValidationError{Problems: []string{err.Error()}}
+	}
+
+	_, serviceNameSet := fields["serviceName"]
+	if updated.Candidate != conf.Candidate && !serviceNameSet {
+		// Updates service name for new candidate in case of service name not set
+		updated.SetServiceName("")
+	}
+
+	return conf.apply(updated)
+}
+
+// apply replaces current configuration with updated one if the later is valid
+func (conf *DiferenciaConfiguration) apply(updated DiferenciaConfiguration) error {
+
+	if err := updated.Validate(); err != nil {
+		return err
+	}
 
+	if err := conf.validateRuntimeChange(updated); err != nil {
+		return err
 	}
 
+	// Proxies rebuild what depends on configuration before next comparison
+	*conf = updated
+
 	return nil
 }
 
+func (conf DiferenciaConfiguration) redactionRules() redact.Rules {
+	return redact.Rules{
+		Headers:  conf.RedactHeaders,
+		Pointers: conf.RedactPointers,
+		Patterns: conf.RedactPatterns,
+		Mode:     conf.RedactMode,
+	}
+}
+
+func (conf DiferenciaConfiguration) verdictRules() verdict.Rules {
+	return verdict.Rules{
+		MaxRegressionRate:      conf.VerdictMaxRegressionRate,
+		MaxRouteRegressionRate: conf.VerdictMaxRouteRegressionRate,
+		MinSamples:             conf.VerdictMinSamples,
+		MaxLatencyRatio:        conf.VerdictMaxLatencyRatio,
+		MinConfidence:          conf.VerdictMinConfidence,
+	}
+}
+
+// isSlow checks if candidate exceeds the latency budget, that is it takes longer than primary plus LatencyBudget
+// or longer than primary multiplied by LatencyBudgetRatio. Zero values disable each budget.
+func (conf DiferenciaConfiguration) isSlow(primary, candidate time.Duration) bool {
+	// Validated before
+	budget, _ := time.ParseDuration(conf.LatencyBudget)
+	if budget > 0 && candidate-primary > budget {
+		return true
+	}
+	return conf.LatencyBudgetRatio > 0 && primary > 0 && float64(candidate)/float64(primary) > conf.LatencyBudgetRatio
+}
+
+func (conf DiferenciaConfiguration) rotationPolicy() exporter.RotationPolicy {
+	// Validated before
+	maxAge, _ := time.ParseDuration(conf.StoreResultsMaxAge)
+	return exporter.RotationPolicy{
+		MaxSize:    int64(conf.StoreResultsMaxSize) * 1024 * 1024,
+		MaxAge:     maxAge,
+		Compress:   conf.StoreResultsCompress,
+		MaxBackups: conf.StoreResultsBackups,
+	}
+}
+
+func (conf DiferenciaConfiguration) webhookOptions() exporter.WebhookOptions {
+	// Validated before
+	batchInterval, _ := time.ParseDuration(conf.WebhookBatchInterval)
+	secret := conf.WebhookSecret
+	if len(secret) == 0 {
+		secret = os.Getenv(exporter.WebhookSecretEnv)
+	}
+	return exporter.WebhookOptions{
+		Secret:        secret,
+		BatchSize:     conf.WebhookBatchSize,
+		BatchInterval: batchInterval,
+		MaxRetries:    conf.WebhookMaxRetries,
+		RateLimit:     conf.WebhookRateLimit,
+	}
+}
+
+func (conf DiferenciaConfiguration) errorSampling() exporter.ErrorSampling {
+	return exporter.ErrorSampling{
+		Strategy:       conf.ErrorDetailsSampling,
+		MaxPerEndpoint: conf.ErrorDetailsEndpoint,
+		MaxTotal:       conf.ErrorDetailsTotal,
+		MaxSize:        conf.ErrorDetailsMaxSize,
+	}
+}
+
+// clone returns a deep copy of the configuration so it can be modified without side effects
+func (conf DiferenciaConfiguration) clone() DiferenciaConfiguration {
+	cloned := conf
+	cloned.IgnoreHeadersValues = cloneStrings(conf.IgnoreHeadersValues)
+	cloned.IgnoreValues = cloneStrings(conf.IgnoreValues)
+	cloned.AdminClientCertRoles = cloneStrings(conf.AdminClientCertRoles)
+	cloned.RouteTemplates = cloneStrings(conf.RouteTemplates)
+	cloned.Sinks = cloneStrings(conf.Sinks)
+	cloned.RedactHeaders = cloneStrings(conf.RedactHeaders)
+	cloned.RedactPointers = cloneStrings(conf.RedactPointers)
+	cloned.RedactPatterns = cloneStrings(conf.RedactPatterns)
+	cloned.StatusEquivalences = cloneStrings(conf.StatusEquivalences)
+
+	return cloned
+}
+
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+
+	cloned := make([]string, len(values))
+	copy(cloned, values)
+
+	return cloned
+}
+
 func (conf DiferenciaConfiguration) GetServiceName() string {
 	return conf.ServiceName
 }
@@ -166,8 +353,12 @@ func (conf DiferenciaConfiguration) GetServiceName() string {
 func (conf *DiferenciaConfiguration) SetServiceName(serviceName string) {
 
 	if len(serviceName) == 0 {
-		candidateURL, _ := url.Parse(conf.Candidate)
-		conf.ServiceName = candidateURL.Hostname()
+		candidateURL, err := url.Parse(conf.Candidate)
+		if err == nil {
+			conf.ServiceName = candidateURL.Hostname()
+		}
+	} else {
+		conf.ServiceName = serviceName
 	}
 
 }
@@ -177,6 +368,26 @@ func (conf DiferenciaConfiguration) IsStoreResultsSet() bool {
 	return len(conf.StoreResults) > 0
 }
 
+// IsStatsStoreSet in configuration object
+func (conf DiferenciaConfiguration) IsStatsStoreSet() bool {
+	return len(conf.StatsStore) > 0
+}
+
+// IsSnapshotModeSet in configuration object
+func (conf DiferenciaConfiguration) IsSnapshotModeSet() bool {
+	return len(conf.SnapshotMode) > 0
+}
+
+// IsSnapshotCompareMode means that primary is not called and its recorded responses are used instead
+func (conf DiferenciaConfiguration) IsSnapshotCompareMode() bool {
+	return conf.SnapshotMode == snapshot.CompareMode
+}
+
+// IsTracingEndpointSet in configuration object
+func (conf DiferenciaConfiguration) IsTracingEndpointSet() bool {
+	return len(conf.TracingEndpoint) > 0
+}
+
 // IsIgnoreValuesSet in configuration object
 func (conf DiferenciaConfiguration) IsIgnoreValuesSet() bool {
 	return conf.IgnoreValues != nil && len(conf.IgnoreValues) > 0
@@ -204,6 +415,13 @@ func (conf DiferenciaConfiguration) Print() {
 	fmt.Printf("Difference Mode: %s\n", conf.DifferenceMode.String())
 	fmt.Printf("Noise Detection: %t\n", conf.NoiseDetection)
 	fmt.Printf("Store Results: %s\n", conf.StoreResults)
+	fmt.Printf("Store Results Max Size: %d MB\n", conf.StoreResultsMaxSize)
+	fmt.Printf("Store Results Max Age: %s\n", conf.StoreResultsMaxAge)
+	fmt.Printf("Store Results Compress: %t\n", conf.StoreResultsCompress)
+	fmt.Printf("Store Results Backups: %d\n", conf.StoreResultsBackups)
+	fmt.Printf("Snapshot Mode: %s\n", conf.SnapshotMode)
+	fmt.Printf("Snapshot Dir: %s\n", conf.SnapshotDir)
+	fmt.Printf("Snapshot Max Age: %s\n", conf.SnapshotMaxAge)
 	fmt.Printf("Ignore Values of: %v\n", conf.IgnoreValues)
 	fmt.Printf("Ignore Values File: %s\n", conf.IgnoreValuesFile)
 	fmt.Printf("Headers: %t\n", conf.Headers)
@@ -218,6 +436,39 @@ func (conf DiferenciaConfiguration) Print() {
 	fmt.Printf("Force Plain Text: %t\n", conf.ForcePlainText)
 	fmt.Printf("Mirroring: %t\n", conf.Mirroring)
 	fmt.Printf("Return Result: %t\n", conf.ReturnResult)
+	fmt.Printf("Admin Tokens File: %s\n", conf.AdminTokensFile)
+	fmt.Printf("Admin Basic Auth File: %s\n", conf.AdminBasicAuthFile)
+	fmt.Printf("Admin Cert Path: %s\n", conf.AdminCert)
+	fmt.Printf("Admin Key Path: %s\n", conf.AdminKey)
+	fmt.Printf("Admin Client Ca Path: %s\n", conf.AdminClientCa)
+	fmt.Printf("Admin Client Cert Roles: %v\n", conf.AdminClientCertRoles)
+	fmt.Printf("Admin Audit Log: %s\n", conf.AdminAuditLog)
+	fmt.Printf("Admin Insecure: %t\n", conf.AdminInsecure)
+	fmt.Printf("Stats Store: %s\n", conf.StatsStore)
+	fmt.Printf("Error Details Sampling: %s\n", conf.ErrorDetailsSampling)
+	fmt.Printf("Error Details by Endpoint: %d\n", conf.ErrorDetailsEndpoint)
+	fmt.Printf("Error Details Total: %d\n", conf.ErrorDetailsTotal)
+	fmt.Printf("Error Details Max Size: %d\n", conf.ErrorDetailsMaxSize)
+	fmt.Printf("Route Templates: %v\n", conf.RouteTemplates)
+	fmt.Printf("Infer Route Templates: %t\n", conf.InferRouteTemplates)
+	fmt.Printf("Tracing Endpoint: %s\n", conf.TracingEndpoint)
+	fmt.Printf("Sinks: %v\n", conf.Sinks)
+	fmt.Printf("Webhook Batch Size: %d\n", conf.WebhookBatchSize)
+	fmt.Printf("Webhook Batch Interval: %s\n", conf.WebhookBatchInterval)
+	fmt.Printf("Webhook Max Retries: %d\n", conf.WebhookMaxRetries)
+	fmt.Printf("Webhook Rate Limit: %.2f\n", conf.WebhookRateLimit)
+	fmt.Printf("Redact Headers: %v\n", conf.RedactHeaders)
+	fmt.Printf("Redact Pointers: %v\n", conf.RedactPointers)
+	fmt.Printf("Redact Patterns: %v\n", conf.RedactPatterns)
+	fmt.Printf("Redact Mode: %s\n", conf.RedactMode)
+	fmt.Printf("Verdict Max Regression Rate: %.2f%%\n", conf.VerdictMaxRegressionRate)
+	fmt.Printf("Verdict Max Route Regression Rate: %.2f%%\n", conf.VerdictMaxRouteRegressionRate)
+	fmt.Printf("Verdict Min Samples: %d\n", conf.VerdictMinSamples)
+	fmt.Printf("Verdict Max Latency Ratio: %.2f\n", conf.VerdictMaxLatencyRatio)
+	fmt.Printf("Verdict Min Confidence: %.2f%%\n", conf.VerdictMinConfidence)
+	fmt.Printf("Latency Budget: %s\n", conf.LatencyBudget)
+	fmt.Printf("Latency Budget Ratio: %.2f\n", conf.LatencyBudgetRatio)
+	fmt.Printf("Status Equivalences: %v\n", conf.StatusEquivalences)
 }
 
 type DiferenciaError struct {
@@ -243,37 +494,116 @@ func (c Communicationcontent) isEmpty() bool {
 // Result struct
 type Result struct {
 	EqualContent         bool
+	Slow                 bool // candidate exceeds the latency budget, it does not change EqualContent
 	PrimaryElapsedTime   time.Duration
 	CandidateElapsedTime time.Duration
+	PrimaryStatus        int
+	CandidateStatus      int
+	PrimaryFailure       string // type of error connecting to primary (ie timeout), empty if it responded
+	CandidateFailure     string // type of error connecting to candidate (ie timeout), empty if it responded
 	Diff                 DifferenceDescription
 }
 
 // DifferenceDescription offers the description of the differences
 type DifferenceDescription struct {
-	HeadersDiff string `json:"headersDiff,omitempty"`
-	BodyDiff    string `json:"bodyDiff,omitempty"`
-	StatusDiff  string `json:"statusDiff,omitempty"`
+	HeadersDiff   string `json:"headersDiff,omitempty"`
+	BodyDiff      string `json:"bodyDiff,omitempty"`
+	StatusDiff    string `json:"statusDiff,omitempty"`
+	TransportDiff string `json:"transportDiff,omitempty"` // status code or error type of primary and candidate when any could not be called
+}
+
+// String describes each difference in its own section
+func (d DifferenceDescription) String() string {
+	var description []string
+	if len(d.TransportDiff) > 0 {
+		description = append(description, "Transport:\n"+d.TransportDiff)
+	}
+	if len(d.StatusDiff) > 0 {
+		description = append(description, "Status:\n"+d.StatusDiff)
+	}
+	if len(d.HeadersDiff) > 0 {
+		description = append(description, "Headers:\n"+d.HeadersDiff)
+	}
+	if len(d.BodyDiff) > 0 {
+		description = append(description, "Body:\n"+d.BodyDiff)
+	}
+	return strings.Join(description, "\n")
+}
+
+// redact removes sensitive data of the differences
+func (d DifferenceDescription) redact(redactor *redact.Redactor) DifferenceDescription {
+	return DifferenceDescription{
+		HeadersDiff:   redactor.HeadersDiff(d.HeadersDiff),
+		BodyDiff:      redactor.Text(d.BodyDiff),
+		StatusDiff:    d.StatusDiff,
+		TransportDiff: d.TransportDiff,
+	}
+}
+
+// redactError returns an error with the message of err without sensitive data
+func (p *Proxy) redactError(err error) error {
+	return errors.New(p.redactor.Text(err.Error()))
 }
 
 // MarshallJson translate object to byte[]
 func (r Result) MarshallJson() ([]byte, error) {
 	return jsonenc.Marshal(struct {
 		Result                   bool
+		Slow                     bool
+		PrimaryFailure           string `json:",omitempty"`
+		CandidateFailure         string `json:",omitempty"`
 		PrimaryElapsedTimeNano   int64
 		CandidateElapsedTimeNano int64
 		Description              *DifferenceDescription `json:"description,omitempty"`
 	}{
 		Result:                   r.EqualContent,
+		Slow:                     r.Slow,
+		PrimaryFailure:           r.PrimaryFailure,
+		CandidateFailure:         r.CandidateFailure,
 		PrimaryElapsedTimeNano:   r.PrimaryElapsedTime.Nanoseconds(),
 		CandidateElapsedTimeNano: r.CandidateElapsedTime.Nanoseconds(),
 		Description:              &r.Diff,
 	})
 }
 
-func Diferencia(r *http.Request) (Result, Communicationcontent, error) {
+// Diferencia sends the request to primary, candidate and secondary of conf and compares their responses using client. Each call creates a trace.
+// It creates a Proxy for this request only, so use a Proxy to compare several requests sharing stats, snapshots or interaction log.
+func Diferencia(r *http.Request, conf DiferenciaConfiguration, client Client) (Result, Communicationcontent, error) {
+	p, err := NewProxyWithClient(conf, client)
+	if err != nil {
+		return Result{}, Communicationcontent{}, err
+	}
+	defer p.Close()
+
+	return p.Compare(r)
+}
+
+// compare sends the request to all upstreams and compares their responses inside a trace
+func (p *Proxy) compare(r *http.Request) (Result, Communicationcontent, error) {
+
+	p.refresh()
+
+	// Spans leave diferencia, so route and path are redacted
+	r, span := tracing.StartRequest(p.tracer, r, p.redactor.Text(p.routes.Template(r.URL.Path)), p.redactor.Text(r.URL.Path), p.config.Candidate)
+	defer span.End()
+
+	result, content, err := p.diferencia(r)
+	if err != nil {
+		tracing.Failed(span, p.redactError(err))
+	} else {
+		tracing.Compared(span, result.EqualContent, result.Diff.StatusDiff, result.Diff.HeadersDiff, result.Diff.BodyDiff)
+	}
+
+	return result, content, err
+}
+
+func (p *Proxy) diferencia(r *http.Request) (Result, Communicationcontent, error) {
 
-	if !Config.AllowUnsafeOperations && !isSafeOperation(r.Method) {
-		if !Config.Mirroring {
+	labels := metrics.Labels{Service: p.config.ServiceName, Candidate: p.config.Candidate, Method: r.Method, Route: p.routes.Template(r.URL.Path)}
+
+	if !p.config.AllowUnsafeOperations && !isSafeOperation(r.Method) {
+		if !p.config.Mirroring {
+			p.metrics.Skipped(labels, "unsafe_method")
 			logrus.Debugf("Unsafe operations are not allowed and %s method has been received", r.Method)
 			return Result{EqualContent: false}, Communicationcontent{}, &DiferenciaError{http.StatusMethodNotAllowed, fmt.Sprintf("Unsafe operations are not allowed and %s method has been received", r.Method)}
 		} else {
@@ -281,94 +611,142 @@ func Diferencia(r *http.Request) (Result, Communicationcontent, error) {
 		}
 	}
 
-	logrus.Debugf("URL %s is going to be processed", r.URL.String())
+	logrus.Debugf("URL %s is going to be processed", p.redactor.Text(r.URL.String()))
 
 	// TODO it can be parallelized
 	// Get request from primary
-	primaryFullURL := CreateUrl(*r.URL, Config.Primary)
-	logrus.Debugf("Forwarding call to %s", primaryFullURL)
-	primaryStartTime := time.Now()
-	primaryBodyContent, primaryStatus, primaryHeader, cookies, err := getContent(r, primaryFullURL)
-	primaryElapsedDuration := time.Now().Sub(primaryStartTime)
-	if err != nil {
-		logrus.Errorf("Error while connecting to Primary site (%s) with %s", primaryFullURL, err.Error())
-		return Result{EqualContent: false}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, &DiferenciaError{http.StatusServiceUnavailable, fmt.Sprintf("Error while connecting to Primary site (%s) with %s", primaryFullURL, err.Error())}
+	primaryFullURL := upstreamURL(r, p.config.Primary)
+	logrus.Debugf("Forwarding call to %s", p.redactor.Text(primaryFullURL))
+	primaryBodyContent, primaryStatus, primaryHeader, cookies, primaryElapsedDuration, primaryErr := p.callUpstream(r, labels, metrics.Primary, primaryFullURL, p.config.IsSnapshotCompareMode())
+	if de, ok := primaryErr.(*DiferenciaError); ok {
+		return Result{EqualContent: false}, Communicationcontent{}, de
+	}
+	if primaryErr != nil {
+		p.metrics.UpstreamFailed(labels, metrics.Primary, upstreamErrorType(primaryErr))
+		logrus.Errorf("Error while connecting to Primary site (%s) with %s", p.redactor.Text(primaryFullURL), p.redactor.Text(primaryErr.Error()))
 	}
 
-	// Get candidate
-	candidateFullURL := CreateUrl(*r.URL, Config.Candidate)
-	logrus.Debugf("Forwarding call to %s", candidateFullURL)
-	candidateStartTime := time.Now()
-	candidateBodyContent, candidateStatus, candidateHeader, _, err := getContent(r, candidateFullURL)
-	candidateElapsedDuration := time.Now().Sub(candidateStartTime)
-	if err != nil {
-		logrus.Errorf("Error while connecting to Candidate site (%s) with %s", candidateFullURL, err.Error())
-		return Result{EqualContent: false}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, &DiferenciaError{http.StatusServiceUnavailable, fmt.Sprintf("Error while connecting to Candidate site (%s) with %s", candidateFullURL, err.Error())}
+	// Get candidate, even if primary failed, as failing the same way is a match
+	candidateFullURL := CreateUrl(*r.URL, p.config.Candidate)
+	logrus.Debugf("Forwarding call to %s", p.redactor.Text(candidateFullURL))
+	candidateBodyContent, candidateStatus, candidateHeader, candidateCookies, candidateElapsedDuration, candidateErr := p.callUpstream(r, labels, metrics.Candidate, candidateFullURL, false)
+	if candidateErr != nil {
+		p.metrics.UpstreamFailed(labels, metrics.Candidate, upstreamErrorType(candidateErr))
+		logrus.Errorf("Error while connecting to Candidate site (%s) with %s", p.redactor.Text(candidateFullURL), p.redactor.Text(candidateErr.Error()))
 	}
 
+	primaryCommunication := Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}
+
+	// Responses as received, before removing noise, to store the interaction
+	primaryInteraction := exporter.CreateInteraction(primaryFullURL, primaryBodyContent, primaryStatus, primaryHeader, cookies, primaryElapsedDuration)
+	candidateInteraction := exporter.CreateInteraction(candidateFullURL, candidateBodyContent, candidateStatus, candidateHeader, candidateCookies, candidateElapsedDuration)
+
+	if primaryErr != nil || candidateErr != nil {
+		if primaryErr != nil {
+			primaryInteraction.Error = upstreamErrorType(primaryErr)
+		}
+		if candidateErr != nil {
+			candidateInteraction.Error = upstreamErrorType(candidateErr)
+		}
+		result := p.compareFailures(r, labels, primaryInteraction, candidateInteraction)
+		return result, primaryCommunication, nil
+	}
+
+	p.metrics.UpstreamCalled(labels, metrics.Primary, primaryElapsedDuration, len(primaryBodyContent))
+	p.metrics.UpstreamCalled(labels, metrics.Candidate, candidateElapsedDuration, len(candidateBodyContent))
+	p.metrics.LatencyRatio(labels, primaryElapsedDuration, candidateElapsedDuration)
+
 	var result bool
 
-	var secondaryFullURL string
-	var secondaryBodyContent []byte
-	var secondaryStatus int
-	if Config.NoiseDetection {
+	var secondaryInteraction *exporter.Interaction
+
+	if p.config.NoiseDetection {
 		// Get secondary to do the noise cancellation
-		secondaryFullURL := CreateUrl(*r.URL, Config.Secondary)
-		logrus.Debugf("Forwarding call to %s", secondaryFullURL)
-		secondaryBodyContent, secondaryStatus, _, _, err := getContent(r, secondaryFullURL)
+		secondaryFullURL := upstreamURL(r, p.config.Secondary)
+		logrus.Debugf("Forwarding call to %s", p.redactor.Text(secondaryFullURL))
+		// Stored secondary is used when comparing snapshots without a secondary URL
+		secondaryBodyContent, secondaryStatus, secondaryHeader, secondaryCookies, secondaryElapsedDuration, err := p.callUpstream(r, labels, metrics.Secondary, secondaryFullURL, p.config.IsSnapshotCompareMode() && len(p.config.Secondary) == 0)
+		if de, ok := err.(*DiferenciaError); ok {
+			return Result{EqualContent: false}, Communicationcontent{}, de
+		}
 		if err != nil {
-			logrus.Errorf("Error while connecting to Secondary site (%s) with error %s", candidateFullURL, err.Error())
-			return Result{EqualContent: false}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, &DiferenciaError{http.StatusServiceUnavailable, fmt.Sprintf("Error while connecting to Secondary site (%s) with error %s", candidateFullURL, err.Error())}
+			p.metrics.UpstreamFailed(labels, metrics.Secondary, upstreamErrorType(err))
+			logrus.Errorf("Error while connecting to Secondary site (%s) with error %s", p.redactor.Text(secondaryFullURL), p.redactor.Text(err.Error()))
+			return Result{EqualContent: false}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, &DiferenciaError{http.StatusServiceUnavailable, fmt.Sprintf("Error while connecting to Secondary site (%s) with error %s", p.redactor.Text(secondaryFullURL), p.redactor.Text(err.Error()))}
 		}
+		secondary := exporter.CreateInteraction(secondaryFullURL, secondaryBodyContent, secondaryStatus, secondaryHeader, secondaryCookies, secondaryElapsedDuration)
+		secondaryInteraction = &secondary
+		p.metrics.UpstreamCalled(labels, metrics.Secondary, secondaryElapsedDuration, len(secondaryBodyContent))
+		_, noiseSpan := tracing.Start(r, tracing.NoiseDetection)
 		// If status code is equal then we detect noise and and remove from primary and candidate
 		// What to do in case of two identical status code but no body content (404) might be still valid since you are testing that nothing is there
 		if primaryStatus == secondaryStatus {
 
-			contentType := primaryHeader.Get("Content-Type")
 			var err error
-			switch {
-			case strings.HasPrefix(contentType, "application/json"):
-				primaryBodyContent, candidateBodyContent, err = noiseCancellationJson(primaryBodyContent, secondaryBodyContent, candidateBodyContent)
-			case strings.HasPrefix(contentType, "text/plain"):
-				primaryBodyContent, candidateBodyContent = noiseCancellationText(primaryBodyContent, secondaryBodyContent, candidateBodyContent)
-			default:
-				{
-					if Config.ForcePlainText {
-						primaryBodyContent, candidateBodyContent = noiseCancellationText(primaryBodyContent, secondaryBodyContent, candidateBodyContent)
-					} else {
-						primaryBodyContent, candidateBodyContent, err = noiseCancellationJson(primaryBodyContent, secondaryBodyContent, candidateBodyContent)
-					}
-				}
-			}
+			primaryBodyContent, candidateBodyContent, err = p.config.removeNoise(primaryHeader, primaryBodyContent, secondaryBodyContent, candidateBodyContent)
 
 			if err != nil {
-				logrus.WithError(err).Errorf("Error detecting noise between %s and %s.", primaryFullURL, secondaryFullURL)
-				return Result{EqualContent: false}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, &DiferenciaError{http.StatusBadRequest, fmt.Sprintf("Error detecting noise between %s and %s. (%s)", primaryFullURL, secondaryFullURL, err.Error())}
+				p.metrics.NoiseDetectionFailed(labels, "invalid_content")
+				tracing.Failed(noiseSpan, err)
+				noiseSpan.End()
+				logrus.WithError(p.redactError(err)).Errorf("Error detecting noise between %s and %s.", p.redactor.Text(primaryFullURL), p.redactor.Text(secondaryFullURL))
+				return Result{EqualContent: false}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, &DiferenciaError{http.StatusBadRequest, fmt.Sprintf("Error detecting noise between %s and %s. (%s)", p.redactor.Text(primaryFullURL), p.redactor.Text(secondaryFullURL), p.redactor.Text(err.Error()))}
 			}
 
 		} else {
-			logrus.Errorf("Status code between %s(%d) and %s(%d) are different", primaryFullURL, primaryStatus, secondaryFullURL, secondaryStatus)
-			return Result{EqualContent: false}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, &DiferenciaError{http.StatusBadRequest, fmt.Sprintf("Status code between %s(%d) and %s(%d) are different", primaryFullURL, primaryStatus, secondaryFullURL, secondaryStatus)}
+			p.metrics.NoiseDetectionFailed(labels, "status_mismatch")
+			logrus.Errorf("Status code between %s(%d) and %s(%d) are different", p.redactor.Text(primaryFullURL), primaryStatus, p.redactor.Text(secondaryFullURL), secondaryStatus)
+			err := &DiferenciaError{http.StatusBadRequest, fmt.Sprintf("Status code between %s(%d) and %s(%d) are different", p.redactor.Text(primaryFullURL), primaryStatus, p.redactor.Text(secondaryFullURL), secondaryStatus)}
+			tracing.Failed(noiseSpan, err)
+			noiseSpan.End()
+			return Result{EqualContent: false}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, err
 		}
+		noiseSpan.End()
 	}
 
-	result, output := compareResult(candidateBodyContent, primaryBodyContent, candidateStatus, primaryStatus, candidateHeader, primaryHeader)
-
-	if Config.IsStoreResultsSet() {
-		primary := exporter.CreateInteraction(primaryFullURL, primaryBodyContent, primaryStatus)
-		candidate := exporter.CreateInteraction(candidateFullURL, candidateBodyContent, candidateStatus)
-		var secondary exporter.Interaction
+	_, compareSpan := tracing.Start(r, tracing.Comparison)
+	statusEquivalent := p.statuses.Equivalent(r.Method, labels.Route, primaryStatus, candidateStatus)
+	result, output := p.config.compareResult(candidateBodyContent, primaryBodyContent, candidateStatus, primaryStatus, statusEquivalent, candidateHeader, primaryHeader)
+	// Differences leave diferencia from now on, so they are redacted
+	if len(output.BodyDiff) > 0 && p.redactor.HasPointers() {
+		// Body diff shows values of both documents, so it is done again with documents already redacted
+		output.BodyDiff = json.Diff([]byte(p.redactor.Body(string(candidateBodyContent))), []byte(p.redactor.Body(string(primaryBodyContent))))
+	}
+	output = output.redact(p.redactor)
+	tracing.Compared(compareSpan, result, output.StatusDiff, output.HeadersDiff, output.BodyDiff)
+	compareSpan.End()
+	p.metrics.Compared(labels, result)
+
+	slow := p.config.isSlow(primaryElapsedDuration, candidateElapsedDuration)
+	if slow {
+		p.metrics.Slow(labels)
+		logrus.Debugf("Candidate %s took %s while primary took %s, exceeding the latency budget", p.redactor.Text(candidateFullURL), candidateElapsedDuration, primaryElapsedDuration)
+	}
 
-		if Config.NoiseDetection {
-			secondary = exporter.CreateInteraction(secondaryFullURL, secondaryBodyContent, secondaryStatus)
-		}
+	p.sinks.Send(exporter.Comparison{
+		Service:              p.config.ServiceName,
+		Candidate:            p.config.Candidate,
+		Method:               r.Method,
+		Route:                labels.Route,
+		URI:                  p.redactor.Text(r.URL.RequestURI()),
+		Equal:                result,
+		Slow:                 slow,
+		StatusDiff:           output.StatusDiff,
+		HeadersDiff:          output.HeadersDiff,
+		BodyDiff:             output.BodyDiff,
+		PrimaryElapsedTime:   primaryElapsedDuration,
+		CandidateElapsedTime: candidateElapsedDuration,
+		Processed:            time.Now(),
+	})
 
-		interactions := exporter.CreateInteractions(primary, &secondary, candidate, Config.DifferenceMode.String(), result)
+	if p.config.IsStoreResultsSet() {
+		request := exporter.CreateRequest(r.Method, r.URL.RequestURI(), r.Header, readBody(r))
+		interactions := exporter.CreateInteractions(request, primaryInteraction, secondaryInteraction, candidateInteraction, p.config.DifferenceMode.String(), result)
 
-		exporter.ExportToFile(Config.StoreResults, interactions)
+		p.interactions.Write(interactions.Redact(p.redactor))
 	}
 
-	logrus.Debugf("Result of comparing %s and %s is %t", primaryFullURL, candidateFullURL, result)
+	logrus.Debugf("Result of comparing %s and %s is %t", p.redactor.Text(primaryFullURL), p.redactor.Text(candidateFullURL), result)
 
 	// If it is a failure let's print the contents.
 	if !result {
@@ -377,22 +755,67 @@ func Diferencia(r *http.Request) (Result, Communicationcontent, error) {
 		logrus.Debugf("Primary Status Code: %d Candidate StatusCode: %d", primaryStatus, candidateStatus)
 		logrus.Debugf("Primary time: %s Candidate Time: %s", primaryElapsedDuration, candidateElapsedDuration)
 		logrus.Debugf("Primary Content:")
-		logrus.Debugf(string(primaryBodyContent[:]))
+		logrus.Debug(p.redactor.Body(string(primaryBodyContent[:])))
 		logrus.Debugf("Candidate Content:")
-		logrus.Debugf(string(candidateBodyContent[:]))
-		if Config.Headers {
+		logrus.Debug(p.redactor.Body(string(candidateBodyContent[:])))
+		if p.config.Headers {
 			logrus.Debugf("Primary Headers:")
-			logrus.Debugf(createKeyValuePairs(primaryHeader))
+			logrus.Debug(createKeyValuePairs(p.redactor.Headers(primaryHeader)))
 			logrus.Debugf("Candidate Headers:")
-			logrus.Debugf(createKeyValuePairs(candidateHeader))
+			logrus.Debug(createKeyValuePairs(p.redactor.Headers(candidateHeader)))
 		}
 		logrus.Debugf("************************")
 	}
 
-	return Result{EqualContent: result, PrimaryElapsedTime: primaryElapsedDuration, CandidateElapsedTime: candidateElapsedDuration, Diff: output}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, nil
+	return Result{EqualContent: result, Slow: slow, PrimaryElapsedTime: primaryElapsedDuration, CandidateElapsedTime: candidateElapsedDuration,
+		PrimaryStatus: primaryStatus, CandidateStatus: candidateStatus, Diff: output}, Communicationcontent{Content: primaryBodyContent, StatusCode: primaryStatus, Header: primaryHeader, Cookies: cookies}, nil
 
 }
 
+// compareFailures compares the outcome of a request where primary, candidate or both could not be called.
+// Both failing with the same error type is a match, any other combination is a regression.
+func (p *Proxy) compareFailures(r *http.Request, labels metrics.Labels, primary, candidate exporter.Interaction) Result {
+
+	result := Result{
+		PrimaryElapsedTime:   primary.ElapsedTime,
+		CandidateElapsedTime: candidate.ElapsedTime,
+		PrimaryStatus:        primary.StatusCode,
+		CandidateStatus:      candidate.StatusCode,
+		PrimaryFailure:       primary.Error,
+		CandidateFailure:     candidate.Error,
+		EqualContent:         primary.Error == candidate.Error,
+	}
+
+	if !result.EqualContent {
+		result.Diff = DifferenceDescription{TransportDiff: fmt.Sprintf(`"transport": %s => %s`, primary.Outcome(), candidate.Outcome())}
+	}
+
+	p.metrics.Compared(labels, result.EqualContent)
+	p.sinks.Send(exporter.Comparison{
+		Service:              p.config.ServiceName,
+		Candidate:            p.config.Candidate,
+		Method:               r.Method,
+		Route:                labels.Route,
+		URI:                  p.redactor.Text(r.URL.RequestURI()),
+		Equal:                result.EqualContent,
+		TransportDiff:        result.Diff.TransportDiff,
+		PrimaryElapsedTime:   primary.ElapsedTime,
+		CandidateElapsedTime: candidate.ElapsedTime,
+		Processed:            time.Now(),
+	})
+
+	if p.config.IsStoreResultsSet() {
+		request := exporter.CreateRequest(r.Method, r.URL.RequestURI(), r.Header, readBody(r))
+		interactions := exporter.CreateInteractions(request, primary, nil, candidate, p.config.DifferenceMode.String(), result.EqualContent)
+
+		p.interactions.Write(interactions.Redact(p.redactor))
+	}
+
+	logrus.Debugf("Result of comparing failures of %s is %t. Primary: %s Candidate: %s", p.redactor.Text(r.URL.RequestURI()), result.EqualContent, primary.Outcome(), candidate.Outcome())
+
+	return result
+}
+
 func createKeyValuePairs(m http.Header) string {
 	b := new(bytes.Buffer)
 	for key, value := range m {
@@ -401,6 +824,27 @@ func createKeyValuePairs(m http.Header) string {
 	return b.String()
 }
 
+// removeNoise detected between primary and secondary contents from primary and candidate contents
+func (conf DiferenciaConfiguration) removeNoise(primaryHeader http.Header, primaryBodyContent, secondaryBodyContent, candidateBodyContent []byte) ([]byte, []byte, error) {
+
+	contentType := primaryHeader.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		return conf.noiseCancellationJson(primaryBodyContent, secondaryBodyContent, candidateBodyContent)
+	case strings.HasPrefix(contentType, "text/plain"):
+		primaryWithoutNoise, candidateWithoutNoise := noiseCancellationText(primaryBodyContent, secondaryBodyContent, candidateBodyContent)
+		return primaryWithoutNoise, candidateWithoutNoise, nil
+	default:
+		{
+			if conf.ForcePlainText {
+				primaryWithoutNoise, candidateWithoutNoise := noiseCancellationText(primaryBodyContent, secondaryBodyContent, candidateBodyContent)
+				return primaryWithoutNoise, candidateWithoutNoise, nil
+			}
+			return conf.noiseCancellationJson(primaryBodyContent, secondaryBodyContent, candidateBodyContent)
+		}
+	}
+}
+
 func noiseCancellationText(primaryBodyContent, secondaryBodyContent, candidateBodyContent []byte) ([]byte, []byte) {
 
 	noiseOperation := plain.NoiseOperation{}
@@ -412,9 +856,9 @@ func noiseCancellationText(primaryBodyContent, secondaryBodyContent, candidateBo
 
 }
 
-func noiseCancellationJson(primaryBodyContent, secondaryBodyContent, candidateBodyContent []byte) ([]byte, []byte, error) {
+func (conf DiferenciaConfiguration) noiseCancellationJson(primaryBodyContent, secondaryBodyContent, candidateBodyContent []byte) ([]byte, []byte, error) {
 	noiseOperation := json.NoiseOperation{}
-	manualNoise := manualNoiseDetection()
+	manualNoise := conf.manualNoiseDetection()
 	noiseOperation.Initialize(manualNoise)
 	err := noiseOperation.Detect(primaryBodyContent, secondaryBodyContent)
 	if err != nil {
@@ -425,21 +869,21 @@ func noiseCancellationJson(primaryBodyContent, secondaryBodyContent, candidateBo
 	return primaryWithoutNoise, candidateWithoutNoise, nil
 }
 
-func manualNoiseDetection() []string {
+func (conf DiferenciaConfiguration) manualNoiseDetection() []string {
 	var pointers []string
 
-	if Config.IsIgnoreValuesSet() {
-		for _, v := range Config.IgnoreValues {
+	if conf.IsIgnoreValuesSet() {
+		for _, v := range conf.IgnoreValues {
 			pointers = append(pointers, v)
 		}
 	}
 
-	if Config.IsIgnoreValuesFileSet() {
+	if conf.IsIgnoreValuesFileSet() {
 
-		lines, err := readLines(Config.IgnoreValuesFile)
+		lines, err := readLines(conf.IgnoreValuesFile)
 
 		if err != nil {
-			logrus.Errorf("Error reading %s that defines ignoring values. %s. Execution will continue ignoring this file.", Config.IgnoreValuesFile, err)
+			logrus.Errorf("Error reading %s that defines ignoring values. %s. Execution will continue ignoring this file.", conf.IgnoreValuesFile, err)
 			return pointers
 		}
 
@@ -467,40 +911,46 @@ func readLines(path string) ([]string, error) {
 	return lines, scanner.Err()
 }
 
-func compareResult(candidate, primary []byte, candidateStatus, primaryStatus int, candidateHeader, primaryHeader http.Header) (bool, DifferenceDescription) {
+// compareResult compares headers and body when status codes are equivalent, that is equal or equivalent by the status equivalences of the route
+func (conf DiferenciaConfiguration) compareResult(candidate, primary []byte, candidateStatus, primaryStatus int, statusEquivalent bool, candidateHeader, primaryHeader http.Header) (bool, DifferenceDescription) {
 
 	// TODO This method should be refactored to a chain of responsibility pattern
-	if primaryStatus == candidateStatus {
+	if statusEquivalent {
+		// Different status codes are kept in the differences, so stored results still show them
+		statusDiff := ""
+		if primaryStatus != candidateStatus {
+			statusDiff = fmt.Sprintf(`"status": %d => %d (equivalent)`, primaryStatus, candidateStatus)
+		}
 		headersDiff := ""
 		headerEqual := true
-		if Config.Headers {
-			headerEqual, headersDiff = header.CompareHeaders(candidateHeader, primaryHeader, Config.IgnoreHeadersValues...)
+		if conf.Headers {
+			headerEqual, headersDiff = header.CompareHeaders(candidateHeader, primaryHeader, conf.IgnoreHeadersValues...)
 		}
 		// Comparision between documents
 		contentType := primaryHeader.Get("Content-Type")
 		switch {
 		case strings.HasPrefix(contentType, "application/json"):
-			bodyEqual, bodyDiff := json.CompareDocuments(candidate, primary, Config.DifferenceMode.String())
+			bodyEqual, bodyDiff := json.CompareDocuments(candidate, primary, conf.DifferenceMode.String())
 
 			if headerEqual && bodyEqual {
 				return bodyEqual, DifferenceDescription{}
 			}
 
-			return bodyEqual && headerEqual, DifferenceDescription{HeadersDiff: headersDiff, BodyDiff: bodyDiff}
+			return bodyEqual && headerEqual, DifferenceDescription{StatusDiff: statusDiff, HeadersDiff: headersDiff, BodyDiff: bodyDiff}
 		case strings.HasPrefix(contentType, "text/plain"):
-			return compareText(candidate, primary, Config.LevenshteinPercentage), DifferenceDescription{}
+			return compareTextResult(candidate, primary, conf.LevenshteinPercentage, statusDiff)
 		default:
 			{
-				if Config.ForcePlainText {
-					return compareText(candidate, primary, Config.LevenshteinPercentage), DifferenceDescription{}
+				if conf.ForcePlainText {
+					return compareTextResult(candidate, primary, conf.LevenshteinPercentage, statusDiff)
 				}
-				bodyEqual, bodyDiff := json.CompareDocuments(candidate, primary, Config.DifferenceMode.String())
+				bodyEqual, bodyDiff := json.CompareDocuments(candidate, primary, conf.DifferenceMode.String())
 
 				if headerEqual && bodyEqual {
 					return bodyEqual, DifferenceDescription{}
 				}
 
-				return bodyEqual && headerEqual, DifferenceDescription{HeadersDiff: headersDiff, BodyDiff: bodyDiff}
+				return bodyEqual && headerEqual, DifferenceDescription{StatusDiff: statusDiff, HeadersDiff: headersDiff, BodyDiff: bodyDiff}
 			}
 		}
 	}
@@ -508,6 +958,14 @@ func compareResult(candidate, primary []byte, candidateStatus, primaryStatus int
 	return false, DifferenceDescription{StatusDiff: fmt.Sprintf(`"status": %d => %d`, primaryStatus, candidateStatus)}
 }
 
+// compareTextResult compares text bodies, keeping statusDiff of equivalent status codes if they are different
+func compareTextResult(candidate, primary []byte, levenshtein int, statusDiff string) (bool, DifferenceDescription) {
+	if compareText(candidate, primary, levenshtein) {
+		return true, DifferenceDescription{}
+	}
+	return false, DifferenceDescription{StatusDiff: statusDiff}
+}
+
 func compareText(candidate, primary []byte, levenshtein int) bool {
 	if levenshtein < 100 {
 		dif := int(plain.CalculateSimilarity(primary, candidate) * 100)
@@ -522,66 +980,98 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func diferenciaHandler(w http.ResponseWriter, r *http.Request) {
-
-	mutex.Lock()
-	defer mutex.Unlock()
+func isSafeOperation(method string) bool {
+	return method == http.MethodGet || method == http.MethodOptions || method == http.MethodHead
+}
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		logrus.Errorf("Error reading body: %v", err)
+// upstreamURL of the request. Host is empty only when comparing snapshots, where primary is not called.
+func upstreamURL(r *http.Request, host string) string {
+	if len(host) == 0 {
+		return r.URL.RequestURI()
 	}
-	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	return CreateUrl(*r.URL, host)
+}
 
-	result, primaryCommunication, err := Diferencia(r)
-	if err != nil {
-		if de, ok := err.(*DiferenciaError); ok {
-			w.WriteHeader(de.code)
-			fmt.Fprintf(w, de.message)
-		}
+// callUpstream returns the response of upstream and the time taken.
+// If recorded is true the stored snapshot is returned instead, and missing or stale snapshots are a DiferenciaError.
+// In snapshot record mode primary and secondary responses are stored.
+func (p *Proxy) callUpstream(r *http.Request, labels metrics.Labels, upstream, url string, recorded bool) ([]byte, int, http.Header, []*http.Cookie, time.Duration, error) {
 
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, err.Error())
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	if result.EqualContent {
-		if Config.Mirroring {
-			MirrorResponse(primaryCommunication, w)
-		} else {
-			if Config.ReturnResult {
-				content, _ := result.MarshallJson()
-				w.Write(content)
-			}
-			w.WriteHeader(http.StatusOK)
+	if recorded {
+		stored, err := p.snapshots.Load(upstream, r.Method, r.URL.RequestURI(), readBody(r))
+		var content []byte
+		if err == nil {
+			content, err = stored.RawContent()
 		}
-		exporter.IncrementSuccess(r.Method, r.URL.Path, result.PrimaryElapsedTime, result.CandidateElapsedTime)
-	} else {
-		// If there is a regression
-		if Config.Mirroring {
-			MirrorResponse(primaryCommunication, w)
-		} else {
-			w.WriteHeader(http.StatusPreconditionFailed)
-			if Config.ReturnResult {
-				content, _ := result.MarshallJson()
-				w.Write(content)
+		if err != nil {
+			reason := "missing_snapshot"
+			if _, stale := err.(*snapshot.StaleError); stale {
+				reason = "stale_snapshot"
+			} else if err != snapshot.ErrNotFound {
+				reason = "invalid_snapshot"
 			}
+			p.metrics.Skipped(labels, reason)
+			logrus.Warnf("Cannot use %s snapshot of %s %s. %s", upstream, r.Method, p.redactor.Text(r.URL.RequestURI()), p.redactor.Text(err.Error()))
+			return nil, 0, nil, nil, 0, &DiferenciaError{http.StatusFailedDependency, fmt.Sprintf("Cannot use %s snapshot of %s %s. %s", upstream, r.Method, p.redactor.Text(r.URL.RequestURI()), p.redactor.Text(err.Error()))}
 		}
-		if Config.Prometheus {
-			prometheusCounter.WithLabelValues(r.Method, r.URL.Path).Inc()
+		return content, stored.StatusCode, stored.Headers, stored.HTTPCookies(), stored.ElapsedTime, nil
+	}
+
+	startTime := time.Now()
+	content, status, header, cookies, err := p.getUpstreamContent(r, upstream, url)
+	elapsed := time.Now().Sub(startTime)
+
+	if err == nil && upstream != metrics.Candidate && p.config.SnapshotMode == snapshot.RecordMode {
+		uri := r.URL.RequestURI()
+		stored := snapshot.Snapshot{
+			Key:         snapshot.Key(r.Method, uri, readBody(r)),
+			Method:      r.Method,
+			URI:         uri,
+			URL:         url,
+			StatusCode:  status,
+			Headers:     header,
+			Cookies:     snapshot.Cookies(cookies),
+			ElapsedTime: elapsed,
+			Recorded:    time.Now(),
+		}
+		stored.SetContent(content)
+		if err := p.snapshots.Save(upstream, stored); err != nil {
+			logrus.Errorf("Error storing %s snapshot of %s %s. %s", upstream, r.Method, p.redactor.Text(uri), p.redactor.Text(err.Error()))
 		}
-		exporter.IncrementError(r.Method, r.URL.Path, string(body[:]), r.URL.RequestURI(), result.Diff.HeadersDiff, result.Diff.BodyDiff, result.Diff.StatusDiff, r.Header)
 	}
+
+	return content, status, header, cookies, elapsed, err
 }
 
-func isSafeOperation(method string) bool {
-	return method == http.MethodGet || method == http.MethodOptions || method == http.MethodHead
+// getUpstreamContent calls given upstream inside its own span
+func (p *Proxy) getUpstreamContent(r *http.Request, upstream, url string) ([]byte, int, http.Header, []*http.Cookie, error) {
+
+	// Traced request is a shallow copy, so it gets its own body to keep the original one for next upstreams
+	body := readBody(r)
+	traced, span := tracing.StartUpstream(r, upstream, p.redactor.Text(url))
+	defer span.End()
+	traced.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	content, status, header, cookies, err := p.getContent(traced, url)
+	if err != nil {
+		// Client errors contain the full url
+		tracing.Failed(span, p.redactError(err))
+	} else {
+		tracing.Responded(span, status, len(content))
+	}
+
+	return content, status, header, cookies, err
 }
 
-func getContent(r *http.Request, url string) ([]byte, int, http.Header, []*http.Cookie, error) {
+func (p *Proxy) getContent(r *http.Request, url string) ([]byte, int, http.Header, []*http.Cookie, error) {
 
 	newRequest := duplicate(r)
-	resp, err := HttpClient.MakeRequest(newRequest, url)
+	if newRequest.Header == nil {
+		newRequest.Header = http.Header{}
+	}
+	// Propagates W3C trace context to upstream
+	tracing.Inject(newRequest.Context(), newRequest.Header)
+	resp, err := p.client.MakeRequest(newRequest, url)
 
 	if err != nil {
 		// In case of error in service we should add as metrics as well or assume that the service itself would communicate to metrics?
@@ -595,53 +1085,73 @@ func getContent(r *http.Request, url string) ([]byte, int, http.Header, []*http.
 
 }
 
-// StartProxy server
+// StartProxy server listening on ports of configuration. It is a standalone Proxy, with admin and Prometheus endpoints in their own ports.
+// It runs until the process receives SIGINT or SIGTERM, then pending spans, stats and interactions are written.
 func StartProxy(configuration *DiferenciaConfiguration) {
 
-	finish := make(chan bool)
+	configuration.Print()
 
-	Config = configuration
-	initialize()
+	proxy, err := NewProxy(*configuration)
+	if err != nil {
+		logrus.Errorf("Error starting proxy: %s", err.Error())
+		return
+	}
+
+	// Ports and admin security cannot be changed at runtime
+	config := proxy.Configuration()
 
 	go func() {
 		// Initialize Proxy server
 		proxyMux := http.NewServeMux()
 		// Matches everything
-		proxyMux.HandleFunc("/", diferenciaHandler)
+		proxyMux.Handle("/", proxy)
 		proxyMux.HandleFunc("/healthdif", healthHandler)
-		logrus.Errorf("Error starting proxy: %s", http.ListenAndServe(":"+strconv.Itoa(Config.Port), proxyMux))
+		logrus.Errorf("Error starting proxy: %s", http.ListenAndServe(":"+strconv.Itoa(config.Port), proxyMux))
 	}()
 
 	go func() {
-		if Config.Prometheus {
+		if config.Prometheus {
 			//Initialize Prometheus endpoint
 			prometheusMux := http.NewServeMux()
-			prometheusMux.Handle("/metrics", prometheus.Handler())
-			logrus.Errorf("Error starting prometheus endpoint: %s", http.ListenAndServe(":"+strconv.Itoa(Config.PrometheusPort), prometheusMux))
+			prometheusMux.Handle("/metrics", proxy.MetricsHandler())
+			logrus.Errorf("Error starting prometheus endpoint: %s", http.ListenAndServe(":"+strconv.Itoa(config.PrometheusPort), prometheusMux))
 		}
 	}()
 
 	go func() {
 		// Initialize Admin server
-		adminMux := http.NewServeMux()
-		adminMux.HandleFunc("/configuration", adminHandler)
-		adminMux.HandleFunc("/stats", exporter.StatsHandler)
-		adminMux.HandleFunc("/dashboard/details", dashboardDetailsHandler)
-		adminMux.HandleFunc("/dashboard/", dashboardHandler)
-		logrus.Errorf("Error starting admin: %s", http.ListenAndServe(":"+strconv.Itoa(Config.AdminPort), adminMux))
-	}()
+		adminHandler, err := proxy.AdminHandler()
+		if err != nil {
+			logrus.Errorf("Error starting admin: %s", err.Error())
+			return
+		}
 
-	<-finish
-}
+		if !config.IsAdminTLSSet() {
+			logrus.Errorf("Error starting admin: %s", http.ListenAndServe(":"+strconv.Itoa(config.AdminPort), adminHandler))
+			return
+		}
+
+		tlsConfig, err := adminTLSConfig(config)
+		if err != nil {
+			logrus.Errorf("Error starting admin: %s", err.Error())
+			return
+		}
 
-func initialize() {
+		adminServer := &http.Server{
+			Addr:      ":" + strconv.Itoa(config.AdminPort),
+			Handler:   adminHandler,
+			TLSConfig: tlsConfig,
+		}
+		logrus.Errorf("Error starting admin: %s", adminServer.ListenAndServeTLS(config.AdminCert, config.AdminKey))
+	}()
 
-	// Print config object
-	Config.Print()
+	// Pending spans, stats and interactions are written before exiting
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	logrus.Info("Stopping Diferencia")
 
-	//Initialize Prometheus if required
-	if Config.Prometheus {
-		prometheusCounter = metrics.RegisterNumberOfRegressions(Config.ServiceName)
+	if err := proxy.Close(); err != nil {
+		logrus.Errorf("Error stopping proxy: %s", err.Error())
 	}
-
 }
@@ -5,21 +5,25 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/lordofthejars/diferencia/core"
+	"github.com/lordofthejars/diferencia/snapshot"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 type StubHttpClient struct {
-	header  []http.Header
-	content []string
-	status  []int
-	index   int
+	header   []http.Header
+	content  []string
+	status   []int
+	index    int
+	requests []*http.Request
 }
 
 func (httpClient *StubHttpClient) MakeRequest(r *http.Request, url string) (*http.Response, error) {
+	httpClient.requests = append(httpClient.requests, r)
 	response := &http.Response{}
 	buff := ioutil.NopCloser(strings.NewReader(httpClient.content[httpClient.index]))
 	response.Body = buff
@@ -43,13 +47,13 @@ var _ = Describe("Proxy", func() {
 				conf := &core.DiferenciaConfiguration{
 					Port:                  8080,
 					Primary:               "http://now.httpbin.org/",
+					Secondary:             "http://now.httpbin.org/",
 					Candidate:             "http://now.httpbin.org/",
 					StoreResults:          "",
 					DifferenceMode:        core.Strict,
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				updateConf := core.DiferenciaConfigurationUpdate{
 					NoiseDetection: "true",
@@ -57,11 +61,11 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				core.Config.UpdateConfiguration(updateConf)
+				conf.UpdateConfiguration(updateConf)
 
 				// Then
 
-				Expect(core.Config.NoiseDetection).Should(Equal(true))
+				Expect(conf.NoiseDetection).Should(Equal(true))
 			})
 
 			It("should update primary, secondary and candidate", func() {
@@ -79,7 +83,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				updateConf := core.DiferenciaConfigurationUpdate{
 					Primary:   "http://localhost",
@@ -89,14 +92,14 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				core.Config.UpdateConfiguration(updateConf)
+				conf.UpdateConfiguration(updateConf)
 
 				// Then
 
-				Expect(core.Config.Primary).Should(Equal("http://localhost"))
-				Expect(core.Config.Secondary).Should(Equal("http://localhost"))
-				Expect(core.Config.Candidate).Should(Equal("http://localhost"))
-				Expect(core.Config.GetServiceName()).Should(Equal("localhost"))
+				Expect(conf.Primary).Should(Equal("http://localhost"))
+				Expect(conf.Secondary).Should(Equal("http://localhost"))
+				Expect(conf.Candidate).Should(Equal("http://localhost"))
+				Expect(conf.GetServiceName()).Should(Equal("localhost"))
 			})
 
 			It("should fail if incorrect mode", func() {
@@ -114,7 +117,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				updateConf := core.DiferenciaConfigurationUpdate{
 					Mode: "incorrect",
@@ -122,7 +124,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				err := core.Config.UpdateConfiguration(updateConf)
+				err := conf.UpdateConfiguration(updateConf)
 
 				// Then
 
@@ -144,7 +146,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				updateConf := core.DiferenciaConfigurationUpdate{
 					NoiseDetection: "incorrect",
@@ -152,11 +153,89 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				err := core.Config.UpdateConfiguration(updateConf)
+				err := conf.UpdateConfiguration(updateConf)
+
+				// Then
+
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Patch Configuration", func() {
+		Context("Update fields ", func() {
+			It("should update only the given fields", func() {
+
+				// Given
+
+				// Prepare Configuration object
+				conf := &core.DiferenciaConfiguration{
+					Port:                  8080,
+					Primary:               "http://now.httpbin.org/",
+					Candidate:             "http://now.httpbin.org/",
+					DifferenceMode:        core.Strict,
+					LevenshteinPercentage: 100,
+					IgnoreHeadersValues:   []string{"Date"},
+				}
+
+				// When
+
+				err := conf.PatchConfiguration([]byte(`{"headers": true, "ignoreHeadersValues": ["Date", "Etag"], "levenshteinPercentage": 80, "differenceMode": "Subset"}`))
+
+				// Then
+
+				Expect(err).Should(Succeed())
+				Expect(conf.Headers).Should(Equal(true))
+				Expect(conf.IgnoreHeadersValues).Should(Equal([]string{"Date", "Etag"}))
+				Expect(conf.LevenshteinPercentage).Should(Equal(80))
+				Expect(conf.DifferenceMode).Should(Equal(core.Subset))
+				Expect(conf.Primary).Should(Equal("http://now.httpbin.org/"))
+			})
+
+			It("should fail if noise detection is enabled without secondary", func() {
+
+				// Given
+
+				// Prepare Configuration object
+				conf := &core.DiferenciaConfiguration{
+					Port:           8080,
+					Primary:        "http://now.httpbin.org/",
+					Candidate:      "http://now.httpbin.org/",
+					DifferenceMode: core.Strict,
+				}
+
+				// When
+
+				err := conf.PatchConfiguration([]byte(`{"noiseDetection": true}`))
+
+				// Then
+
+				Expect(err).Should(HaveOccurred())
+				Expect(err).Should(BeAssignableToTypeOf(&core.ValidationError{}))
+				Expect(conf.NoiseDetection).Should(Equal(false))
+			})
+
+			It("should fail if a startup only field is changed", func() {
+
+				// Given
+
+				// Prepare Configuration object
+				conf := &core.DiferenciaConfiguration{
+					Port:           8080,
+					Primary:        "http://now.httpbin.org/",
+					Candidate:      "http://now.httpbin.org/",
+					DifferenceMode: core.Strict,
+				}
+
+				// When
+
+				err := conf.PatchConfiguration([]byte(`{"port": 9090, "mirroring": true}`))
 
 				// Then
 
 				Expect(err).Should(HaveOccurred())
+				Expect(conf.Port).Should(Equal(8080))
+				Expect(conf.Mirroring).Should(Equal(false))
 			})
 		})
 	})
@@ -169,7 +248,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a.json")
 				recordStatus(httpClient, 200, 200)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -181,7 +259,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -189,7 +266,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, communicationcontent, err := core.Diferencia(&request)
+				result, communicationcontent, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -201,6 +278,38 @@ var _ = Describe("Proxy", func() {
 	})
 
 	Describe("Run Diferencia", func() {
+		Context("With trace context", func() {
+			It("should propagate incoming trace to upstreams", func() {
+
+				// Given
+				var httpClient = &StubHttpClient{}
+				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a.json")
+				recordStatus(httpClient, 200, 200)
+
+				conf := &core.DiferenciaConfiguration{
+					Port:           8080,
+					Primary:        "http://now.httpbin.org/",
+					Candidate:      "http://now.httpbin.org/",
+					DifferenceMode: core.Strict,
+				}
+
+				url, _ := url.Parse("http://localhost:8080")
+				request := createRequest(http.MethodGet, url)
+				request.Header = http.Header{}
+				request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+				// When
+				_, _, err := core.Diferencia(&request, *conf, httpClient)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(httpClient.requests).Should(HaveLen(2))
+				for _, upstreamRequest := range httpClient.requests {
+					Expect(upstreamRequest.Header.Get("traceparent")).Should(HavePrefix("00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+				}
+			})
+		})
+
 		Context("Without noise reduction", func() {
 			It("should return true if both documents are equal", func() {
 
@@ -209,7 +318,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a.json")
 				recordStatus(httpClient, 200, 200)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -221,7 +329,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -229,7 +336,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -244,7 +351,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a.json")
 				recordStatus(httpClient, 200, 200)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -256,7 +362,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -264,7 +369,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -279,7 +384,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a-change-date.json")
 				recordStatus(httpClient, 200, 201)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -291,7 +395,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -299,7 +402,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -314,7 +417,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a-change-date.json")
 				recordStatus(httpClient, 200, 200)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -326,7 +428,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -334,7 +435,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -352,7 +453,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a-change-date.json", "test_fixtures/document-a-change-date.json")
 				recordStatus(httpClient, 200, 200, 200)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -365,7 +465,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        true,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -373,7 +472,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -388,7 +487,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a-change-date-and-slang-time.json", "test_fixtures/document-a-change-date.json")
 				recordStatus(httpClient, 200, 200, 200)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -402,14 +500,13 @@ var _ = Describe("Proxy", func() {
 					AllowUnsafeOperations: false,
 					IgnoreValues:          []string{"/now/slang_time"},
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
 				request := createRequest(http.MethodGet, url)
 
 				// When
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -423,7 +520,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a-change-date-and-slang-time.json", "test_fixtures/document-a-change-date.json")
 				recordStatus(httpClient, 200, 200, 200)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -437,14 +533,13 @@ var _ = Describe("Proxy", func() {
 					AllowUnsafeOperations: false,
 					IgnoreValuesFile:      "test_fixtures/manual_noise.txt",
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
 				request := createRequest(http.MethodGet, url)
 
 				// When
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -461,7 +556,6 @@ var _ = Describe("Proxy", func() {
 				// Record Http Client responses
 				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a.json")
 				recordStatus(httpClient, 200, 200)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -473,7 +567,6 @@ var _ = Describe("Proxy", func() {
 					NoiseDetection:        false,
 					AllowUnsafeOperations: false,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -481,7 +574,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -503,7 +596,6 @@ var _ = Describe("Proxy", func() {
 				headerB := http.Header{}
 				headerB["Accept"] = []string{"text/html"}
 				recordHeader(httpClient, headerA, headerB)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -517,7 +609,6 @@ var _ = Describe("Proxy", func() {
 					AllowUnsafeOperations: false,
 					Headers:               true,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -525,7 +616,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -545,7 +636,6 @@ var _ = Describe("Proxy", func() {
 				headerB := http.Header{}
 				headerB["Accept"] = []string{"text/plain"}
 				recordHeader(httpClient, headerA, headerB)
-				core.HttpClient = httpClient
 
 				// Prepare Configuration object
 				conf := &core.DiferenciaConfiguration{
@@ -559,7 +649,6 @@ var _ = Describe("Proxy", func() {
 					AllowUnsafeOperations: false,
 					Headers:               true,
 				}
-				core.Config = conf
 
 				// Create stubbed http.Request object
 				url, _ := url.Parse("http://localhost:8080")
@@ -567,7 +656,7 @@ var _ = Describe("Proxy", func() {
 
 				// When
 
-				result, _, err := core.Diferencia(&request)
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
 
 				//Then
 
@@ -575,6 +664,160 @@ var _ = Describe("Proxy", func() {
 				Expect(err).Should(Succeed())
 			})
 		})
+
+		Context("With snapshots", func() {
+
+			var dir string
+
+			BeforeEach(func() {
+				dir, _ = ioutil.TempDir("", "snapshots")
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("should compare candidate against recorded primary", func() {
+				// Given
+				var recordClient = &StubHttpClient{}
+				recordContent(recordClient, "test_fixtures/document-a.json", "test_fixtures/document-a.json")
+				recordStatus(recordClient, 200, 200)
+
+				conf := &core.DiferenciaConfiguration{
+					Port:           8080,
+					Primary:        "http://now.httpbin.org/",
+					Candidate:      "http://now.httpbin.org/",
+					DifferenceMode: core.Strict,
+					SnapshotMode:   snapshot.RecordMode,
+					SnapshotDir:    dir,
+				}
+
+				recordURL, _ := url.Parse("http://localhost:8080/users?page=1&size=10")
+				request := createRequest(http.MethodGet, recordURL)
+				recorded, _, err := core.Diferencia(&request, *conf, recordClient)
+				Expect(err).Should(Succeed())
+				Expect(recorded.EqualContent).Should(Equal(true))
+
+				var compareClient = &StubHttpClient{}
+				recordContent(compareClient, "test_fixtures/document-a-change-date.json")
+				recordStatus(compareClient, 200)
+
+				conf = &core.DiferenciaConfiguration{
+					Port:           8080,
+					Candidate:      "http://now.httpbin.org/",
+					DifferenceMode: core.Strict,
+					SnapshotMode:   snapshot.CompareMode,
+					SnapshotDir:    dir,
+				}
+				Expect(conf.Validate()).Should(Succeed())
+
+				// When
+
+				sameQueryInOtherOrder, _ := url.Parse("http://localhost:8080/users?size=10&page=1")
+				compareRequest := createRequest(http.MethodGet, sameQueryInOtherOrder)
+				result, _, err := core.Diferencia(&compareRequest, *conf, compareClient)
+
+				//Then
+
+				Expect(err).Should(Succeed())
+				Expect(result.EqualContent).Should(Equal(false))
+				Expect(compareClient.requests).Should(HaveLen(1))
+			})
+
+			It("should report missing snapshots", func() {
+				// Given
+				var httpClient = &StubHttpClient{}
+				recordContent(httpClient, "test_fixtures/document-a.json")
+				recordStatus(httpClient, 200)
+
+				conf := &core.DiferenciaConfiguration{
+					Port:           8080,
+					Candidate:      "http://now.httpbin.org/",
+					DifferenceMode: core.Strict,
+					SnapshotMode:   snapshot.CompareMode,
+					SnapshotDir:    dir,
+				}
+
+				url, _ := url.Parse("http://localhost:8080/orders")
+				request := createRequest(http.MethodGet, url)
+
+				// When
+
+				_, _, err := core.Diferencia(&request, *conf, httpClient)
+
+				//Then
+
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("primary snapshot of GET /orders"))
+				Expect(err.Error()).Should(ContainSubstring("424"))
+				Expect(httpClient.requests).Should(BeEmpty())
+			})
+		})
+
+		Context("With redaction", func() {
+			It("should redact sensitive headers and patterns from differences", func() {
+				// Given
+				var httpClient = &StubHttpClient{}
+				// Record Http Client responses
+				recordContent(httpClient, "test_fixtures/document-a.json", "test_fixtures/document-a.json")
+				recordStatus(httpClient, 200, 200)
+				headerA := http.Header{}
+				headerA["Authorization"] = []string{"Bearer primary-token"}
+				headerA["X-Owner"] = []string{"alex@example.com"}
+
+				headerB := http.Header{}
+				headerB["Authorization"] = []string{"Bearer candidate-token"}
+				headerB["X-Owner"] = []string{"sam@example.com"}
+				recordHeader(httpClient, headerA, headerB)
+
+				// Prepare Configuration object
+				conf := &core.DiferenciaConfiguration{
+					Port:           8080,
+					Primary:        "http://now.httpbin.org/",
+					Candidate:      "http://now.httpbin.org/",
+					DifferenceMode: core.Strict,
+					Headers:        true,
+				}
+				err := conf.PatchConfiguration([]byte(`{"redactHeaders": ["authorization"], "redactPatterns": ["[a-z]+@example\\.com"]}`))
+				Expect(err).Should(Succeed())
+
+				// Create stubbed http.Request object
+				url, _ := url.Parse("http://localhost:8080")
+				request := createRequest(http.MethodGet, url)
+
+				// When
+
+				result, _, err := core.Diferencia(&request, *conf, httpClient)
+
+				//Then
+
+				Expect(err).Should(Succeed())
+				Expect(result.EqualContent).Should(Equal(false))
+				Expect(result.Diff.HeadersDiff).Should(ContainSubstring("Authorization:[REDACTED]"))
+				Expect(result.Diff.HeadersDiff).ShouldNot(ContainSubstring("token"))
+				Expect(result.Diff.HeadersDiff).ShouldNot(ContainSubstring("example.com"))
+			})
+
+			It("should fail with an invalid pattern", func() {
+
+				// Given
+				conf := &core.DiferenciaConfiguration{
+					Port:           8080,
+					Primary:        "http://now.httpbin.org/",
+					Candidate:      "http://now.httpbin.org/",
+					DifferenceMode: core.Strict,
+				}
+
+				// When
+
+				err := conf.PatchConfiguration([]byte(`{"redactPatterns": ["[0-9"]}`))
+
+				// Then
+
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("[0-9"))
+			})
+		})
 	})
 })
 
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/lordofthejars/diferencia/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// IsAdminTLSSet checks if admin endpoints are served using https
+func (conf DiferenciaConfiguration) IsAdminTLSSet() bool {
+	return len(conf.AdminCert) > 0 && len(conf.AdminKey) > 0
+}
+
+// newAdminAuthenticator creates the chain of authenticators configured for admin endpoints.
+// If no authentication is configured, it returns nil so admin endpoints reject every request, or auth.Insecure if AdminInsecure is set.
+func newAdminAuthenticator(conf DiferenciaConfiguration) (auth.Authenticator, error) {
+
+	var chain auth.Chain
+
+	if len(conf.AdminClientCa) > 0 {
+		certificates, err := auth.NewCertificateAuthenticator(conf.AdminClientCertRoles)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, certificates)
+	}
+
+	tokens := auth.NewTokenAuthenticator()
+	if len(conf.AdminTokensFile) > 0 {
+		if err := tokens.LoadFile(conf.AdminTokensFile); err != nil {
+			return nil, fmt.Errorf("Error reading admin tokens file %s. %s", conf.AdminTokensFile, err.Error())
+		}
+	}
+	if env := os.Getenv(auth.TokensEnv); len(env) > 0 {
+		if err := tokens.LoadEnv(env); err != nil {
+			return nil, fmt.Errorf("Error reading admin tokens from %s. %s", auth.TokensEnv, err.Error())
+		}
+	}
+	if tokens.Len() > 0 {
+		chain = append(chain, tokens)
+	}
+
+	if len(conf.AdminBasicAuthFile) > 0 {
+		basic := auth.NewBasicAuthenticator()
+		if err := basic.LoadFile(conf.AdminBasicAuthFile); err != nil {
+			return nil, fmt.Errorf("Error reading admin users file %s. %s", conf.AdminBasicAuthFile, err.Error())
+		}
+		chain = append(chain, basic)
+	}
+
+	if len(chain) == 0 {
+		if conf.AdminInsecure {
+			logrus.Warn("Admin authentication is not configured and adminInsecure is set, anyone reaching admin endpoints can read stats and configuration and modify Diferencia.")
+			return auth.Insecure, nil
+		}
+		logrus.Warn("Admin authentication is not configured, admin endpoints reject every request. Configure admin credentials or set adminInsecure to allow anonymous access.")
+		return nil, nil
+	}
+
+	return chain, nil
+}
+
+// adminTLSConfig creates TLS configuration of admin server, verifying client certificates if a client CA is configured
+func adminTLSConfig(conf DiferenciaConfiguration) (*tls.Config, error) {
+
+	config := &tls.Config{}
+
+	if len(conf.AdminClientCa) > 0 {
+		caCert, err := ioutil.ReadFile(conf.AdminClientCa)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(caCert)
+
+		config.ClientCAs = caCertPool
+		// Certificates are optional so tokens or basic credentials can still be used
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
@@ -18,34 +18,35 @@ type DashboardVO struct {
 
 type FailingEntries struct {
 	Endpoint     exporter.URLCall
+	Errors       int
 	ErrorDetails []exporter.ErrorData
 }
 
-func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+func (p *Proxy) dashboardHandler(w http.ResponseWriter, r *http.Request) {
 
 	element := ExtractFile(*r.URL)
 
-	err := renderHtmlTemplate(element, w, DashboardVO{exporter.Entries(), *Config}, site)
+	err := renderHtmlTemplate(element, w, DashboardVO{p.stats.Entries(), *p.config}, site)
 
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, err.Error())
+		fmt.Fprint(w, err.Error())
 		return
 	}
 
 }
 
-func dashboardDetailsHandler(w http.ResponseWriter, r *http.Request) {
+func (p *Proxy) dashboardDetailsHandler(w http.ResponseWriter, r *http.Request) {
 
 	method := r.URL.Query().Get("method")
 	path := r.URL.Query().Get("path")
 
-	entry := exporter.FindEntry(method, path)
-	err := renderHtmlTemplate("diff.html", w, FailingEntries{Endpoint: entry.Endpoint, ErrorDetails: entry.ErrorDetails}, site)
+	entry := p.stats.FindEntry(method, path)
+	err := renderHtmlTemplate("diff.html", w, FailingEntries{Endpoint: entry.Endpoint, Errors: entry.Errors, ErrorDetails: entry.ErrorDetails}, site)
 
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, err.Error())
+		fmt.Fprint(w, err.Error())
 		return
 	}
 }
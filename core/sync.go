@@ -1,5 +0,0 @@
-package core
-
-import "sync"
-
-var mutex = &sync.Mutex{}
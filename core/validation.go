@@ -0,0 +1,240 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lordofthejars/diferencia/auth"
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/redact"
+	"github.com/lordofthejars/diferencia/route"
+	"github.com/lordofthejars/diferencia/snapshot"
+	"github.com/lordofthejars/diferencia/status"
+)
+
+// ValidationError contains all the problems found while validating a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+// Validate checks that the configuration is consistent as a whole
+func (conf DiferenciaConfiguration) Validate() error {
+
+	var problems []string
+
+	// Primary is not called when comparing snapshots
+	problems = append(problems, validateURL("primary", conf.Primary, !conf.IsSnapshotCompareMode())...)
+	problems = append(problems, validateURL("candidate", conf.Candidate, true)...)
+	problems = append(problems, validateURL("secondary", conf.Secondary, false)...)
+	problems = append(problems, validateURL("tracingEndpoint", conf.TracingEndpoint, false)...)
+
+	if conf.NoiseDetection && len(conf.Secondary) == 0 && !conf.IsSnapshotCompareMode() {
+		problems = append(problems, "If Noise Detection is enabled, you need to provide a secondary URL as well")
+	}
+
+	if conf.Mirroring && conf.ReturnResult {
+		problems = append(problems, "You cannot set Returning Result of comparision and mirroring at the same time")
+	}
+
+	if !areHttpsClientAttributesCorrect(conf.CaCert, conf.ClientCert, conf.ClientKey) {
+		problems = append(problems, fmt.Sprintf("Https Client options should either not provided or all of them provided but not only some. caCert: %s, clientCert: %s, clientkey: %s", conf.CaCert, conf.ClientCert, conf.ClientKey))
+	}
+
+	if conf.DifferenceMode < Strict || conf.DifferenceMode > Schema {
+		problems = append(problems, fmt.Sprintf("Cannot find %d difference mode", conf.DifferenceMode))
+	}
+
+	if conf.LevenshteinPercentage < 0 || conf.LevenshteinPercentage > 100 {
+		problems = append(problems, fmt.Sprintf("Levenshtein percentage must be between 0 and 100 but it is %d", conf.LevenshteinPercentage))
+	}
+
+	if (len(conf.AdminCert) > 0) != (len(conf.AdminKey) > 0) {
+		problems = append(problems, "Admin certificate and key must be provided together")
+	}
+
+	if len(conf.AdminClientCa) > 0 && !conf.IsAdminTLSSet() {
+		problems = append(problems, "Admin client CA requires admin certificate and key to serve https")
+	}
+
+	if len(conf.AdminClientCertRoles) > 0 {
+		if len(conf.AdminClientCa) == 0 {
+			problems = append(problems, "Admin client certificate roles require an admin client CA")
+		}
+		if _, err := auth.NewCertificateAuthenticator(conf.AdminClientCertRoles); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if conf.StoreResultsMaxSize < 0 || conf.StoreResultsBackups < 0 {
+		problems = append(problems, "Store results limits cannot be negative")
+	}
+
+	if len(conf.StoreResultsMaxAge) > 0 {
+		if maxAge, err := time.ParseDuration(conf.StoreResultsMaxAge); err != nil || maxAge < 0 {
+			problems = append(problems, fmt.Sprintf("Store results max age %s is not a valid duration", conf.StoreResultsMaxAge))
+		}
+	}
+
+	if !snapshot.IsValidMode(conf.SnapshotMode) {
+		problems = append(problems, fmt.Sprintf("Cannot find %s snapshot mode. Valid modes are %s and %s", conf.SnapshotMode, snapshot.RecordMode, snapshot.CompareMode))
+	}
+
+	if conf.IsSnapshotModeSet() && len(conf.SnapshotDir) == 0 {
+		problems = append(problems, "Snapshot mode requires a snapshot directory")
+	}
+
+	if len(conf.SnapshotMaxAge) > 0 {
+		if maxAge, err := time.ParseDuration(conf.SnapshotMaxAge); err != nil || maxAge < 0 {
+			problems = append(problems, fmt.Sprintf("Snapshot max age %s is not a valid duration", conf.SnapshotMaxAge))
+		}
+	}
+
+	for _, sink := range conf.Sinks {
+		if _, _, err := exporter.ParseSink(sink); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if conf.WebhookBatchSize < 0 || conf.WebhookMaxRetries < 0 || conf.WebhookRateLimit < 0 {
+		problems = append(problems, "Webhook limits cannot be negative")
+	}
+
+	if len(conf.WebhookBatchInterval) > 0 {
+		if batchInterval, err := time.ParseDuration(conf.WebhookBatchInterval); err != nil || batchInterval < 0 {
+			problems = append(problems, fmt.Sprintf("Webhook batch interval %s is not a valid duration", conf.WebhookBatchInterval))
+		}
+	}
+
+	if _, err := status.New(conf.StatusEquivalences); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := redact.New(conf.redactionRules()); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(conf.LatencyBudget) > 0 {
+		if budget, err := time.ParseDuration(conf.LatencyBudget); err != nil || budget < 0 {
+			problems = append(problems, fmt.Sprintf("Latency budget %s is not a valid duration", conf.LatencyBudget))
+		}
+	}
+
+	if conf.LatencyBudgetRatio < 0 {
+		problems = append(problems, "Latency budget ratio cannot be negative")
+	}
+
+	if err := conf.verdictRules().Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if !exporter.IsValidSamplingStrategy(conf.ErrorDetailsSampling) {
+		problems = append(problems, fmt.Sprintf("Cannot find %s error details sampling", conf.ErrorDetailsSampling))
+	}
+
+	if conf.ErrorDetailsEndpoint < 0 || conf.ErrorDetailsTotal < 0 || conf.ErrorDetailsMaxSize < 0 {
+		problems = append(problems, "Error details limits cannot be negative")
+	}
+
+	if _, err := route.NewMatcher(conf.RouteTemplates, conf.InferRouteTemplates); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	for _, pointer := range conf.IgnoreValues {
+		if !strings.HasPrefix(pointer, "/") {
+			problems = append(problems, fmt.Sprintf("Ignore value %s is not a valid JSON Pointer", pointer))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// validateRuntimeChange checks that updated configuration does not modify fields that are only read at startup
+func (conf DiferenciaConfiguration) validateRuntimeChange(updated DiferenciaConfiguration) error {
+
+	var problems []string
+
+	if conf.Port != updated.Port {
+		problems = append(problems, "port cannot be changed at runtime")
+	}
+
+	if conf.AdminPort != updated.AdminPort {
+		problems = append(problems, "adminPort cannot be changed at runtime")
+	}
+
+	if conf.PrometheusPort != updated.PrometheusPort {
+		problems = append(problems, "prometheusPort cannot be changed at runtime")
+	}
+
+	if conf.Prometheus != updated.Prometheus {
+		problems = append(problems, "prometheus cannot be changed at runtime")
+	}
+
+	if conf.AdminTokensFile != updated.AdminTokensFile || conf.AdminBasicAuthFile != updated.AdminBasicAuthFile ||
+		conf.AdminCert != updated.AdminCert || conf.AdminKey != updated.AdminKey || conf.AdminClientCa != updated.AdminClientCa ||
+		!reflect.DeepEqual(conf.AdminClientCertRoles, updated.AdminClientCertRoles) || conf.AdminAuditLog != updated.AdminAuditLog ||
+		conf.AdminInsecure != updated.AdminInsecure {
+		problems = append(problems, "admin security options cannot be changed at runtime")
+	}
+
+	if conf.StatsStore != updated.StatsStore {
+		problems = append(problems, "statsStore cannot be changed at runtime")
+	}
+
+	if conf.StoreResults != updated.StoreResults || conf.StoreResultsMaxSize != updated.StoreResultsMaxSize ||
+		conf.StoreResultsMaxAge != updated.StoreResultsMaxAge || conf.StoreResultsCompress != updated.StoreResultsCompress ||
+		conf.StoreResultsBackups != updated.StoreResultsBackups {
+		problems = append(problems, "store results options cannot be changed at runtime")
+	}
+
+	if conf.SnapshotMode != updated.SnapshotMode || conf.SnapshotDir != updated.SnapshotDir || conf.SnapshotMaxAge != updated.SnapshotMaxAge {
+		problems = append(problems, "snapshot options cannot be changed at runtime")
+	}
+
+	if !reflect.DeepEqual(conf.Sinks, updated.Sinks) || conf.WebhookSecret != updated.WebhookSecret ||
+		conf.WebhookBatchSize != updated.WebhookBatchSize || conf.WebhookBatchInterval != updated.WebhookBatchInterval ||
+		conf.WebhookMaxRetries != updated.WebhookMaxRetries || conf.WebhookRateLimit != updated.WebhookRateLimit {
+		problems = append(problems, "sinks options cannot be changed at runtime")
+	}
+
+	if conf.TracingEndpoint != updated.TracingEndpoint {
+		problems = append(problems, "tracingEndpoint cannot be changed at runtime")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+func areHttpsClientAttributesCorrect(caCert, clientCert, clientKey string) bool {
+	return (len(caCert) == 0 && len(clientCert) == 0 && len(clientKey) == 0) || (len(caCert) > 0 && len(clientCert) > 0 && len(clientKey) > 0)
+}
+
+func validateURL(name, value string, required bool) []string {
+
+	if len(value) == 0 {
+		if required {
+			return []string{fmt.Sprintf("%s URL is required", name)}
+		}
+		return nil
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || len(parsed.Scheme) == 0 || len(parsed.Host) == 0 {
+		return []string{fmt.Sprintf("%s URL %s is not a valid absolute URL", name, value)}
+	}
+
+	return nil
+}
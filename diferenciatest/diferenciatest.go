@@ -0,0 +1,116 @@
+// Package diferenciatest compares http.Handler implementations in Go tests, calling them in memory with the same engine as Diferencia proxy.
+package diferenciatest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/lordofthejars/diferencia/core"
+)
+
+const (
+	// PrimaryURL of the primary handler
+	PrimaryURL = "http://primary"
+	// SecondaryURL of the secondary handler
+	SecondaryURL = "http://secondary"
+	// CandidateURL of the candidate handler
+	CandidateURL = "http://candidate"
+)
+
+// Handlers to compare. Secondary is optional, if set it is used to detect noise.
+type Handlers struct {
+	Primary   http.Handler
+	Secondary http.Handler
+	Candidate http.Handler
+}
+
+// HandlerClient is a core.Client serving requests with the handler registered for the host of the URL
+type HandlerClient struct {
+	handlers map[string]http.Handler
+}
+
+// NewHandlerClient creates a client for given handlers by host
+func NewHandlerClient(handlers map[string]http.Handler) *HandlerClient {
+	return &HandlerClient{handlers: handlers}
+}
+
+// MakeRequest to the handler of url host maintaining r configuration
+func (c *HandlerClient) MakeRequest(r *http.Request, target string) (*http.Response, error) {
+
+	newRequest, err := http.NewRequest(r.Method, target, r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	handler, ok := c.handlers[newRequest.URL.Host]
+	if !ok {
+		return nil, &url.Error{Op: r.Method, URL: target, Err: fmt.Errorf("No handler registered for %s", newRequest.URL.Host)}
+	}
+
+	newRequest = newRequest.WithContext(r.Context())
+	newRequest.Header = r.Header
+	newRequest.ContentLength = r.ContentLength
+	newRequest.RequestURI = newRequest.URL.RequestURI()
+	// Same remote address as httptest.NewRequest
+	newRequest.RemoteAddr = "192.0.2.1:1234"
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, newRequest)
+
+	return response.Result(), nil
+}
+
+// Compare sends every request to handlers and reports through t each request whose responses are different.
+// conf sets how responses are compared, upstream URLs are replaced with the handlers and unsafe operations are allowed.
+func Compare(t testing.TB, conf core.DiferenciaConfiguration, handlers Handlers, requests ...*http.Request) []core.Result {
+	t.Helper()
+
+	conf.Primary = PrimaryURL
+	conf.Candidate = CandidateURL
+	conf.AllowUnsafeOperations = true
+	conf.Mirroring = false
+
+	clientHandlers := map[string]http.Handler{
+		"primary":   handlers.Primary,
+		"candidate": handlers.Candidate,
+	}
+
+	if handlers.Secondary != nil {
+		conf.Secondary = SecondaryURL
+		conf.NoiseDetection = true
+		clientHandlers["secondary"] = handlers.Secondary
+	} else {
+		conf.Secondary = ""
+		conf.NoiseDetection = false
+	}
+
+	proxy, err := core.NewProxyWithClient(conf, NewHandlerClient(clientHandlers))
+	if err != nil {
+		t.Fatalf("Cannot compare handlers. %s", err.Error())
+		return nil
+	}
+	defer proxy.Close()
+
+	results := make([]core.Result, 0, len(requests))
+	for _, request := range requests {
+		result, _, err := proxy.Compare(request)
+		if err != nil {
+			t.Errorf("%s %s cannot be compared. %s", request.Method, request.URL.RequestURI(), err.Error())
+		} else if !result.EqualContent {
+			t.Errorf("%s %s responses of primary and candidate are different\n%s", request.Method, request.URL.RequestURI(), result.Diff.String())
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Equal checks that primary and candidate return the same responses for every request, comparing bodies in Strict mode
+func Equal(t testing.TB, primary, candidate http.Handler, requests ...*http.Request) []core.Result {
+	t.Helper()
+
+	return Compare(t, core.DiferenciaConfiguration{DifferenceMode: core.Strict}, Handlers{Primary: primary, Candidate: candidate}, requests...)
+}
@@ -0,0 +1,156 @@
+package diferenciatest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordofthejars/diferencia/core"
+	"github.com/lordofthejars/diferencia/diferenciatest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordingT records failures instead of failing the running test
+type recordingT struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.fatal = true
+}
+
+func jsonHandler(content string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, content)
+	})
+}
+
+var _ = Describe("Test Helper", func() {
+
+	Describe("Compare handlers", func() {
+		Context("With equal handlers", func() {
+			It("should not report anything", func() {
+
+				// Given
+				t := &recordingT{}
+				echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					body, _ := ioutil.ReadAll(r.Body)
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"method": "%s", "path": "%s", "body": %s}`, r.Method, r.URL.Path, body)
+				})
+
+				// When
+				diferenciatest.Equal(t, echo, echo,
+					httptest.NewRequest(http.MethodGet, "/users", strings.NewReader("null")),
+					httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": "Alex"}`)))
+
+				// Then
+				Expect(t.errors).Should(BeEmpty())
+			})
+		})
+
+		Context("With different handlers", func() {
+			It("should report the differences", func() {
+
+				// Given
+				t := &recordingT{}
+
+				// When
+				results := diferenciatest.Equal(t, jsonHandler(`{"name": "Alex"}`), jsonHandler(`{"name": "Sam"}`), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(t.errors).Should(HaveLen(1))
+				Expect(t.errors[0]).Should(ContainSubstring("GET /users/1"))
+				Expect(t.errors[0]).Should(ContainSubstring("Body:"))
+				Expect(results).Should(HaveLen(1))
+				Expect(results[0].EqualContent).Should(Equal(false))
+			})
+
+			It("should compare headers if configured", func() {
+
+				// Given
+				t := &recordingT{}
+				candidate := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("X-Version", "2")
+					fmt.Fprint(w, `{"name": "Alex"}`)
+				})
+
+				// When
+				diferenciatest.Compare(t, core.DiferenciaConfiguration{DifferenceMode: core.Strict, Headers: true},
+					diferenciatest.Handlers{Primary: jsonHandler(`{"name": "Alex"}`), Candidate: candidate},
+					httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(t.errors).Should(HaveLen(1))
+				Expect(t.errors[0]).Should(ContainSubstring("X-Version"))
+			})
+		})
+
+		Context("With noise detection", func() {
+			It("should ignore values changing between primary and secondary", func() {
+
+				// Given
+				t := &recordingT{}
+				now := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"name": "Alex", "now": %d}`, time.Now().UnixNano())
+				})
+
+				// When
+				diferenciatest.Compare(t, core.DiferenciaConfiguration{DifferenceMode: core.Strict},
+					diferenciatest.Handlers{Primary: now, Secondary: now, Candidate: now},
+					httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+				// Then
+				Expect(t.errors).Should(BeEmpty())
+			})
+		})
+
+		Context("With an invalid configuration", func() {
+			It("should fail", func() {
+
+				// Given
+				t := &recordingT{}
+
+				// When
+				diferenciatest.Compare(t, core.DiferenciaConfiguration{DifferenceMode: core.Strict, LevenshteinPercentage: 200},
+					diferenciatest.Handlers{Primary: jsonHandler(`{}`), Candidate: jsonHandler(`{}`)})
+
+				// Then
+				Expect(t.fatal).Should(Equal(true))
+			})
+		})
+	})
+
+	Describe("Handler Client", func() {
+		Context("With an unknown host", func() {
+			It("should return an error", func() {
+
+				// Given
+				client := diferenciatest.NewHandlerClient(map[string]http.Handler{"primary": jsonHandler(`{}`)})
+
+				// When
+				_, err := client.MakeRequest(httptest.NewRequest(http.MethodGet, "/", nil), "http://candidate/")
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
@@ -28,6 +28,13 @@ func CompareDocuments(candidate, original []byte, difference string) (bool, stri
 
 }
 
+// Diff returns the differences between two JSON documents, whatever the difference mode is
+func Diff(candidate, original []byte) string {
+	options := defaultJsonOptions()
+	_, output := jsondiff.Compare(candidate, original, &options)
+	return output
+}
+
 func defaultJsonOptions() jsondiff.Options {
 	return jsondiff.Options{
 		Added:   jsondiff.Tag{Begin: "", End: ""},
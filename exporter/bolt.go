@@ -0,0 +1,227 @@
+package exporter
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var statsBucket = []byte("stats")
+
+// boltFlushInterval is the maximum time changes are kept in memory before being written to the BoltDB file
+const boltFlushInterval = 1 * time.Second
+
+// BoltStore persists data in an embedded BoltDB file so stats survive restarts.
+// Data is served from memory and changes are written in background in a single transaction every second and when the store is closed,
+// so comparisons do not wait for the disk.
+type BoltStore struct {
+	mutex  sync.Mutex
+	db     *bolt.DB
+	memory *MemoryStore
+	// changes not written yet
+	dirty   map[URLCall]bool
+	deleted map[URLCall]bool
+	cleared bool
+	// flushes are written one at a time, in the same order pending changes were taken
+	flushing sync.Mutex
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewBoltStore opens (or creates) the BoltDB file at given path and loads its data
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	memory := NewMemoryStore()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(statsBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var entry SnapshotEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+			return memory.Save(entry.Endpoint, entry.callData())
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &BoltStore{
+		db:      db,
+		memory:  memory,
+		dirty:   make(map[URLCall]bool),
+		deleted: make(map[URLCall]bool),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.flushEvery(boltFlushInterval)
+
+	return s, nil
+}
+
+// Load data of given endpoint. Returned data can be modified without changing the stored one.
+func (s *BoltStore) Load(call URLCall) (CallData, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, found, err := s.memory.Load(call)
+	return data.clone(), found, err
+}
+
+// Save data of given endpoint. It is written to the file in background.
+func (s *BoltStore) Save(call URLCall, data CallData) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.dirty[call] = true
+	delete(s.deleted, call)
+	return s.memory.Save(call, data)
+}
+
+// Delete data of given endpoint. It is removed from the file in background.
+func (s *BoltStore) Delete(call URLCall) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.deleted[call] = true
+	delete(s.dirty, call)
+	return s.memory.Delete(call)
+}
+
+// All returns the data of all endpoints
+func (s *BoltStore) All() (map[URLCall]CallData, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.memory.All()
+}
+
+// Clear removes data of all endpoints. They are removed from the file in background.
+func (s *BoltStore) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cleared = true
+	s.dirty = make(map[URLCall]bool)
+	s.deleted = make(map[URLCall]bool)
+	return s.memory.Clear()
+}
+
+// Close writes pending changes and closes the BoltDB file
+func (s *BoltStore) Close() error {
+	close(s.done)
+	<-s.stopped
+
+	err := s.flush()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *BoltStore) flushEvery(interval time.Duration) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				logrus.Errorf("Error writing stats to %s. %s", s.db.Path(), err.Error())
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// flush writes pending changes in a single transaction. If the transaction fails, changes are kept pending for the next flush.
+func (s *BoltStore) flush() error {
+	s.flushing.Lock()
+	defer s.flushing.Unlock()
+
+	s.mutex.Lock()
+	cleared, dirty, deleted := s.cleared, s.dirty, s.deleted
+	values := make(map[URLCall][]byte, len(dirty))
+	for call := range dirty {
+		data, _, _ := s.memory.Load(call)
+		value, err := json.Marshal(newSnapshotEntry(call, data))
+		if err != nil {
+			logrus.Errorf("Error encoding stats of %s %s. %s", call.Method, call.Path, err.Error())
+			continue
+		}
+		values[call] = value
+	}
+	s.cleared, s.dirty, s.deleted = false, make(map[URLCall]bool), make(map[URLCall]bool)
+	s.mutex.Unlock()
+
+	if !cleared && len(deleted) == 0 && len(values) == 0 {
+		return nil
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if cleared {
+			if err := tx.DeleteBucket(statsBucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(statsBucket); err != nil {
+				return err
+			}
+		}
+		bucket := tx.Bucket(statsBucket)
+		for call := range deleted {
+			if err := bucket.Delete(boltKey(call)); err != nil {
+				return err
+			}
+		}
+		for call, value := range values {
+			if err := bucket.Put(boltKey(call), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		s.pending(cleared, dirty, deleted)
+	}
+	return err
+}
+
+// pending restores changes of a failed flush, unless newer changes replace them
+func (s *BoltStore) pending(cleared bool, dirty, deleted map[URLCall]bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cleared {
+		return
+	}
+	s.cleared = cleared
+	for call := range dirty {
+		if !s.deleted[call] {
+			s.dirty[call] = true
+		}
+	}
+	for call := range deleted {
+		if !s.dirty[call] {
+			s.deleted[call] = true
+		}
+	}
+}
+
+func boltKey(call URLCall) []byte {
+	return []byte(call.Method + " " + call.Path)
+}
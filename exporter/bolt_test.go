@@ -0,0 +1,109 @@
+package exporter_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bolt Store", func() {
+
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "stats")
+		if err != nil {
+			Fail(fmt.Sprintf("Unable to create temporal directory. Reason: %q", err))
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Persist stats", func() {
+		Context("After closing the store", func() {
+			It("should keep counters, timings and error details", func() {
+
+				// Given
+				file := filepath.Join(dir, "stats.db")
+				store, err := exporter.NewBoltStore(file)
+				Expect(err).Should(Succeed())
+				stats := exporter.NewURLCounterMapWithStore(store)
+				primaryAverage, _ := time.ParseDuration("10ms")
+				candidateAverage, _ := time.ParseDuration("20ms")
+
+				stats.IncSuccess("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage, CandidateElapsedTime: candidateAverage})
+				stats.IncErr("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage, CandidateElapsedTime: candidateAverage}, exporter.ErrorData{FullURI: "/a?b=c", BodyDiff: "diff"})
+				Expect(stats.Close()).Should(Succeed())
+
+				// When
+				store, err = exporter.NewBoltStore(file)
+				Expect(err).Should(Succeed())
+				stats = exporter.NewURLCounterMapWithStore(store)
+				defer stats.Close()
+
+				// Then
+				entries := stats.Entries()
+				Expect(entries).Should(HaveLen(1))
+				Expect(entries[0].Success).Should(Equal(1))
+				Expect(entries[0].Errors).Should(Equal(1))
+				Expect(entries[0].AverageCandidateDuration).Should(Equal(float32(20)))
+				Expect(entries[0].ErrorDetails[0].BodyDiff).Should(Equal("diff"))
+			})
+
+			It("should remove stats on reset", func() {
+
+				// Given
+				store, err := exporter.NewBoltStore(filepath.Join(dir, "stats.db"))
+				Expect(err).Should(Succeed())
+				stats := exporter.NewURLCounterMapWithStore(store)
+				defer stats.Close()
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{})
+				stats.IncErr("GET", "/b", exporter.Observation{}, exporter.ErrorData{})
+
+				// When
+				stats.ResetMatching("GET", "/a")
+
+				// Then
+				Expect(stats.Entries()).Should(HaveLen(1))
+				stats.Reset()
+				Expect(stats.Entries()).Should(HaveLen(0))
+			})
+
+			It("should keep resets and later changes", func() {
+
+				// Given
+				file := filepath.Join(dir, "stats.db")
+				store, err := exporter.NewBoltStore(file)
+				Expect(err).Should(Succeed())
+				stats := exporter.NewURLCounterMapWithStore(store)
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{})
+				stats.IncErr("GET", "/b", exporter.Observation{}, exporter.ErrorData{})
+				stats.Reset()
+				stats.IncErr("GET", "/c", exporter.Observation{}, exporter.ErrorData{})
+				stats.ResetMatching("GET", "/c")
+				stats.IncErr("GET", "/d", exporter.Observation{}, exporter.ErrorData{})
+				Expect(stats.Close()).Should(Succeed())
+
+				// When
+				store, err = exporter.NewBoltStore(file)
+				Expect(err).Should(Succeed())
+				stats = exporter.NewURLCounterMapWithStore(store)
+				defer stats.Close()
+
+				// Then
+				entries := stats.Entries()
+				Expect(entries).Should(HaveLen(1))
+				Expect(entries[0].Endpoint.Path).Should(Equal("/d"))
+			})
+		})
+	})
+})
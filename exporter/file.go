@@ -2,18 +2,64 @@ package exporter
 
 import (
 	"bufio"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/lordofthejars/diferencia/redact"
 )
 
+// Base64Encoding marks bodies stored as base64 because they are not valid UTF-8 text
+const Base64Encoding = "base64"
+
+// Request received by Diferencia and sent to all upstreams
+type Request struct {
+	Method  string      `json:"method"`
+	URI     string      `json:"uri"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+	// BodyEncoding is base64 for binary bodies, empty for text ones
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+}
+
+// Interaction contains the response of an upstream
 type Interaction struct {
-	URL        string `json:"url"`
-	Content    string `json:"content"`
-	StatusCode int    `json:"status"`
+	URL     string `json:"url"`
+	Content string `json:"content"`
+	// ContentEncoding is base64 for binary contents, empty for text ones
+	ContentEncoding string        `json:"contentEncoding,omitempty"`
+	StatusCode      int           `json:"status"`
+	Headers         http.Header   `json:"headers,omitempty"`
+	Cookies         []string      `json:"cookies,omitempty"`
+	ElapsedTime     time.Duration `json:"elapsedTimeNano"`
+	// Error type if the upstream could not be called, like timeout or connection_refused
+	Error string `json:"error,omitempty"`
+}
+
+// RawContent returns the content as it was received
+func (i Interaction) RawContent() ([]byte, error) {
+	return DecodeBody(i.Content, i.ContentEncoding)
 }
 
+// Outcome of the call, the error type if the upstream could not be called or the status code otherwise
+func (i Interaction) Outcome() string {
+	if len(i.Error) > 0 {
+		return i.Error
+	}
+	return strconv.Itoa(i.StatusCode)
+}
+
+// Interactions contains the full exchange of a comparison
 type Interactions struct {
+	Request        Request      `json:"request"`
 	Primary        Interaction  `json:"primary"`
 	Secondary      *Interaction `json:"secondary,omitempty"`
 	Candidate      Interaction  `json:"candidate"`
@@ -22,16 +68,71 @@ type Interactions struct {
 	Processed      time.Time    `json:"processedDate"`
 }
 
-func CreateInteraction(url string, content []byte, statusCode int) Interaction {
-	return Interaction{
-		URL:        url,
-		Content:    string(content),
-		StatusCode: statusCode,
+// EncodeBody returns body as text and its encoding. Bodies that are not valid UTF-8 are encoded as base64, so they are stored as they are.
+func EncodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
 	}
+	return base64.StdEncoding.EncodeToString(body), Base64Encoding
+}
+
+// DecodeBody returns the body stored as text with given encoding
+func DecodeBody(text, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(text), nil
+	case Base64Encoding:
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return nil, fmt.Errorf("Cannot find %s body encoding. Valid encoding is %s", encoding, Base64Encoding)
+}
+
+// redactBody redacts a body stored as text with given encoding, returning it encoded again
+func redactBody(redactor *redact.Redactor, text, encoding string) (string, string) {
+	body, err := DecodeBody(text, encoding)
+	if err != nil {
+		return text, encoding
+	}
+	return EncodeBody([]byte(redactor.Body(string(body))))
+}
+
+// CreateRequest with given content
+func CreateRequest(method, uri string, headers http.Header, body []byte) Request {
+	request := Request{
+		Method:  method,
+		URI:     uri,
+		Headers: headers,
+	}
+	request.Body, request.BodyEncoding = EncodeBody(body)
+	return request
+}
+
+// RawBody returns the body as it was received
+func (r Request) RawBody() ([]byte, error) {
+	return DecodeBody(r.Body, r.BodyEncoding)
 }
 
-func CreateInteractions(primary Interaction, secondary *Interaction, candidate Interaction, differenceMode string, result bool) Interactions {
+// CreateInteraction with the response of an upstream. Cookies are stored in Set-Cookie format.
+func CreateInteraction(url string, content []byte, statusCode int, headers http.Header, cookies []*http.Cookie, elapsedTime time.Duration) Interaction {
+	interaction := Interaction{
+		URL:         url,
+		StatusCode:  statusCode,
+		Headers:     headers,
+		ElapsedTime: elapsedTime,
+	}
+	interaction.Content, interaction.ContentEncoding = EncodeBody(content)
+
+	for _, cookie := range cookies {
+		interaction.Cookies = append(interaction.Cookies, cookie.String())
+	}
+
+	return interaction
+}
+
+// CreateInteractions with all the exchange. Secondary is nil if noise detection is not enabled.
+func CreateInteractions(request Request, primary Interaction, secondary *Interaction, candidate Interaction, differenceMode string, result bool) Interactions {
 	interactions := Interactions{
+		Request:        request,
 		Primary:        primary,
 		Candidate:      candidate,
 		DifferenceMode: differenceMode,
@@ -46,8 +147,32 @@ func CreateInteractions(primary Interaction, secondary *Interaction, candidate I
 	return interactions
 }
 
+// Redact returns a copy of interactions without sensitive data
+func (i Interactions) Redact(redactor *redact.Redactor) Interactions {
+	i.Request.URI = redactor.Text(i.Request.URI)
+	i.Request.Headers = redactor.Headers(i.Request.Headers)
+	i.Request.Body, i.Request.BodyEncoding = redactBody(redactor, i.Request.Body, i.Request.BodyEncoding)
+	i.Primary = i.Primary.Redact(redactor)
+	i.Candidate = i.Candidate.Redact(redactor)
+	if i.Secondary != nil {
+		secondary := i.Secondary.Redact(redactor)
+		i.Secondary = &secondary
+	}
+	return i
+}
+
+// Redact returns a copy of interaction without sensitive data
+func (i Interaction) Redact(redactor *redact.Redactor) Interaction {
+	i.URL = redactor.Text(i.URL)
+	i.Content, i.ContentEncoding = redactBody(redactor, i.Content, i.ContentEncoding)
+	i.Headers = redactor.Headers(i.Headers)
+	i.Cookies = redactor.Cookies(i.Cookies)
+	return i
+}
+
+// ExportToFile appends interactions as a JSON line to file. Use InteractionLog to write them off the request path.
 func ExportToFile(file string, interactions Interactions) error {
-	f, err := os.Create(file)
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 
 	if err != nil {
 		return err
@@ -58,3 +183,36 @@ func ExportToFile(file string, interactions Interactions) error {
 	w.Flush()
 	return err
 }
+
+// LoadInteractions reads all interactions of a stored log. Rotated logs compressed with gzip are supported.
+func LoadInteractions(file string) ([]Interactions, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if strings.HasSuffix(file, ".gz") {
+		compressed, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer compressed.Close()
+		reader = compressed
+	}
+
+	var interactions []Interactions
+	decoder := json.NewDecoder(reader)
+	for {
+		interaction := Interactions{}
+		err := decoder.Decode(&interaction)
+		if err == io.EOF {
+			return interactions, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Interaction %d of %s is not valid. %s", len(interactions)+1, file, err.Error())
+		}
+		interactions = append(interactions, interaction)
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/lordofthejars/diferencia/core"
 	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/redact"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -76,6 +78,70 @@ var _ = Describe("File Exporter", func() {
 			})
 		})
 
+		Context("With complete exchange", func() {
+			It("should write request, headers, cookies and timings", func() {
+				tmpfile, err := ioutil.TempFile("", "log.json")
+
+				if err != nil {
+					Fail(fmt.Sprintf("Unable to create temporal file. Reason: %q", err))
+				}
+				defer os.Remove(tmpfile.Name())
+
+				request := exporter.CreateRequest(http.MethodPost, "/users?page=1", http.Header{"Content-Type": []string{"application/json"}}, []byte(`{"name": "Alex"}`))
+				response := exporter.CreateInteraction("http://localhost:8080/users?page=1", []byte(`{"id": 1}`), 201,
+					http.Header{"Location": []string{"/users/1"}}, []*http.Cookie{{Name: "session", Value: "abc"}}, 15*time.Millisecond)
+
+				interactions := exporter.CreateInteractions(request, response, &response, response, core.Strict.String(), true)
+				err = exporter.ExportToFile(tmpfile.Name(), interactions)
+				if err != nil {
+					Fail(fmt.Sprintf("Unable to export results. Reason: %q", err))
+				}
+
+				byt, err := ioutil.ReadFile(tmpfile.Name())
+				expectedInteractions := &exporter.Interactions{}
+				json.Unmarshal(byt, expectedInteractions)
+
+				Expect(expectedInteractions.Request.Method).Should(Equal(http.MethodPost))
+				Expect(expectedInteractions.Request.URI).Should(Equal("/users?page=1"))
+				Expect(expectedInteractions.Request.Headers.Get("Content-Type")).Should(Equal("application/json"))
+				Expect(expectedInteractions.Request.Body).Should(Equal(`{"name": "Alex"}`))
+				Expect(expectedInteractions.Primary.Headers.Get("Location")).Should(Equal("/users/1"))
+				Expect(expectedInteractions.Primary.Cookies).Should(Equal([]string{"session=abc"}))
+				Expect(expectedInteractions.Primary.ElapsedTime).Should(Equal(15 * time.Millisecond))
+				Expect(expectedInteractions.Secondary).ShouldNot(BeNil())
+			})
+		})
+
+		Context("With binary bodies", func() {
+			It("should keep them as they are", func() {
+				tmpfile, err := ioutil.TempFile("", "log.json")
+
+				if err != nil {
+					Fail(fmt.Sprintf("Unable to create temporal file. Reason: %q", err))
+				}
+				defer os.Remove(tmpfile.Name())
+
+				binary := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}
+				request := exporter.CreateRequest(http.MethodPost, "/images", nil, binary)
+				response := exporter.CreateInteraction("http://localhost:8080/images/1", binary, 200, nil, nil, 0)
+				interactions := exporter.CreateInteractions(request, response, nil, response, core.Strict.String(), true)
+				redactor, _ := redact.New(redact.Rules{Patterns: []string{"PNG"}})
+
+				err = exporter.ExportToFile(tmpfile.Name(), interactions)
+				Expect(err).Should(Succeed())
+				err = exporter.ExportToFile(tmpfile.Name(), interactions.Redact(redactor))
+				Expect(err).Should(Succeed())
+
+				loaded, err := exporter.LoadInteractions(tmpfile.Name())
+				Expect(err).Should(Succeed())
+				Expect(loaded[0].Request.BodyEncoding).Should(Equal(exporter.Base64Encoding))
+				Expect(loaded[0].Request.RawBody()).Should(Equal(binary))
+				Expect(loaded[0].Primary.ContentEncoding).Should(Equal(exporter.Base64Encoding))
+				Expect(loaded[0].Primary.RawContent()).Should(Equal(binary))
+				Expect(loaded[1].Primary.RawContent()).Should(Equal(append([]byte{0x89}, append([]byte(redact.Mask), 0xff, 0x00)...)))
+			})
+		})
+
 		Context("With Simple interactions", func() {
 			It("should write file", func() {
 				tmpfile, err := ioutil.TempFile("", "log.json")
@@ -108,4 +174,28 @@ var _ = Describe("File Exporter", func() {
 			})
 		})
 	})
+
+	Describe("Redact Interactions", func() {
+		Context("With sensitive data", func() {
+			It("should redact request and responses", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Headers: []string{"Authorization", "Set-Cookie"}, Pointers: []string{"/password"}})
+				request := exporter.CreateRequest(http.MethodPost, "/login", http.Header{"Authorization": []string{"Basic YWxleDoxMjM0"}}, []byte(`{"password": "1234"}`))
+				response := exporter.CreateInteraction("http://localhost:8080/login", []byte(`{"id": 1}`), 200,
+					nil, []*http.Cookie{{Name: "session", Value: "abc"}}, 0)
+				interactions := exporter.CreateInteractions(request, response, &response, response, core.Strict.String(), true)
+
+				// When
+				redacted := interactions.Redact(redactor)
+
+				// Then
+				Expect(redacted.Request.Headers.Get("Authorization")).Should(Equal(redact.Mask))
+				Expect(redacted.Request.Body).Should(MatchJSON(`{"password": "[REDACTED]"}`))
+				Expect(redacted.Primary.Cookies).Should(Equal([]string{"session=" + redact.Mask}))
+				Expect(redacted.Secondary.Cookies).Should(Equal([]string{"session=" + redact.Mask}))
+				Expect(interactions.Request.Body).Should(Equal(`{"password": "1234"}`))
+			})
+		})
+	})
 })
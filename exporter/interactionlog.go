@@ -0,0 +1,364 @@
+package exporter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// InteractionLogFile is the name of the log when a directory is given
+	InteractionLogFile = "interactions.jsonl"
+	// number of interactions waiting to be written before dropping new ones
+	interactionLogBuffer = 1024
+	flushInterval        = time.Second
+	backupTimeFormat     = "2006-01-02T15-04-05.000000000"
+	compressedExtension  = ".gz"
+)
+
+// RotationPolicy configures when the interaction log is rotated and how many rotated files are kept
+type RotationPolicy struct {
+	// MaxSize in bytes of the log before rotating it. 0 means no size rotation.
+	MaxSize int64
+	// MaxAge of the log before rotating it. 0 means no time rotation.
+	MaxAge time.Duration
+	// Compress rotated files with gzip
+	Compress bool
+	// MaxBackups is the number of rotated files kept. 0 means all of them are kept.
+	MaxBackups int
+}
+
+// InteractionLog appends each interaction as a JSON line. Interactions are written by a background goroutine.
+type InteractionLog struct {
+	sync.RWMutex
+	path    string
+	policy  RotationPolicy
+	entries chan Interactions
+	done    chan struct{}
+	closed  bool
+
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	opened time.Time
+}
+
+// NewInteractionLog opens the log at path, or at path/interactions.jsonl if path is a directory, and starts the background writer
+func NewInteractionLog(path string, policy RotationPolicy) (*InteractionLog, error) {
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, InteractionLogFile)
+	}
+
+	l := &InteractionLog{
+		path:    path,
+		policy:  policy,
+		entries: make(chan Interactions, interactionLogBuffer),
+		done:    make(chan struct{}),
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	go l.run()
+
+	return l, nil
+}
+
+// Path of the current log file
+func (l *InteractionLog) Path() string {
+	return l.path
+}
+
+// Write queues the interaction to be written. It never blocks; if the writer cannot keep up the interaction is dropped and false is returned.
+func (l *InteractionLog) Write(interactions Interactions) bool {
+	if l == nil {
+		return false
+	}
+
+	l.RLock()
+	defer l.RUnlock()
+
+	if l.closed {
+		return false
+	}
+
+	select {
+	case l.entries <- interactions:
+		return true
+	default:
+		logrus.Warnf("Interaction log %s is full, interaction of %s has been dropped", l.path, interactions.Primary.URL)
+		return false
+	}
+}
+
+// Close writes pending interactions and closes the log
+func (l *InteractionLog) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.Lock()
+	if l.closed {
+		l.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.entries)
+	l.Unlock()
+
+	<-l.done
+
+	if l.file == nil {
+		return nil
+	}
+	if err := l.writer.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+func (l *InteractionLog) run() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case interactions, ok := <-l.entries:
+			if !ok {
+				return
+			}
+			if err := l.write(interactions); err != nil {
+				logrus.Errorf("Error writing interaction to %s. %s", l.path, err.Error())
+			}
+			// Flushes as soon as there is nothing pending so log is readable
+			if len(l.entries) == 0 {
+				l.flush()
+			}
+		case <-ticker.C:
+			l.flush()
+			if l.policy.MaxAge > 0 && l.size > 0 && time.Since(l.opened) >= l.policy.MaxAge {
+				if err := l.rotate(); err != nil {
+					logrus.Errorf("Error rotating %s. %s", l.path, err.Error())
+				}
+			}
+		}
+	}
+}
+
+func (l *InteractionLog) write(interactions Interactions) error {
+	line, err := json.Marshal(interactions)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if l.shouldRotate(len(line)) {
+		if err := l.rotate(); err != nil {
+			// Interaction is still written to the current log
+			logrus.Errorf("Error rotating %s. %s", l.path, err.Error())
+		}
+	}
+
+	// Log could not be opened again after a failure, so it is retried
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.writer.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+func (l *InteractionLog) flush() {
+	if l.file == nil {
+		return
+	}
+	if err := l.writer.Flush(); err != nil {
+		logrus.Errorf("Error flushing %s. %s", l.path, err.Error())
+	}
+}
+
+func (l *InteractionLog) shouldRotate(next int) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.policy.MaxSize > 0 && l.size+int64(next) > l.policy.MaxSize {
+		return true
+	}
+	return l.policy.MaxAge > 0 && time.Since(l.opened) >= l.policy.MaxAge
+}
+
+func (l *InteractionLog) open() error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.writer = bufio.NewWriter(file)
+	l.size = info.Size()
+	l.opened = time.Now()
+
+	return nil
+}
+
+// rotate renames current log to a timestamped backup, compressing it if required, and opens a new one.
+// If it fails, current log is opened again so interactions keep being written.
+func (l *InteractionLog) rotate() error {
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return l.reopen(err)
+	}
+
+	backup := l.backupName(time.Now())
+	if err := os.Rename(l.path, backup); err != nil {
+		return l.reopen(err)
+	}
+
+	if err := l.open(); err != nil {
+		// Backup is the current log again
+		if renameErr := os.Rename(backup, l.path); renameErr != nil {
+			logrus.Errorf("Error restoring %s from %s. %s", l.path, backup, renameErr.Error())
+		}
+		return l.reopen(err)
+	}
+
+	if l.policy.Compress {
+		if err := compress(backup); err != nil {
+			logrus.Errorf("Error compressing %s. %s", backup, err.Error())
+		}
+	}
+
+	l.removeOldBackups()
+
+	return nil
+}
+
+// reopen opens current log after a failed rotation and returns cause. If it cannot be opened, next write tries again.
+func (l *InteractionLog) reopen(cause error) error {
+	l.file = nil
+	l.size = 0
+	if err := l.open(); err != nil {
+		logrus.Errorf("Error opening %s again. %s", l.path, err.Error())
+	}
+	return cause
+}
+
+// backupName returns a not used name of a rotated file
+func (l *InteractionLog) backupName(t time.Time) string {
+	extension := filepath.Ext(l.path)
+	for {
+		name := strings.TrimSuffix(l.path, extension) + "-" + t.Format(backupTimeFormat) + extension
+		if !exists(name) && !exists(name+compressedExtension) {
+			return name
+		}
+		t = t.Add(time.Nanosecond)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Backups returns rotated files from oldest to newest
+func (l *InteractionLog) Backups() []string {
+	extension := filepath.Ext(l.path)
+	prefix := strings.TrimSuffix(l.path, extension) + "-"
+
+	candidates, _ := filepath.Glob(prefix + "*")
+
+	var backups []string
+	for _, candidate := range candidates {
+		if isBackup(strings.TrimPrefix(candidate, prefix), extension) {
+			backups = append(backups, candidate)
+		}
+	}
+
+	// timestamp format sorts lexicographically
+	sort.Strings(backups)
+	return backups
+}
+
+// isBackup checks if name is a rotation timestamp followed by extension and optionally compressed, so other files sharing the prefix are never removed
+func isBackup(name, extension string) bool {
+	name = strings.TrimSuffix(name, compressedExtension)
+	if !strings.HasSuffix(name, extension) {
+		return false
+	}
+	_, err := time.Parse(backupTimeFormat, strings.TrimSuffix(name, extension))
+	return err == nil
+}
+
+func (l *InteractionLog) removeOldBackups() {
+	if l.policy.MaxBackups <= 0 {
+		return
+	}
+
+	backups := l.Backups()
+	for len(backups) > l.policy.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			logrus.Errorf("Error removing old interaction log %s. %s", backups[0], err.Error())
+		}
+		backups = backups[1:]
+	}
+}
+
+// compress gzips file and removes the uncompressed one
+func compress(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.Create(path + compressedExtension)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(target)
+	if _, err := io.Copy(gz, source); err != nil {
+		target.Close()
+		os.Remove(target.Name())
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		target.Close()
+		os.Remove(target.Name())
+		return err
+	}
+	if err := target.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,237 @@
+package exporter_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Interaction Log", func() {
+
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "interactions")
+		if err != nil {
+			Fail(fmt.Sprintf("Unable to create temporal directory. Reason: %q", err))
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Append interactions", func() {
+		Context("With a directory", func() {
+			It("should write one JSON line for each interaction", func() {
+
+				// Given
+				log, err := exporter.NewInteractionLog(dir, exporter.RotationPolicy{})
+				Expect(err).Should(Succeed())
+
+				// When
+				Expect(log.Write(interaction("http://localhost/1"))).Should(BeTrue())
+				Expect(log.Write(interaction("http://localhost/2"))).Should(BeTrue())
+				Expect(log.Close()).Should(Succeed())
+
+				// Then
+				Expect(log.Path()).Should(Equal(filepath.Join(dir, exporter.InteractionLogFile)))
+				file, _ := os.Open(log.Path())
+				defer file.Close()
+				Expect(readURLs(file)).Should(Equal([]string{"http://localhost/1", "http://localhost/2"}))
+			})
+
+			It("should keep previous interactions when reopened", func() {
+
+				// Given
+				log, _ := exporter.NewInteractionLog(dir, exporter.RotationPolicy{})
+				log.Write(interaction("http://localhost/1"))
+				log.Close()
+
+				// When
+				log, err := exporter.NewInteractionLog(dir, exporter.RotationPolicy{})
+				Expect(err).Should(Succeed())
+				log.Write(interaction("http://localhost/2"))
+				log.Close()
+
+				// Then
+				file, _ := os.Open(log.Path())
+				defer file.Close()
+				Expect(readURLs(file)).Should(HaveLen(2))
+			})
+		})
+
+		Context("With a closed log", func() {
+			It("should ignore interactions", func() {
+
+				// Given
+				log, _ := exporter.NewInteractionLog(filepath.Join(dir, "results.jsonl"), exporter.RotationPolicy{})
+				log.Close()
+
+				// When
+				written := log.Write(interaction("http://localhost/1"))
+
+				// Then
+				Expect(written).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe("Rotate interactions", func() {
+		Context("With size policy", func() {
+			It("should rotate and keep only the configured backups", func() {
+
+				// Given
+				line, _ := json.Marshal(interaction("http://localhost/1"))
+				log, err := exporter.NewInteractionLog(dir, exporter.RotationPolicy{MaxSize: int64(len(line) + 1), MaxBackups: 2})
+				Expect(err).Should(Succeed())
+
+				// When
+				for i := 0; i < 5; i++ {
+					log.Write(interaction(fmt.Sprintf("http://localhost/%d", i)))
+				}
+				Expect(log.Close()).Should(Succeed())
+
+				// Then
+				backups := log.Backups()
+				Expect(backups).Should(HaveLen(2))
+
+				current, _ := os.Open(log.Path())
+				defer current.Close()
+				Expect(readURLs(current)).Should(Equal([]string{"http://localhost/4"}))
+
+				newest, _ := os.Open(backups[1])
+				defer newest.Close()
+				Expect(readURLs(newest)).Should(Equal([]string{"http://localhost/3"}))
+			})
+
+			It("should keep writing when rotation fails", func() {
+
+				// Given
+				line, _ := json.Marshal(interaction("http://localhost/1"))
+				log, err := exporter.NewInteractionLog(dir, exporter.RotationPolicy{MaxSize: int64(len(line) + 1)})
+				Expect(err).Should(Succeed())
+				log.Write(interaction("http://localhost/1"))
+				// Rename of a removed log fails
+				Expect(os.Remove(log.Path())).Should(Succeed())
+
+				// When
+				log.Write(interaction("http://localhost/2"))
+				log.Write(interaction("http://localhost/3"))
+				Expect(log.Close()).Should(Succeed())
+
+				// Then
+				backups := log.Backups()
+				Expect(backups).Should(HaveLen(1))
+
+				backup, _ := os.Open(backups[0])
+				defer backup.Close()
+				Expect(readURLs(backup)).Should(Equal([]string{"http://localhost/2"}))
+
+				current, _ := os.Open(log.Path())
+				defer current.Close()
+				Expect(readURLs(current)).Should(Equal([]string{"http://localhost/3"}))
+			})
+
+			It("should not remove other files sharing the name", func() {
+
+				// Given
+				others := []string{filepath.Join(dir, "interactions-old.jsonl"), filepath.Join(dir, "interactions-1.jsonl.gz")}
+				for _, other := range others {
+					Expect(ioutil.WriteFile(other, []byte("other"), 0644)).Should(Succeed())
+				}
+				line, _ := json.Marshal(interaction("http://localhost/1"))
+				log, _ := exporter.NewInteractionLog(dir, exporter.RotationPolicy{MaxSize: int64(len(line) + 1), MaxBackups: 1})
+
+				// When
+				for i := 0; i < 3; i++ {
+					log.Write(interaction(fmt.Sprintf("http://localhost/%d", i)))
+				}
+				Expect(log.Close()).Should(Succeed())
+
+				// Then
+				Expect(log.Backups()).Should(HaveLen(1))
+				Expect(log.Backups()).ShouldNot(ContainElement(others[0]))
+				for _, other := range others {
+					Expect(other).Should(BeAnExistingFile())
+				}
+			})
+
+			It("should compress rotated files", func() {
+
+				// Given
+				line, _ := json.Marshal(interaction("http://localhost/1"))
+				log, _ := exporter.NewInteractionLog(dir, exporter.RotationPolicy{MaxSize: int64(len(line) + 1), Compress: true})
+
+				// When
+				log.Write(interaction("http://localhost/1"))
+				log.Write(interaction("http://localhost/2"))
+				Expect(log.Close()).Should(Succeed())
+
+				// Then
+				backups := log.Backups()
+				Expect(backups).Should(HaveLen(1))
+				Expect(strings.HasSuffix(backups[0], ".jsonl.gz")).Should(BeTrue())
+
+				compressed, _ := os.Open(backups[0])
+				defer compressed.Close()
+				reader, err := gzip.NewReader(compressed)
+				Expect(err).Should(Succeed())
+				Expect(readURLs(reader)).Should(Equal([]string{"http://localhost/1"}))
+			})
+		})
+	})
+
+	Describe("Load interactions", func() {
+		Context("With current and compressed logs", func() {
+			It("should read all interactions", func() {
+
+				// Given
+				line, _ := json.Marshal(interaction("http://localhost/1"))
+				log, _ := exporter.NewInteractionLog(dir, exporter.RotationPolicy{MaxSize: int64(len(line) + 1), Compress: true})
+				log.Write(interaction("http://localhost/1"))
+				log.Write(interaction("http://localhost/2"))
+				log.Close()
+
+				// When
+				compressed, compressedErr := exporter.LoadInteractions(log.Backups()[0])
+				current, currentErr := exporter.LoadInteractions(log.Path())
+
+				// Then
+				Expect(compressedErr).Should(Succeed())
+				Expect(currentErr).Should(Succeed())
+				Expect(compressed).Should(HaveLen(1))
+				Expect(compressed[0].Primary.URL).Should(Equal("http://localhost/1"))
+				Expect(current[0].Primary.URL).Should(Equal("http://localhost/2"))
+			})
+		})
+	})
+})
+
+func interaction(url string) exporter.Interactions {
+	request := exporter.CreateRequest("GET", "/", nil, nil)
+	response := exporter.CreateInteraction(url, []byte(`{"page": 1}`), 200, nil, nil, 0)
+	return exporter.CreateInteractions(request, response, nil, response, "Strict", true)
+}
+
+func readURLs(reader io.Reader) []string {
+	var urls []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		interactions := exporter.Interactions{}
+		Expect(json.Unmarshal(scanner.Bytes(), &interactions)).Should(Succeed())
+		urls = append(urls, interactions.Primary.URL)
+	}
+	return urls
+}
@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// upper bound of the first latency bucket
+	latencyBase = 100 * time.Microsecond
+	// each latency bucket is 20% wider than the previous one, so estimated percentiles are at most 20% above real ones
+	latencyGrowth = 1.2
+	// last bucket holds any duration greater than 100µs * 1.2^79, around 3 minutes
+	latencyBuckets = 80
+)
+
+// LatencyHistogram counts durations in buckets that grow exponentially, so percentiles are estimated with bounded memory and histograms can be merged
+type LatencyHistogram struct {
+	// Counts of each bucket, trailing empty buckets are not stored
+	Counts []int64 `json:"counts,omitempty"`
+}
+
+// Latency percentiles in milliseconds
+type Latency struct {
+	P50 float32 `json:"p50"`
+	P90 float32 `json:"p90"`
+	P99 float32 `json:"p99"`
+}
+
+// latencyBucket returns the index of the bucket of d
+func latencyBucket(d time.Duration) int {
+	if d <= latencyBase {
+		return 0
+	}
+	bucket := int(math.Ceil(math.Log(float64(d)/float64(latencyBase)) / math.Log(latencyGrowth)))
+	if bucket >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return bucket
+}
+
+// LatencyBucketBound returns the upper bound of the bucket at given index
+func LatencyBucketBound(bucket int) time.Duration {
+	return time.Duration(float64(latencyBase) * math.Pow(latencyGrowth, float64(bucket)))
+}
+
+// Add a duration
+func (h *LatencyHistogram) Add(d time.Duration) {
+	bucket := latencyBucket(d)
+	if bucket >= len(h.Counts) {
+		counts := make([]int64, bucket+1)
+		copy(counts, h.Counts)
+		h.Counts = counts
+	}
+	h.Counts[bucket]++
+}
+
+// Merge adds all durations of other
+func (h *LatencyHistogram) Merge(other LatencyHistogram) {
+	if len(other.Counts) > len(h.Counts) {
+		counts := make([]int64, len(other.Counts))
+		copy(counts, h.Counts)
+		h.Counts = counts
+	}
+	for bucket, count := range other.Counts {
+		h.Counts[bucket] += count
+	}
+}
+
+// Count of added durations
+func (h LatencyHistogram) Count() int64 {
+	var count int64
+	for _, c := range h.Counts {
+		count += c
+	}
+	return count
+}
+
+// Percentile returns the upper bound of the bucket containing the given percentile (0-100). It is 0 if there are no durations.
+func (h LatencyHistogram) Percentile(percentile float64) time.Duration {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(percentile / 100 * float64(count)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for bucket, c := range h.Counts {
+		seen += c
+		if seen >= rank {
+			return LatencyBucketBound(bucket)
+		}
+	}
+	return LatencyBucketBound(len(h.Counts) - 1)
+}
+
+// Latency returns p50, p90 and p99 of the histogram
+func (h LatencyHistogram) Latency() Latency {
+	return Latency{
+		P50: milliseconds(h.Percentile(50)),
+		P90: milliseconds(h.Percentile(90)),
+		P99: milliseconds(h.Percentile(99)),
+	}
+}
+
+// milliseconds rounded to two decimals
+func milliseconds(d time.Duration) float32 {
+	return float32(math.Round(float64(d)/float64(time.Millisecond)*100) / 100)
+}
+
+// clone returns a copy that can be modified without side effects
+func (h LatencyHistogram) clone() LatencyHistogram {
+	if h.Counts == nil {
+		return h
+	}
+	counts := make([]int64, len(h.Counts))
+	copy(counts, h.Counts)
+	return LatencyHistogram{Counts: counts}
+}
@@ -0,0 +1,96 @@
+package exporter_test
+
+import (
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Latency", func() {
+
+	Describe("Latency histogram", func() {
+		Context("With durations", func() {
+			It("should estimate percentiles within bucket precision", func() {
+
+				// Given
+				histogram := exporter.LatencyHistogram{}
+
+				// When
+				for i := 1; i <= 100; i++ {
+					histogram.Add(time.Duration(i) * time.Millisecond)
+				}
+
+				// Then
+				Expect(histogram.Count()).Should(Equal(int64(100)))
+				Expect(histogram.Percentile(50)).Should(BeNumerically(">=", 50*time.Millisecond))
+				Expect(histogram.Percentile(50)).Should(BeNumerically("<=", 60*time.Millisecond))
+				Expect(histogram.Percentile(99)).Should(BeNumerically(">=", 99*time.Millisecond))
+				Expect(histogram.Percentile(99)).Should(BeNumerically("<=", 120*time.Millisecond))
+			})
+
+			It("should merge histograms", func() {
+
+				// Given
+				fast := exporter.LatencyHistogram{}
+				fast.Add(time.Millisecond)
+				slow := exporter.LatencyHistogram{}
+				slow.Add(time.Second)
+				slow.Add(time.Second)
+
+				// When
+				fast.Merge(slow)
+
+				// Then
+				Expect(fast.Count()).Should(Equal(int64(3)))
+				Expect(fast.Percentile(10)).Should(BeNumerically("<", 2*time.Millisecond))
+				Expect(fast.Percentile(90)).Should(BeNumerically(">=", time.Second))
+			})
+		})
+
+		Context("Without durations", func() {
+			It("should return zero percentiles", func() {
+				Expect(exporter.LatencyHistogram{}.Latency()).Should(Equal(exporter.Latency{}))
+			})
+		})
+	})
+
+	Describe("Latency stats", func() {
+		Context("With equal and different comparisons", func() {
+			It("should include all comparisons in averages and percentiles and count slow ones", func() {
+
+				// Given
+				stats := exporter.NewURLCounterMap()
+
+				// When
+				stats.IncSuccess("GET", "/a", exporter.Observation{PrimaryElapsedTime: 10 * time.Millisecond, CandidateElapsedTime: 10 * time.Millisecond, PrimaryStatus: 200, CandidateStatus: 200})
+				stats.IncErr("GET", "/a", exporter.Observation{PrimaryElapsedTime: 10 * time.Millisecond, CandidateElapsedTime: 300 * time.Millisecond, PrimaryStatus: 200, CandidateStatus: 200, Slow: true}, exporter.ErrorData{FullURI: "/a"})
+
+				// Then
+				entry := stats.FindEntry("GET", "/a")
+				Expect(entry.Slow).Should(Equal(1))
+				Expect(entry.AverageCandidateDuration).Should(Equal(float32(155)))
+				Expect(entry.CandidateLatency.P99).Should(BeNumerically(">=", 300))
+				Expect(entry.PrimaryLatency.P99).Should(BeNumerically("<", 12))
+			})
+
+			It("should keep latencies when exporting and importing", func() {
+
+				// Given
+				stats := exporter.NewURLCounterMap()
+				stats.IncErr("GET", "/a", exporter.Observation{PrimaryElapsedTime: 10 * time.Millisecond, CandidateElapsedTime: 300 * time.Millisecond, PrimaryStatus: 200, CandidateStatus: 200, Slow: true}, exporter.ErrorData{FullURI: "/a"})
+				imported := exporter.NewURLCounterMap()
+
+				// When
+				imported.Restore(stats.Snapshot(), true)
+				imported.Restore(stats.Snapshot(), true)
+
+				// Then
+				entry := imported.FindEntry("GET", "/a")
+				Expect(entry.Slow).Should(Equal(2))
+				Expect(entry.CandidateLatency).Should(Equal(stats.FindEntry("GET", "/a").CandidateLatency))
+			})
+		})
+	})
+})
@@ -6,6 +6,10 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/lordofthejars/diferencia/redact"
+	"github.com/lordofthejars/diferencia/significance"
+	"github.com/sirupsen/logrus"
 )
 
 // URLCall contains the tuple Http Method Path
@@ -21,6 +25,29 @@ type CallData struct {
 	ErrorDetails              []ErrorData   `json:"errorDetails"`
 	PrimaryDurationAllCalls   time.Duration `json:"-"`
 	CandidateDurationAllCalls time.Duration `json:"-"`
+	// Slow counts comparisons where candidate exceeds the latency budget, whatever the result of the comparison is
+	Slow             int              `json:"slow"`
+	PrimaryLatency   LatencyHistogram `json:"-"`
+	CandidateLatency LatencyHistogram `json:"-"`
+	// Number of responses whose status code is not 2xx, including failed calls
+	PrimaryNon2xx   int `json:"-"`
+	CandidateNon2xx int `json:"-"`
+	// Number of failed calls by error type
+	PrimaryFailures   map[string]int `json:"-"`
+	CandidateFailures map[string]int `json:"-"`
+}
+
+// Observation of primary and candidate responses of a comparison, equal or not
+type Observation struct {
+	PrimaryElapsedTime   time.Duration
+	CandidateElapsedTime time.Duration
+	PrimaryStatus        int
+	CandidateStatus      int
+	// Error types of upstreams that could not be called, empty if they responded
+	PrimaryFailure   string
+	CandidateFailure string
+	// Slow is set if candidate exceeds the latency budget
+	Slow bool
 }
 
 // ErrorData to hold all info when an error occurs
@@ -31,6 +58,20 @@ type ErrorData struct {
 	HeaderDiff      string      `json:"headerDiff,omitempty"`
 	BodyDiff        string      `json:"bodyDiff,omitempty"`
 	StatusDiff      string      `json:"statusDiff,omitempty"`
+	TransportDiff   string      `json:"transportDiff,omitempty"`
+	Signature       string      `json:"signature,omitempty"`
+	Occurrences     int         `json:"occurrences,omitempty"`
+}
+
+// Redact returns a copy of error data without sensitive data. Diffs are only redacted with patterns and header names, since they are not JSON documents.
+func (e ErrorData) Redact(redactor *redact.Redactor) ErrorData {
+	e.FullURI = redactor.Text(e.FullURI)
+	e.OriginalBody = redactor.Body(e.OriginalBody)
+	e.OriginalHeaders = redactor.Headers(e.OriginalHeaders)
+	e.HeaderDiff = redactor.HeadersDiff(e.HeaderDiff)
+	e.BodyDiff = redactor.Text(e.BodyDiff)
+	e.StatusDiff = redactor.Text(e.StatusDiff)
+	return e
 }
 
 // IncError increments the error counter
@@ -53,6 +94,67 @@ func (c *CallData) IncAverageCandidateTime(d time.Duration) {
 	c.CandidateDurationAllCalls += d
 }
 
+// Observe adds durations and status codes of primary and candidate of a comparison, counting it as slow if required
+func (c *CallData) Observe(observation Observation) {
+	c.IncAveragePrimaryTime(observation.PrimaryElapsedTime)
+	c.IncAverageCandidateTime(observation.CandidateElapsedTime)
+	c.PrimaryLatency.Add(observation.PrimaryElapsedTime)
+	c.CandidateLatency.Add(observation.CandidateElapsedTime)
+	if !isSuccessful(observation.PrimaryStatus) {
+		c.PrimaryNon2xx++
+	}
+	if !isSuccessful(observation.CandidateStatus) {
+		c.CandidateNon2xx++
+	}
+	if len(observation.PrimaryFailure) > 0 {
+		c.PrimaryFailures = addFailures(c.PrimaryFailures, map[string]int{observation.PrimaryFailure: 1})
+	}
+	if len(observation.CandidateFailure) > 0 {
+		c.CandidateFailures = addFailures(c.CandidateFailures, map[string]int{observation.CandidateFailure: 1})
+	}
+	if observation.Slow {
+		c.Slow++
+	}
+}
+
+// observed returns the number of comparisons whose durations are added, successful or not.
+// Stats stored before durations were observed for every comparison only added durations of successful ones.
+func (c CallData) observed() int64 {
+	if count := c.PrimaryLatency.Count(); count > 0 {
+		return count
+	}
+	return int64(c.Success)
+}
+
+// addFailures adds counters of failures by error type, creating failures map if required
+func addFailures(failures, other map[string]int) map[string]int {
+	if len(other) == 0 {
+		return failures
+	}
+	if failures == nil {
+		failures = make(map[string]int)
+	}
+	for errorType, count := range other {
+		failures[errorType] += count
+	}
+	return failures
+}
+
+func isSuccessful(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// clone returns a copy that can be modified without changing c
+func (c CallData) clone() CallData {
+	cloned := c
+	cloned.ErrorDetails = append([]ErrorData(nil), c.ErrorDetails...)
+	cloned.PrimaryLatency = c.PrimaryLatency.clone()
+	cloned.CandidateLatency = c.CandidateLatency.clone()
+	cloned.PrimaryFailures = addFailures(nil, c.PrimaryFailures)
+	cloned.CandidateFailures = addFailures(nil, c.CandidateFailures)
+	return cloned
+}
+
 // AppendErrorData adds a new Error Data
 func (c *CallData) AppendErrorData(errorData ErrorData) {
 	c.ErrorDetails = append(c.ErrorDetails, errorData)
@@ -61,7 +163,12 @@ func (c *CallData) AppendErrorData(errorData ErrorData) {
 // URLCounterMap is a type-safe and concurrent map storing for each URL the number of errors encountered
 type URLCounterMap struct {
 	sync.RWMutex
-	internal map[URLCall]CallData
+	store    Store
+	sampling ErrorSampling
+	// redactor of imported error details, as recorded ones are already redacted
+	redactor *redact.Redactor
+	// number of stored error details by endpoint, nil until first required
+	details map[URLCall]int
 }
 
 // Entry tuple for endpoint and number of errors
@@ -72,59 +179,137 @@ type Entry struct {
 	Success                  int         `json:"success"`
 	AveragePrimaryDuration   float32     `json:"averagePrimaryDuration"`
 	AverageCandidateDuration float32     `json:"averageCandidateDuration"`
+	Slow                     int         `json:"slow"`
+	PrimaryLatency           Latency     `json:"primaryLatency"`
+	CandidateLatency         Latency     `json:"candidateLatency"`
+	PrimaryNon2xx            int         `json:"primaryNon2xx"`
+	CandidateNon2xx          int         `json:"candidateNon2xx"`
+	// Failed calls by error type, like timeout or connection_refused
+	PrimaryFailures   map[string]int `json:"primaryFailures,omitempty"`
+	CandidateFailures map[string]int `json:"candidateFailures,omitempty"`
+	// LatencyTest is Mann-Whitney U test of primary and candidate durations
+	LatencyTest significance.Test `json:"latencyTest"`
+	// StatusTest is two-proportion test of primary and candidate non-2xx rates
+	StatusTest significance.Test `json:"statusTest"`
+	// Histograms of durations, to test several entries together
+	PrimaryHistogram   LatencyHistogram `json:"-"`
+	CandidateHistogram LatencyHistogram `json:"-"`
+}
+
+// Observed returns the number of comparisons averaged in durations
+func (e Entry) Observed() int {
+	if count := e.PrimaryHistogram.Count(); count > 0 {
+		return int(count)
+	}
+	return e.Success
 }
 
-// NewURLCounterMap creates a new instance of the map
+// NewURLCounterMap creates a new instance of the map backed by memory
 func NewURLCounterMap() *URLCounterMap {
+	return NewURLCounterMapWithStore(NewMemoryStore())
+}
+
+// NewURLCounterMapWithStore creates a new instance of the map backed by given store
+func NewURLCounterMapWithStore(store Store) *URLCounterMap {
 	return &URLCounterMap{
-		internal: make(map[URLCall]CallData),
+		store:    store,
+		sampling: ErrorSampling{}.normalize(),
 	}
 }
 
-// IncSuccess by 1 the success field and updates the average time
-func (m *URLCounterMap) IncSuccess(method, path string, primaryAverage, candidateAverage time.Duration) int {
+// SetErrorSampling changes how error details are stored from now on
+func (m *URLCounterMap) SetErrorSampling(sampling ErrorSampling) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.sampling = sampling.normalize()
+}
+
+// SetRedactor changes how error details imported from now on are redacted
+func (m *URLCounterMap) SetRedactor(redactor *redact.Redactor) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.redactor = redactor
+}
+
+// IncSuccess by 1 the success field, adding durations and status codes of the comparison to the endpoint with a single store write
+func (m *URLCounterMap) IncSuccess(method, path string, observation Observation) int {
 	m.Lock()
 	defer m.Unlock()
 	call := URLCall{method, path}
 
-	counter, ok := m.internal[call]
-	newCounter := counter
-	if ok {
-		counter.IncSuccess()
-		counter.IncAveragePrimaryTime(primaryAverage)
-		counter.IncAverageCandidateTime(candidateAverage)
-		newCounter = counter
-		m.internal[call] = newCounter
-	} else {
-		newCounter = CallData{PrimaryDurationAllCalls: primaryAverage, CandidateDurationAllCalls: candidateAverage, Success: 1}
-		m.internal[call] = newCounter
-	}
+	counter, _ := m.load(call)
+	counter.IncSuccess()
+	counter.Observe(observation)
+	m.save(call, counter)
 
-	return newCounter.Success
+	return counter.Success
 }
 
-// IncErr by 1 the error field
-func (m *URLCounterMap) IncErr(method, path string, errorData ErrorData) int {
+// IncErr by 1 the error field, storing error details and adding durations and status codes of the comparison to the endpoint with a single store write
+func (m *URLCounterMap) IncErr(method, path string, observation Observation, errorData ErrorData) int {
 
 	m.Lock()
 	defer m.Unlock()
 	call := URLCall{method, path}
 
-	counter, ok := m.internal[call]
-	newCounter := counter
+	counter, _ := m.load(call)
+	counter.IncError()
+	counter.Observe(observation)
+	m.sampling.add(&counter, errorData)
+	m.save(call, counter)
 
-	if ok {
-		counter.IncError()
-		counter.AppendErrorData(errorData)
-		newCounter = counter
-		m.internal[call] = newCounter
-	} else {
-		newCounter = CallData{Errors: 1, PrimaryDurationAllCalls: 0, CandidateDurationAllCalls: 0}
-		newCounter.AppendErrorData(errorData)
-		m.internal[call] = newCounter
+	m.detailCounts()[call] = len(counter.ErrorDetails)
+	m.enforceMaxTotal()
+
+	return counter.Errors
+}
+
+// detailCounts returns the number of stored details by endpoint
+func (m *URLCounterMap) detailCounts() map[URLCall]int {
+	if m.details == nil {
+		m.details = make(map[URLCall]int)
+		for key, value := range m.all() {
+			m.details[key] = len(value.ErrorDetails)
+		}
 	}
+	return m.details
+}
+
+// enforceMaxTotal removes the oldest details of the endpoints storing more details until the global limit is honoured
+func (m *URLCounterMap) enforceMaxTotal() {
+	counts := m.detailCounts()
 
-	return newCounter.Errors
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	for total > m.sampling.MaxTotal {
+		var biggest URLCall
+		for key, count := range counts {
+			if count > counts[biggest] {
+				biggest = key
+			}
+		}
+
+		counter, _ := m.load(biggest)
+		drop := total - m.sampling.MaxTotal
+		if drop > len(counter.ErrorDetails) {
+			drop = len(counter.ErrorDetails)
+		}
+		if drop == 0 {
+			// counts are out of sync with store
+			m.details = nil
+			return
+		}
+		counter.ErrorDetails = append([]ErrorData(nil), counter.ErrorDetails[drop:]...)
+		m.save(biggest, counter)
+
+		counts[biggest] = len(counter.ErrorDetails)
+		total -= drop
+	}
 }
 
 // Get count for given method, path
@@ -132,9 +317,8 @@ func (m *URLCounterMap) Get(method, path string) (CallData, bool) {
 	m.RLock()
 	defer m.RUnlock()
 	call := URLCall{method, path}
-	result, ok := m.internal[call]
 
-	return result, ok
+	return m.load(call)
 }
 
 // Keys returns the list of keys of map
@@ -143,7 +327,7 @@ func (m *URLCounterMap) Keys() []URLCall {
 	defer m.RUnlock()
 
 	var keys []URLCall
-	for key := range m.internal {
+	for key := range m.all() {
 		keys = append(keys, key)
 	}
 
@@ -152,9 +336,11 @@ func (m *URLCounterMap) Keys() []URLCall {
 
 // FindEntry finds an entry by method and path
 func (m *URLCounterMap) FindEntry(method, path string) Entry {
+	m.RLock()
+	defer m.RUnlock()
 
 	url := URLCall{method, path}
-	result, ok := m.internal[url]
+	result, ok := m.load(url)
 
 	if ok {
 		return convert(url, result)
@@ -170,7 +356,7 @@ func (m *URLCounterMap) Entries() []Entry {
 
 	var entries []Entry
 
-	for key, value := range m.internal {
+	for key, value := range m.all() {
 		entries = append(entries, convert(key, value))
 	}
 
@@ -182,70 +368,122 @@ func (m *URLCounterMap) Entries() []Entry {
 	return entries
 }
 
+// Close underlying store
+func (m *URLCounterMap) Close() error {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.store.Close()
+}
+
+func (m *URLCounterMap) load(call URLCall) (CallData, bool) {
+	data, ok, err := m.store.Load(call)
+	if err != nil {
+		logrus.Errorf("Error loading stats of %s %s. %s", call.Method, call.Path, err.Error())
+	}
+	return data, ok
+}
+
+func (m *URLCounterMap) save(call URLCall, data CallData) {
+	if err := m.store.Save(call, data); err != nil {
+		logrus.Errorf("Error saving stats of %s %s. %s", call.Method, call.Path, err.Error())
+	}
+}
+
+func (m *URLCounterMap) all() map[URLCall]CallData {
+	all, err := m.store.All()
+	if err != nil {
+		logrus.Errorf("Error loading stats. %s", err.Error())
+	}
+	return all
+}
+
 func convert(key URLCall, value CallData) (e Entry) {
 
 	primaryAverage := 0.0
 	candidateAverage := 0.0
 
-	if value.Success > 0 {
-		primaryAverage = float64(value.PrimaryDurationAllCalls.Nanoseconds() / int64(value.Success))
+	if observed := value.observed(); observed > 0 {
+		primaryAverage = float64(value.PrimaryDurationAllCalls.Nanoseconds() / observed)
 		primaryAverage = (float64(primaryAverage) / float64(1000000))
-	}
-
-	if value.Success > 0 {
-		candidateAverage = float64(value.CandidateDurationAllCalls.Nanoseconds() / int64(value.Success))
+		candidateAverage = float64(value.CandidateDurationAllCalls.Nanoseconds() / observed)
 		candidateAverage = (float64(candidateAverage) / float64(1000000))
 	}
 
 	e = Entry{Endpoint: key, Errors: value.Errors, Success: value.Success,
 		AveragePrimaryDuration:   float32(math.Round(primaryAverage*100) / 100),
 		AverageCandidateDuration: float32(math.Round(candidateAverage*100) / 100),
-		ErrorDetails:             value.ErrorDetails}
+		ErrorDetails:             append([]ErrorData(nil), value.ErrorDetails...),
+		Slow:                     value.Slow,
+		PrimaryLatency:           value.PrimaryLatency.Latency(),
+		CandidateLatency:         value.CandidateLatency.Latency(),
+		PrimaryNon2xx:            value.PrimaryNon2xx,
+		CandidateNon2xx:          value.CandidateNon2xx,
+		PrimaryFailures:          addFailures(nil, value.PrimaryFailures),
+		CandidateFailures:        addFailures(nil, value.CandidateFailures),
+		LatencyTest:              significance.MannWhitney(value.PrimaryLatency.Counts, value.CandidateLatency.Counts),
+		StatusTest:               statusTest(value),
+		PrimaryHistogram:         value.PrimaryLatency.clone(),
+		CandidateHistogram:       value.CandidateLatency.clone()}
 
 	return
 }
 
-var stats = NewURLCounterMap()
-
 // Reset Removes all
 func (m *URLCounterMap) Reset() {
-	for key := range m.internal {
-		delete(m.internal, key)
-	}
-}
+	m.Lock()
+	defer m.Unlock()
 
-// Reset Removes all
-func Reset() {
-	stats.Reset()
+	if err := m.store.Clear(); err != nil {
+		logrus.Errorf("Error resetting stats. %s", err.Error())
+	}
+	m.details = nil
 }
 
-// Entries that are stored
-func Entries() []Entry {
-	return stats.Entries()
-}
+// ResetMatching removes entries matching given method and path. Empty method or path matches any value.
+// It returns the number of removed entries.
+func (m *URLCounterMap) ResetMatching(method, path string) int {
+	m.Lock()
+	defer m.Unlock()
 
-// FindEntry inside stats
-func FindEntry(method, path string) Entry {
-	return stats.FindEntry(method, path)
-}
+	removed := 0
+	for key := range m.all() {
+		if (len(method) == 0 || key.Method == method) && (len(path) == 0 || key.Path == path) {
+			if err := m.store.Delete(key); err != nil {
+				logrus.Errorf("Error resetting stats of %s %s. %s", key.Method, key.Path, err.Error())
+				continue
+			}
+			removed++
+		}
+	}
+	m.details = nil
 
-// IncrementSuccess stats with new success
-func IncrementSuccess(method, path string, primaryAverage, candidateAverage time.Duration) int {
-	return stats.IncSuccess(method, path, primaryAverage, candidateAverage)
+	return removed
 }
 
-// IncrementError stats with a new error
-func IncrementError(method, path, body, uri, headersDiff, bodyDiff, stautsDiff string, headers http.Header) int {
-	errorData := ErrorData{FullURI: uri, OriginalBody: body, OriginalHeaders: headers, HeaderDiff: headersDiff, BodyDiff: bodyDiff, StatusDiff: stautsDiff}
+// StatsHandler to return JSON with entries of the map or to reset them
+func (m *URLCounterMap) StatsHandler(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(m.Entries())
+	case http.MethodDelete:
+		removed := m.ResetMatching(r.URL.Query().Get("method"), r.URL.Query().Get("path"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(struct {
+			Removed int `json:"removed"`
+		}{removed})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
 
-	return stats.IncErr(method, path, errorData)
 }
 
-// StatsHandler to return JSON with stats
-func StatsHandler(w http.ResponseWriter, r *http.Request) {
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(stats.Entries())
-
+// statusTest compares non-2xx rates of all observed comparisons
+func statusTest(value CallData) significance.Test {
+	observed := int(value.PrimaryLatency.Count())
+	return significance.TwoProportions(value.PrimaryNon2xx, observed, value.CandidateNon2xx, observed)
 }
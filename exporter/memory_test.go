@@ -10,8 +10,10 @@ import (
 
 var _ = Describe("Memory Exporter", func() {
 
+	var stats *exporter.URLCounterMap
+
 	BeforeEach(func() {
-		exporter.Reset()
+		stats = exporter.NewURLCounterMap()
 	})
 
 	Describe("Store Interactions", func() {
@@ -21,10 +23,10 @@ var _ = Describe("Memory Exporter", func() {
 				// Given
 
 				// When
-				exporter.IncrementError("GET", "/", "", "", "", "", "", nil)
+				stats.IncErr("GET", "/", exporter.Observation{}, exporter.ErrorData{})
 
 				// Then
-				entries := exporter.Entries()
+				entries := stats.Entries()
 				Expect(entries).Should(HaveLen(1))
 				Expect(entries[0].Errors).Should(Equal(1))
 			})
@@ -33,11 +35,11 @@ var _ = Describe("Memory Exporter", func() {
 				// Given
 
 				// When
-				exporter.IncrementError("GET", "/a", "", "", "", "", "", nil)
-				exporter.IncrementError("GET", "/a", "", "", "", "", "", nil)
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{})
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{})
 
 				// Then
-				entries := exporter.Entries()
+				entries := stats.Entries()
 				Expect(entries).Should(HaveLen(1))
 				Expect(entries[0].Errors).Should(Equal(2))
 			})
@@ -49,10 +51,10 @@ var _ = Describe("Memory Exporter", func() {
 				primaryAverage, _ := time.ParseDuration("10ms")
 				candidateAverage, _ := time.ParseDuration("20ms")
 				// When
-				exporter.IncrementSuccess("GET", "/", primaryAverage, candidateAverage)
+				stats.IncSuccess("GET", "/", exporter.Observation{PrimaryElapsedTime: primaryAverage, CandidateElapsedTime: candidateAverage})
 
 				// Then
-				entries := exporter.Entries()
+				entries := stats.Entries()
 				Expect(entries).Should(HaveLen(1))
 				Expect(entries[0].Errors).Should(Equal(0))
 				Expect(entries[0].Success).Should(Equal(1))
@@ -68,11 +70,11 @@ var _ = Describe("Memory Exporter", func() {
 				primaryAverage2, _ := time.ParseDuration("30ms")
 				candidateAverage2, _ := time.ParseDuration("3ms")
 				// When
-				exporter.IncrementSuccess("GET", "/a", primaryAverage1, candidateAverage1)
-				exporter.IncrementSuccess("GET", "/a", primaryAverage2, candidateAverage2)
+				stats.IncSuccess("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage1, CandidateElapsedTime: candidateAverage1})
+				stats.IncSuccess("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage2, CandidateElapsedTime: candidateAverage2})
 
 				// Then
-				entries := exporter.Entries()
+				entries := stats.Entries()
 				Expect(entries).Should(HaveLen(1))
 				Expect(entries[0].Errors).Should(Equal(0))
 				Expect(entries[0].Success).Should(Equal(2))
@@ -87,16 +89,16 @@ var _ = Describe("Memory Exporter", func() {
 				primaryAverage, _ := time.ParseDuration("10ms")
 				candidateAverage, _ := time.ParseDuration("20ms")
 				// When
-				exporter.IncrementError("GET", "/", "", "", "", "", "", nil)
-				exporter.IncrementSuccess("GET", "/", primaryAverage, candidateAverage)
+				stats.IncErr("GET", "/", exporter.Observation{PrimaryElapsedTime: 3 * primaryAverage, CandidateElapsedTime: 2 * candidateAverage}, exporter.ErrorData{})
+				stats.IncSuccess("GET", "/", exporter.Observation{PrimaryElapsedTime: primaryAverage, CandidateElapsedTime: candidateAverage})
 
 				// Then
-				entries := exporter.Entries()
+				entries := stats.Entries()
 				Expect(entries).Should(HaveLen(1))
 				Expect(entries[0].Errors).Should(Equal(1))
 				Expect(entries[0].Success).Should(Equal(1))
-				Expect(entries[0].AveragePrimaryDuration).Should(Equal(float32(10)))
-				Expect(entries[0].AverageCandidateDuration).Should(Equal(float32(20)))
+				Expect(entries[0].AveragePrimaryDuration).Should(Equal(float32(20)))
+				Expect(entries[0].AverageCandidateDuration).Should(Equal(float32(30)))
 			})
 			It("should increment the map with endpoint", func() {
 
@@ -105,16 +107,16 @@ var _ = Describe("Memory Exporter", func() {
 				candidateAverage1, _ := time.ParseDuration("2ms")
 
 				// When
-				exporter.IncrementSuccess("GET", "/a", primaryAverage1, candidateAverage1)
-				exporter.IncrementError("GET", "/a", "", "", "", "", "", nil)
+				stats.IncSuccess("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage1, CandidateElapsedTime: candidateAverage1})
+				stats.IncErr("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage1, CandidateElapsedTime: 3 * candidateAverage1}, exporter.ErrorData{})
 
 				// Then
-				entries := exporter.Entries()
+				entries := stats.Entries()
 				Expect(entries).Should(HaveLen(1))
 				Expect(entries[0].Errors).Should(Equal(1))
 				Expect(entries[0].Success).Should(Equal(1))
 				Expect(entries[0].AveragePrimaryDuration).Should(Equal(float32(10)))
-				Expect(entries[0].AverageCandidateDuration).Should(Equal(float32(2)))
+				Expect(entries[0].AverageCandidateDuration).Should(Equal(float32(4)))
 			})
 		})
 	})
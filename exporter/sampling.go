@@ -0,0 +1,164 @@
+package exporter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// RingSampling keeps the latest error details
+	RingSampling = "ring"
+	// ReservoirSampling keeps a uniform random sample of all error details
+	ReservoirSampling = "reservoir"
+	// UniqueSampling keeps one error detail for each different diff, counting its occurrences
+	UniqueSampling = "unique"
+)
+
+const (
+	defaultMaxPerEndpoint = 20
+	defaultMaxTotal       = 1000
+	defaultMaxSize        = 64 * 1024
+	truncatedMark         = "...(truncated)"
+)
+
+// ErrorSampling configures how many error details are stored. Error counters are always exact.
+type ErrorSampling struct {
+	// Strategy to choose which details are kept when an endpoint is full (ring, reservoir or unique)
+	Strategy string
+	// MaxPerEndpoint is the maximum number of details stored for each endpoint
+	MaxPerEndpoint int
+	// MaxTotal is the maximum number of details stored for all endpoints
+	MaxTotal int
+	// MaxSize is the maximum size in bytes of the URI, headers, body and diffs of each detail
+	MaxSize int
+}
+
+// IsValidSamplingStrategy checks if strategy is known. Empty strategy means default one.
+func IsValidSamplingStrategy(strategy string) bool {
+	return len(strategy) == 0 || strategy == RingSampling || strategy == ReservoirSampling || strategy == UniqueSampling
+}
+
+// normalize sets default values to not configured fields
+func (s ErrorSampling) normalize() ErrorSampling {
+	if !IsValidSamplingStrategy(s.Strategy) || len(s.Strategy) == 0 {
+		s.Strategy = RingSampling
+	}
+	if s.MaxPerEndpoint <= 0 {
+		s.MaxPerEndpoint = defaultMaxPerEndpoint
+	}
+	if s.MaxTotal <= 0 {
+		s.MaxTotal = defaultMaxTotal
+	}
+	if s.MaxSize <= 0 {
+		s.MaxSize = defaultMaxSize
+	}
+	return s
+}
+
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// add stores the error detail in counter following the sampling strategy.
+// counter.Errors must be already incremented. It is not safe for concurrent use.
+func (s ErrorSampling) add(counter *CallData, errorData ErrorData) {
+
+	errorData = s.truncate(errorData)
+
+	switch s.Strategy {
+	case ReservoirSampling:
+		if len(counter.ErrorDetails) < s.MaxPerEndpoint {
+			counter.AppendErrorData(errorData)
+			return
+		}
+		// Each of the errors seen so far has the same probability to be kept
+		if index := random.Intn(counter.Errors); index < s.MaxPerEndpoint {
+			counter.ErrorDetails[index] = errorData
+		}
+	case UniqueSampling:
+		errorData.Signature = signature(errorData)
+		for i := range counter.ErrorDetails {
+			if counter.ErrorDetails[i].Signature == errorData.Signature {
+				counter.ErrorDetails[i].Occurrences++
+				return
+			}
+		}
+		errorData.Occurrences = 1
+		counter.AppendErrorData(errorData)
+		s.trim(counter)
+	default:
+		counter.AppendErrorData(errorData)
+		s.trim(counter)
+	}
+}
+
+// trim removes the oldest details exceeding the maximum per endpoint
+func (s ErrorSampling) trim(counter *CallData) {
+	if exceeding := len(counter.ErrorDetails) - s.MaxPerEndpoint; exceeding > 0 {
+		counter.ErrorDetails = append([]ErrorData(nil), counter.ErrorDetails[exceeding:]...)
+	}
+}
+
+func (s ErrorSampling) truncate(errorData ErrorData) ErrorData {
+	errorData.FullURI = truncate(errorData.FullURI, s.MaxSize)
+	errorData.OriginalHeaders = truncateHeaders(errorData.OriginalHeaders, s.MaxSize)
+	errorData.OriginalBody = truncate(errorData.OriginalBody, s.MaxSize)
+	errorData.BodyDiff = truncate(errorData.BodyDiff, s.MaxSize)
+	errorData.HeaderDiff = truncate(errorData.HeaderDiff, s.MaxSize)
+	return errorData
+}
+
+// truncate cuts value to size bytes without splitting a multi-byte character
+func truncate(value string, size int) string {
+	if len(value) <= size {
+		return value
+	}
+	for size > 0 && !utf8.RuneStart(value[size]) {
+		size--
+	}
+	return value[:size] + truncatedMark
+}
+
+// truncateHeaders copies headers until names and values take size bytes, sorted by name.
+// The value reaching the limit is truncated and the remaining headers are dropped.
+func truncateHeaders(headers http.Header, size int) http.Header {
+	if headers == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	truncated := make(http.Header, len(headers))
+	for _, name := range names {
+		for _, value := range headers[name] {
+			if size -= len(name); size < 0 {
+				return truncated
+			}
+			if len(value) > size {
+				truncated[name] = append(truncated[name], truncate(value, size))
+				return truncated
+			}
+			truncated[name] = append(truncated[name], value)
+			size -= len(value)
+		}
+	}
+	return truncated
+}
+
+func signature(errorData ErrorData) string {
+	content := fmt.Sprintf("%s\x00%s\x00%s", errorData.StatusDiff, errorData.HeaderDiff, errorData.BodyDiff)
+	// Appended only when set, so signatures of stored details do not change
+	if len(errorData.TransportDiff) > 0 {
+		content += "\x00" + errorData.TransportDiff
+	}
+	hash := sha1.Sum([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
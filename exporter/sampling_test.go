@@ -0,0 +1,169 @@
+package exporter_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Error Details Sampling", func() {
+
+	var stats *exporter.URLCounterMap
+
+	BeforeEach(func() {
+		stats = exporter.NewURLCounterMap()
+	})
+
+	Describe("Bounded error details", func() {
+		Context("With ring strategy", func() {
+			It("should keep latest details but exact counter", func() {
+
+				// Given
+				stats.SetErrorSampling(exporter.ErrorSampling{Strategy: exporter.RingSampling, MaxPerEndpoint: 3})
+
+				// When
+				for i := 0; i < 10; i++ {
+					stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{FullURI: fmt.Sprintf("/a?i=%d", i)})
+				}
+
+				// Then
+				entry := stats.FindEntry("GET", "/a")
+				Expect(entry.Errors).Should(Equal(10))
+				Expect(entry.ErrorDetails).Should(HaveLen(3))
+				Expect(entry.ErrorDetails[0].FullURI).Should(Equal("/a?i=7"))
+				Expect(entry.ErrorDetails[2].FullURI).Should(Equal("/a?i=9"))
+			})
+		})
+
+		Context("With reservoir strategy", func() {
+			It("should keep a fixed size sample", func() {
+
+				// Given
+				stats.SetErrorSampling(exporter.ErrorSampling{Strategy: exporter.ReservoirSampling, MaxPerEndpoint: 5})
+
+				// When
+				for i := 0; i < 100; i++ {
+					stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{FullURI: fmt.Sprintf("/a?i=%d", i)})
+				}
+
+				// Then
+				entry := stats.FindEntry("GET", "/a")
+				Expect(entry.Errors).Should(Equal(100))
+				Expect(entry.ErrorDetails).Should(HaveLen(5))
+			})
+		})
+
+		Context("With unique strategy", func() {
+			It("should keep one detail for each different diff", func() {
+
+				// Given
+				stats.SetErrorSampling(exporter.ErrorSampling{Strategy: exporter.UniqueSampling})
+
+				// When
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{BodyDiff: "a"})
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{BodyDiff: "b"})
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{BodyDiff: "a"})
+
+				// Then
+				entry := stats.FindEntry("GET", "/a")
+				Expect(entry.Errors).Should(Equal(3))
+				Expect(entry.ErrorDetails).Should(HaveLen(2))
+				Expect(entry.ErrorDetails[0].Occurrences).Should(Equal(2))
+				Expect(entry.ErrorDetails[1].Occurrences).Should(Equal(1))
+			})
+		})
+
+		Context("With global limit", func() {
+			It("should remove details of the biggest endpoint", func() {
+
+				// Given
+				stats.SetErrorSampling(exporter.ErrorSampling{MaxPerEndpoint: 10, MaxTotal: 12})
+
+				// When
+				for i := 0; i < 10; i++ {
+					stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{})
+				}
+				for i := 0; i < 4; i++ {
+					stats.IncErr("GET", "/b", exporter.Observation{}, exporter.ErrorData{})
+				}
+
+				// Then
+				Expect(stats.FindEntry("GET", "/a").ErrorDetails).Should(HaveLen(8))
+				Expect(stats.FindEntry("GET", "/a").Errors).Should(Equal(10))
+				Expect(stats.FindEntry("GET", "/b").ErrorDetails).Should(HaveLen(4))
+			})
+		})
+
+		Context("With big bodies", func() {
+			It("should truncate body", func() {
+
+				// Given
+				stats.SetErrorSampling(exporter.ErrorSampling{MaxSize: 10})
+
+				// When
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{OriginalBody: strings.Repeat("a", 100)})
+
+				// Then
+				body := stats.FindEntry("GET", "/a").ErrorDetails[0].OriginalBody
+				Expect(body).Should(HavePrefix(strings.Repeat("a", 10)))
+				Expect(len(body)).Should(BeNumerically("<", 100))
+			})
+
+			It("should not split multi-byte characters", func() {
+
+				// Given
+				stats.SetErrorSampling(exporter.ErrorSampling{MaxSize: 10})
+
+				// When
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{BodyDiff: "a" + strings.Repeat("ñ", 10)})
+
+				// Then
+				diff := stats.FindEntry("GET", "/a").ErrorDetails[0].BodyDiff
+				Expect(utf8.ValidString(diff)).Should(BeTrue())
+				Expect(diff).Should(HavePrefix("a" + strings.Repeat("ñ", 4) + "..."))
+			})
+
+			It("should truncate uri and headers", func() {
+
+				// Given
+				stats.SetErrorSampling(exporter.ErrorSampling{MaxSize: 20})
+				headers := http.Header{"A": {"1"}, "B": {strings.Repeat("b", 100)}, "C": {"3"}}
+
+				// When
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{FullURI: "/a?b=" + strings.Repeat("b", 100), OriginalHeaders: headers})
+
+				// Then
+				detail := stats.FindEntry("GET", "/a").ErrorDetails[0]
+				Expect(detail.FullURI).Should(HavePrefix("/a?b=bbb"))
+				Expect(len(detail.FullURI)).Should(BeNumerically("<", 50))
+				Expect(detail.OriginalHeaders.Get("A")).Should(Equal("1"))
+				Expect(detail.OriginalHeaders.Get("B")).Should(HavePrefix(strings.Repeat("b", 16)))
+				Expect(len(detail.OriginalHeaders.Get("B"))).Should(BeNumerically("<", 50))
+				Expect(detail.OriginalHeaders).ShouldNot(HaveKey("C"))
+				Expect(headers.Get("B")).Should(HaveLen(100))
+			})
+		})
+
+		Context("When details are read", func() {
+			It("should not change them on later errors", func() {
+
+				// Given
+				stats.SetErrorSampling(exporter.ErrorSampling{Strategy: exporter.UniqueSampling})
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{BodyDiff: "a"})
+				entry := stats.FindEntry("GET", "/a")
+
+				// When
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{BodyDiff: "a"})
+
+				// Then
+				Expect(entry.ErrorDetails[0].Occurrences).Should(Equal(1))
+				Expect(stats.FindEntry("GET", "/a").ErrorDetails[0].Occurrences).Should(Equal(2))
+			})
+		})
+	})
+})
@@ -0,0 +1,127 @@
+package exporter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// WebhookSink posts regressions to an URL
+	WebhookSink = "webhook"
+	// LogSink logs regressions
+	LogSink = "log"
+)
+
+// Comparison is the result of comparing primary and candidate sent to sinks
+type Comparison struct {
+	Service              string        `json:"service"`
+	Candidate            string        `json:"candidate"`
+	Method               string        `json:"method"`
+	Route                string        `json:"route"`
+	URI                  string        `json:"uri"`
+	Equal                bool          `json:"equal"`
+	Slow                 bool          `json:"slow,omitempty"`
+	StatusDiff           string        `json:"statusDiff,omitempty"`
+	HeadersDiff          string        `json:"headersDiff,omitempty"`
+	BodyDiff             string        `json:"bodyDiff,omitempty"`
+	TransportDiff        string        `json:"transportDiff,omitempty"`
+	PrimaryElapsedTime   time.Duration `json:"primaryElapsedTimeNano"`
+	CandidateElapsedTime time.Duration `json:"candidateElapsedTimeNano"`
+	Processed            time.Time     `json:"processedDate"`
+}
+
+// Sink receives the result of every comparison. Send must not block the request.
+type Sink interface {
+	Send(comparison Comparison)
+	Close() error
+}
+
+// Sinks sends results to all of its sinks
+type Sinks []Sink
+
+// Send comparison to all sinks
+func (s Sinks) Send(comparison Comparison) {
+	for _, sink := range s {
+		sink.Send(comparison)
+	}
+}
+
+// Close all sinks returning the first error
+func (s Sinks) Close() error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ParseSink splits a sink definition like webhook:https://alerts.example.com/diferencia in its kind and target
+func ParseSink(definition string) (string, string, error) {
+	parts := strings.SplitN(definition, ":", 2)
+	kind := parts[0]
+
+	switch kind {
+	case LogSink:
+		return kind, "", nil
+	case WebhookSink:
+		if len(parts) < 2 || !strings.HasPrefix(parts[1], "http://") && !strings.HasPrefix(parts[1], "https://") {
+			return "", "", fmt.Errorf("Webhook sink %s requires an http or https URL like webhook:https://alerts.example.com/diferencia", definition)
+		}
+		return kind, parts[1], nil
+	}
+
+	return "", "", fmt.Errorf("Cannot find %s sink. Valid sinks are %s and %s", kind, WebhookSink, LogSink)
+}
+
+// NewSinks creates all defined sinks. Webhook sinks are created with given options.
+func NewSinks(definitions []string, webhook WebhookOptions) (Sinks, error) {
+	var sinks Sinks
+
+	for _, definition := range definitions {
+		kind, target, err := ParseSink(definition)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+
+		switch kind {
+		case WebhookSink:
+			sinks = append(sinks, NewWebhook(target, webhook))
+		case LogSink:
+			sinks = append(sinks, &RegressionLogger{})
+		}
+	}
+
+	return sinks, nil
+}
+
+// RegressionLogger is a sink logging regressions
+type RegressionLogger struct{}
+
+// Send logs comparison if it is a regression
+func (l *RegressionLogger) Send(comparison Comparison) {
+	if comparison.Equal {
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"service":       comparison.Service,
+		"candidate":     comparison.Candidate,
+		"method":        comparison.Method,
+		"route":         comparison.Route,
+		"uri":           comparison.URI,
+		"statusDiff":    comparison.StatusDiff,
+		"headersDiff":   comparison.HeadersDiff,
+		"bodyDiff":      comparison.BodyDiff,
+		"transportDiff": comparison.TransportDiff,
+	}).Warn("Regression detected")
+}
+
+// Close does nothing
+func (l *RegressionLogger) Close() error {
+	return nil
+}
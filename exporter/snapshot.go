@@ -0,0 +1,165 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Snapshot is a full dump of stats that can be imported again
+type Snapshot struct {
+	Exported time.Time       `json:"exportedDate"`
+	Entries  []SnapshotEntry `json:"entries"`
+}
+
+// SnapshotEntry contains all stored data of an endpoint
+type SnapshotEntry struct {
+	Endpoint                      URLCall          `json:"endpoint"`
+	Success                       int              `json:"success"`
+	Errors                        int              `json:"errors"`
+	ErrorDetails                  []ErrorData      `json:"errorDetails"`
+	PrimaryDurationAllCallsNano   int64            `json:"primaryDurationAllCallsNano"`
+	CandidateDurationAllCallsNano int64            `json:"candidateDurationAllCallsNano"`
+	Slow                          int              `json:"slow,omitempty"`
+	PrimaryLatency                LatencyHistogram `json:"primaryLatency"`
+	CandidateLatency              LatencyHistogram `json:"candidateLatency"`
+	PrimaryNon2xx                 int              `json:"primaryNon2xx,omitempty"`
+	CandidateNon2xx               int              `json:"candidateNon2xx,omitempty"`
+	PrimaryFailures               map[string]int   `json:"primaryFailures,omitempty"`
+	CandidateFailures             map[string]int   `json:"candidateFailures,omitempty"`
+}
+
+// Snapshot returns a copy of all stored data
+func (m *URLCounterMap) Snapshot() Snapshot {
+	m.RLock()
+	defer m.RUnlock()
+
+	all := m.all()
+	entries := make([]SnapshotEntry, 0, len(all))
+	for key, value := range all {
+		entries = append(entries, newSnapshotEntry(key, value))
+	}
+
+	return Snapshot{Exported: time.Now(), Entries: entries}
+}
+
+func newSnapshotEntry(call URLCall, data CallData) SnapshotEntry {
+	errorDetails := make([]ErrorData, len(data.ErrorDetails))
+	copy(errorDetails, data.ErrorDetails)
+
+	return SnapshotEntry{
+		Endpoint:                      call,
+		Success:                       data.Success,
+		Errors:                        data.Errors,
+		ErrorDetails:                  errorDetails,
+		PrimaryDurationAllCallsNano:   data.PrimaryDurationAllCalls.Nanoseconds(),
+		CandidateDurationAllCallsNano: data.CandidateDurationAllCalls.Nanoseconds(),
+		Slow:                          data.Slow,
+		PrimaryLatency:                data.PrimaryLatency.clone(),
+		CandidateLatency:              data.CandidateLatency.clone(),
+		PrimaryNon2xx:                 data.PrimaryNon2xx,
+		CandidateNon2xx:               data.CandidateNon2xx,
+		PrimaryFailures:               addFailures(nil, data.PrimaryFailures),
+		CandidateFailures:             addFailures(nil, data.CandidateFailures),
+	}
+}
+
+func (entry SnapshotEntry) callData() CallData {
+	return CallData{
+		Success:                   entry.Success,
+		Errors:                    entry.Errors,
+		ErrorDetails:              entry.ErrorDetails,
+		PrimaryDurationAllCalls:   time.Duration(entry.PrimaryDurationAllCallsNano),
+		CandidateDurationAllCalls: time.Duration(entry.CandidateDurationAllCallsNano),
+		Slow:                      entry.Slow,
+		PrimaryLatency:            entry.PrimaryLatency,
+		CandidateLatency:          entry.CandidateLatency,
+		PrimaryNon2xx:             entry.PrimaryNon2xx,
+		CandidateNon2xx:           entry.CandidateNon2xx,
+		PrimaryFailures:           entry.PrimaryFailures,
+		CandidateFailures:         entry.CandidateFailures,
+	}
+}
+
+// Restore stored data from a snapshot. If merge is true, snapshot data is added to current data, if not current data is replaced.
+// Error details are truncated and redacted as recorded ones.
+func (m *URLCounterMap) Restore(snapshot Snapshot, merge bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	if !merge {
+		if err := m.store.Clear(); err != nil {
+			logrus.Errorf("Error resetting stats. %s", err.Error())
+		}
+	}
+
+	for _, entry := range snapshot.Entries {
+		counter, _ := m.load(entry.Endpoint)
+		counter.Success += entry.Success
+		counter.Errors += entry.Errors
+		counter.ErrorDetails = append(counter.ErrorDetails, m.imported(entry.ErrorDetails)...)
+		counter.PrimaryDurationAllCalls += time.Duration(entry.PrimaryDurationAllCallsNano)
+		counter.CandidateDurationAllCalls += time.Duration(entry.CandidateDurationAllCallsNano)
+		counter.Slow += entry.Slow
+		counter.PrimaryLatency.Merge(entry.PrimaryLatency)
+		counter.CandidateLatency.Merge(entry.CandidateLatency)
+		counter.PrimaryNon2xx += entry.PrimaryNon2xx
+		counter.CandidateNon2xx += entry.CandidateNon2xx
+		counter.PrimaryFailures = addFailures(counter.PrimaryFailures, entry.PrimaryFailures)
+		counter.CandidateFailures = addFailures(counter.CandidateFailures, entry.CandidateFailures)
+		m.sampling.trim(&counter)
+		m.save(entry.Endpoint, counter)
+	}
+
+	m.details = nil
+	m.enforceMaxTotal()
+}
+
+// imported returns error details of a snapshot following sampling and redaction of this map, since snapshot might come from an instance configured differently
+func (m *URLCounterMap) imported(details []ErrorData) []ErrorData {
+	imported := make([]ErrorData, 0, len(details))
+	for _, detail := range details {
+		detail = m.sampling.truncate(detail.Redact(m.redactor))
+		if len(detail.Signature) > 0 {
+			detail.Signature = signature(detail)
+		}
+		imported = append(imported, detail)
+	}
+	return imported
+}
+
+// ExportHandler returns JSON with a full dump of the map
+func (m *URLCounterMap) ExportHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"diferencia-stats.json\"")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(m.Snapshot())
+}
+
+// ImportHandler restores the map from a JSON dump. By default current entries are replaced, use merge=true query parameter to add them.
+func (m *URLCounterMap) ImportHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var snapshot Snapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Stats snapshot is not valid. %s", err.Error())
+		return
+	}
+
+	m.Restore(snapshot, r.URL.Query().Get("merge") == "true")
+	w.WriteHeader(http.StatusOK)
+}
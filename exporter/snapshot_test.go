@@ -0,0 +1,139 @@
+package exporter_test
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/redact"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stats Snapshot", func() {
+
+	var stats *exporter.URLCounterMap
+
+	BeforeEach(func() {
+		stats = exporter.NewURLCounterMap()
+	})
+
+	Describe("Export and Import", func() {
+		Context("With stored stats", func() {
+			It("should restore same stats when replacing", func() {
+
+				// Given
+				primaryAverage, _ := time.ParseDuration("10ms")
+				candidateAverage, _ := time.ParseDuration("20ms")
+				stats.IncSuccess("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage, CandidateElapsedTime: candidateAverage})
+				stats.IncErr("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage, CandidateElapsedTime: candidateAverage}, exporter.ErrorData{FullURI: "/a?b=c", BodyDiff: "body"})
+				snapshot := stats.Snapshot()
+				stats.IncSuccess("GET", "/b", exporter.Observation{PrimaryElapsedTime: primaryAverage, CandidateElapsedTime: candidateAverage})
+
+				// When
+				stats.Restore(snapshot, false)
+
+				// Then
+				entries := stats.Entries()
+				Expect(entries).Should(HaveLen(1))
+				Expect(entries[0].Success).Should(Equal(1))
+				Expect(entries[0].Errors).Should(Equal(1))
+				Expect(entries[0].ErrorDetails[0].FullURI).Should(Equal("/a?b=c"))
+				Expect(entries[0].AveragePrimaryDuration).Should(Equal(float32(10)))
+			})
+
+			It("should truncate and redact imported error details", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Headers: []string{"Authorization"}, Patterns: []string{"token=[a-z]+"}})
+				stats.SetErrorSampling(exporter.ErrorSampling{MaxSize: 30})
+				stats.SetRedactor(redactor)
+				snapshot := exporter.Snapshot{Entries: []exporter.SnapshotEntry{{
+					Endpoint: exporter.URLCall{Method: "GET", Path: "/a"},
+					Errors:   1,
+					ErrorDetails: []exporter.ErrorData{{
+						FullURI:         "/a?token=secret",
+						OriginalHeaders: map[string][]string{"Authorization": {"Bearer abc"}},
+						BodyDiff:        strings.Repeat("a", 100),
+					}},
+				}}}
+
+				// When
+				stats.Restore(snapshot, false)
+
+				// Then
+				detail := stats.FindEntry("GET", "/a").ErrorDetails[0]
+				Expect(detail.FullURI).Should(Equal("/a?" + redact.Mask))
+				Expect(detail.OriginalHeaders.Get("Authorization")).Should(Equal(redact.Mask))
+				Expect(detail.BodyDiff).Should(HavePrefix(strings.Repeat("a", 30) + "..."))
+			})
+
+			It("should add stats when merging", func() {
+
+				// Given
+				primaryAverage, _ := time.ParseDuration("10ms")
+				candidateAverage, _ := time.ParseDuration("20ms")
+				stats.IncSuccess("GET", "/a", exporter.Observation{PrimaryElapsedTime: primaryAverage, CandidateElapsedTime: candidateAverage})
+				snapshot := stats.Snapshot()
+
+				// When
+				stats.Restore(snapshot, true)
+
+				// Then
+				entries := stats.Entries()
+				Expect(entries).Should(HaveLen(1))
+				Expect(entries[0].Success).Should(Equal(2))
+				Expect(entries[0].AverageCandidateDuration).Should(Equal(float32(20)))
+			})
+		})
+	})
+
+	Describe("Reset", func() {
+		Context("Scoped to method and path", func() {
+			It("should only remove matching entries", func() {
+
+				// Given
+				stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{})
+				stats.IncErr("POST", "/a", exporter.Observation{}, exporter.ErrorData{})
+				stats.IncErr("GET", "/b", exporter.Observation{}, exporter.ErrorData{})
+
+				// When
+				removed := stats.ResetMatching("", "/a")
+
+				// Then
+				Expect(removed).Should(Equal(2))
+				entries := stats.Entries()
+				Expect(entries).Should(HaveLen(1))
+				Expect(entries[0].Endpoint.Path).Should(Equal("/b"))
+			})
+		})
+
+		Context("With concurrent traffic", func() {
+			It("should not fail", func() {
+
+				// Given
+				var wg sync.WaitGroup
+
+				// When
+				for i := 0; i < 10; i++ {
+					wg.Add(2)
+					go func() {
+						defer wg.Done()
+						for j := 0; j < 100; j++ {
+							stats.IncErr("GET", "/a", exporter.Observation{}, exporter.ErrorData{})
+						}
+					}()
+					go func() {
+						defer wg.Done()
+						stats.Reset()
+					}()
+				}
+				wg.Wait()
+
+				// Then
+				Expect(len(stats.Entries())).Should(BeNumerically("<=", 1))
+			})
+		})
+	})
+})
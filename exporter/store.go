@@ -0,0 +1,66 @@
+package exporter
+
+// Store persists the data collected for each endpoint
+type Store interface {
+	// Load data of given endpoint, returning false if there is no data
+	Load(call URLCall) (CallData, bool, error)
+	// Save data of given endpoint
+	Save(call URLCall, data CallData) error
+	// Delete data of given endpoint
+	Delete(call URLCall) error
+	// All returns the data of all endpoints
+	All() (map[URLCall]CallData, error)
+	// Clear removes data of all endpoints
+	Clear() error
+	// Close releases resources of the store
+	Close() error
+}
+
+// MemoryStore keeps data in a map, so it is lost when Diferencia is stopped.
+// It is not safe for concurrent use, URLCounterMap guards it.
+type MemoryStore struct {
+	internal map[URLCall]CallData
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{internal: make(map[URLCall]CallData)}
+}
+
+// Load data of given endpoint
+func (s *MemoryStore) Load(call URLCall) (CallData, bool, error) {
+	data, ok := s.internal[call]
+	return data, ok, nil
+}
+
+// Save data of given endpoint
+func (s *MemoryStore) Save(call URLCall, data CallData) error {
+	s.internal[call] = data
+	return nil
+}
+
+// Delete data of given endpoint
+func (s *MemoryStore) Delete(call URLCall) error {
+	delete(s.internal, call)
+	return nil
+}
+
+// All returns a copy of the map with all endpoints
+func (s *MemoryStore) All() (map[URLCall]CallData, error) {
+	all := make(map[URLCall]CallData, len(s.internal))
+	for key, value := range s.internal {
+		all[key] = value
+	}
+	return all, nil
+}
+
+// Clear removes all endpoints
+func (s *MemoryStore) Clear() error {
+	s.internal = make(map[URLCall]CallData)
+	return nil
+}
+
+// Close does nothing in memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
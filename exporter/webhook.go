@@ -0,0 +1,260 @@
+package exporter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SignatureHeader contains the HMAC-SHA256 of the body when a secret is configured
+	SignatureHeader = "X-Diferencia-Signature"
+	// WebhookSecretEnv is the environment variable where the webhook secret can be set
+	WebhookSecretEnv = "DIFERENCIA_WEBHOOK_SECRET"
+
+	defaultBatchSize     = 10
+	defaultBatchInterval = 5 * time.Second
+	defaultRetryBackoff  = 500 * time.Millisecond
+	maxRetryBackoff      = 30 * time.Second
+	maxRetryTime         = 2 * time.Minute
+	defaultWebhookQueue  = 1024
+	webhookTimeout       = 10 * time.Second
+)
+
+// WebhookOptions configures how regressions are posted
+type WebhookOptions struct {
+	// Secret used to sign the body. Empty means not signed.
+	Secret string
+	// BatchSize is the maximum number of regressions of each request
+	BatchSize int
+	// BatchInterval is the maximum time a regression waits to be sent
+	BatchInterval time.Duration
+	// MaxRetries of a failed request. 0 means no retries.
+	MaxRetries int
+	// RetryBackoff is the wait before first retry, doubled on each retry up to 30 seconds
+	RetryBackoff time.Duration
+	// RateLimit is the maximum number of requests per second. 0 means no limit.
+	RateLimit float64
+}
+
+// normalize sets default values to not configured fields
+func (o WebhookOptions) normalize() WebhookOptions {
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.BatchInterval <= 0 {
+		o.BatchInterval = defaultBatchInterval
+	}
+	if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = defaultRetryBackoff
+	}
+	return o
+}
+
+// WebhookPayload is the body posted to the webhook
+type WebhookPayload struct {
+	Regressions []Comparison `json:"regressions"`
+}
+
+// Webhook is a sink posting regressions as JSON in batches. Requests are sent by a background goroutine.
+type Webhook struct {
+	sync.RWMutex
+	url         string
+	options     WebhookOptions
+	client      *http.Client
+	regressions chan Comparison
+	done        chan struct{}
+	stopping    chan struct{}
+	closed      bool
+	nextRequest time.Time
+}
+
+// NewWebhook creates a sink posting regressions to url
+func NewWebhook(url string, options WebhookOptions) *Webhook {
+	w := &Webhook{
+		url:         url,
+		options:     options.normalize(),
+		client:      &http.Client{Timeout: webhookTimeout},
+		regressions: make(chan Comparison, defaultWebhookQueue),
+		done:        make(chan struct{}),
+		stopping:    make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Send queues the comparison if it is a regression. If the queue is full the regression is dropped.
+func (w *Webhook) Send(comparison Comparison) {
+	if comparison.Equal {
+		return
+	}
+
+	w.RLock()
+	defer w.RUnlock()
+
+	if w.closed {
+		return
+	}
+
+	select {
+	case w.regressions <- comparison:
+	default:
+		logrus.Warnf("Webhook %s queue is full, regression of %s %s has been dropped", w.url, comparison.Method, comparison.URI)
+	}
+}
+
+// Close sends pending regressions and stops the sink. Failed requests are not retried anymore, so closing never waits for backoffs.
+func (w *Webhook) Close() error {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.stopping)
+	close(w.regressions)
+	w.Unlock()
+
+	<-w.done
+	return nil
+}
+
+func (w *Webhook) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.options.BatchInterval)
+	defer ticker.Stop()
+
+	var batch []Comparison
+
+	for {
+		select {
+		case regression, ok := <-w.regressions:
+			if !ok {
+				w.post(batch)
+				return
+			}
+			batch = append(batch, regression)
+			if len(batch) >= w.options.BatchSize {
+				w.post(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			w.post(batch)
+			batch = nil
+		}
+	}
+}
+
+// post sends the batch retrying with exponential backoff until retries, maximum retry time or the sink is closed
+func (w *Webhook) post(batch []Comparison) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(WebhookPayload{Regressions: batch})
+	if err != nil {
+		logrus.Errorf("Error serializing regressions for webhook %s. %s", w.url, err.Error())
+		return
+	}
+
+	backoff := w.options.RetryBackoff
+	deadline := time.Now().Add(maxRetryTime)
+	for attempt := 0; ; attempt++ {
+		retry, err := w.send(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= w.options.MaxRetries || !w.wait(backoff, deadline) {
+			logrus.Errorf("Error posting %d regressions to webhook %s. %s", len(batch), w.url, err.Error())
+			return
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// wait sleeps backoff before a retry. It returns false without waiting if retry would be after deadline, or as soon as the sink is closed.
+func (w *Webhook) wait(backoff time.Duration, deadline time.Time) bool {
+	if time.Now().Add(backoff).After(deadline) {
+		return false
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-w.stopping:
+		return false
+	}
+}
+
+// send posts body once. It returns if the request can be retried.
+func (w *Webhook) send(body []byte) (bool, error) {
+	w.waitRateLimit()
+
+	request, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(w.options.Secret) > 0 {
+		request.Header.Set(SignatureHeader, Sign(w.options.Secret, body))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return false, nil
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return true, fmt.Errorf("webhook responded with %d status code", response.StatusCode)
+	}
+
+	return false, fmt.Errorf("webhook responded with %d status code", response.StatusCode)
+}
+
+// waitRateLimit sleeps until a new request is allowed by the rate limit
+func (w *Webhook) waitRateLimit() {
+	if w.options.RateLimit <= 0 {
+		return
+	}
+
+	now := time.Now()
+	if wait := w.nextRequest.Sub(now); wait > 0 {
+		time.Sleep(wait)
+		now = w.nextRequest
+	}
+	w.nextRequest = now.Add(time.Duration(float64(time.Second) / w.options.RateLimit))
+}
+
+// Sign returns the signature of body with secret as sha256=<hex encoded HMAC-SHA256>
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,221 @@
+package exporter_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// webhookServer records received payloads and responds with the given status codes in order
+type webhookServer struct {
+	sync.Mutex
+	payloads   []exporter.WebhookPayload
+	signatures []string
+	times      []time.Time
+	status     []int
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	payload := exporter.WebhookPayload{}
+	json.Unmarshal(body, &payload)
+
+	s.payloads = append(s.payloads, payload)
+	s.signatures = append(s.signatures, r.Header.Get(exporter.SignatureHeader))
+	s.times = append(s.times, time.Now())
+
+	status := http.StatusOK
+	if len(s.status) > 0 {
+		status = s.status[0]
+		s.status = s.status[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (s *webhookServer) received() []exporter.WebhookPayload {
+	s.Lock()
+	defer s.Unlock()
+	return s.payloads
+}
+
+func regression(uri string) exporter.Comparison {
+	return exporter.Comparison{Method: http.MethodGet, Route: "/users/{id}", URI: uri, Equal: false, BodyDiff: "diff"}
+}
+
+var _ = Describe("Webhook Sink", func() {
+
+	Describe("Post regressions", func() {
+		Context("With batching", func() {
+			It("should send only regressions in batches", func() {
+
+				// Given
+				server := &webhookServer{}
+				endpoint := httptest.NewServer(server)
+				defer endpoint.Close()
+				webhook := exporter.NewWebhook(endpoint.URL, exporter.WebhookOptions{BatchSize: 2, BatchInterval: time.Hour})
+
+				// When
+				webhook.Send(regression("/users/1"))
+				webhook.Send(exporter.Comparison{URI: "/users/2", Equal: true})
+				webhook.Send(regression("/users/3"))
+				webhook.Send(regression("/users/4"))
+				Expect(webhook.Close()).Should(Succeed())
+
+				// Then
+				payloads := server.received()
+				Expect(payloads).Should(HaveLen(2))
+				Expect(payloads[0].Regressions).Should(HaveLen(2))
+				Expect(payloads[0].Regressions[0].URI).Should(Equal("/users/1"))
+				Expect(payloads[0].Regressions[1].URI).Should(Equal("/users/3"))
+				Expect(payloads[1].Regressions).Should(HaveLen(1))
+			})
+
+			It("should send pending regressions after batch interval", func() {
+
+				// Given
+				server := &webhookServer{}
+				endpoint := httptest.NewServer(server)
+				defer endpoint.Close()
+				webhook := exporter.NewWebhook(endpoint.URL, exporter.WebhookOptions{BatchSize: 100, BatchInterval: 50 * time.Millisecond})
+				defer webhook.Close()
+
+				// When
+				webhook.Send(regression("/users/1"))
+
+				// Then
+				Eventually(server.received).Should(HaveLen(1))
+			})
+		})
+
+		Context("With secret", func() {
+			It("should sign the body", func() {
+
+				// Given
+				server := &webhookServer{}
+				endpoint := httptest.NewServer(server)
+				defer endpoint.Close()
+				webhook := exporter.NewWebhook(endpoint.URL, exporter.WebhookOptions{Secret: "s3cr3t", BatchSize: 1})
+
+				// When
+				webhook.Send(regression("/users/1"))
+				webhook.Close()
+
+				// Then
+				body, _ := json.Marshal(server.received()[0])
+				Expect(server.signatures[0]).Should(Equal(exporter.Sign("s3cr3t", body)))
+				Expect(server.signatures[0]).Should(HavePrefix("sha256="))
+			})
+		})
+
+		Context("With failing webhook", func() {
+			It("should retry server errors with backoff", func() {
+
+				// Given
+				server := &webhookServer{status: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}}
+				endpoint := httptest.NewServer(server)
+				defer endpoint.Close()
+				webhook := exporter.NewWebhook(endpoint.URL, exporter.WebhookOptions{BatchSize: 1, MaxRetries: 3, RetryBackoff: 10 * time.Millisecond})
+
+				// When
+				webhook.Send(regression("/users/1"))
+				Eventually(server.received).Should(HaveLen(3))
+				webhook.Close()
+
+				// Then
+				Expect(server.times[2].Sub(server.times[1])).Should(BeNumerically(">=", server.times[1].Sub(server.times[0])))
+			})
+
+			It("should stop retrying when closed", func() {
+
+				// Given
+				server := &webhookServer{status: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+				endpoint := httptest.NewServer(server)
+				defer endpoint.Close()
+				webhook := exporter.NewWebhook(endpoint.URL, exporter.WebhookOptions{BatchSize: 1, MaxRetries: 3, RetryBackoff: time.Minute})
+
+				// When
+				webhook.Send(regression("/users/1"))
+				Eventually(server.received).Should(HaveLen(1))
+				start := time.Now()
+				webhook.Close()
+
+				// Then
+				Expect(time.Since(start)).Should(BeNumerically("<", time.Second))
+				Expect(server.received()).Should(HaveLen(1))
+			})
+
+			It("should not retry client errors", func() {
+
+				// Given
+				server := &webhookServer{status: []int{http.StatusBadRequest}}
+				endpoint := httptest.NewServer(server)
+				defer endpoint.Close()
+				webhook := exporter.NewWebhook(endpoint.URL, exporter.WebhookOptions{BatchSize: 1, MaxRetries: 3, RetryBackoff: 10 * time.Millisecond})
+
+				// When
+				webhook.Send(regression("/users/1"))
+				webhook.Close()
+
+				// Then
+				Expect(server.received()).Should(HaveLen(1))
+			})
+		})
+
+		Context("With rate limit", func() {
+			It("should space requests", func() {
+
+				// Given
+				server := &webhookServer{}
+				endpoint := httptest.NewServer(server)
+				defer endpoint.Close()
+				webhook := exporter.NewWebhook(endpoint.URL, exporter.WebhookOptions{BatchSize: 1, RateLimit: 20})
+
+				// When
+				webhook.Send(regression("/users/1"))
+				webhook.Send(regression("/users/2"))
+				webhook.Send(regression("/users/3"))
+				webhook.Close()
+
+				// Then
+				Expect(server.received()).Should(HaveLen(3))
+				Expect(server.times[2].Sub(server.times[0])).Should(BeNumerically(">=", 90*time.Millisecond))
+			})
+		})
+	})
+
+	Describe("Create sinks", func() {
+		Context("With definitions", func() {
+			It("should parse webhook and log sinks", func() {
+
+				// When
+				sinks, err := exporter.NewSinks([]string{"webhook:https://alerts.example.com/diferencia", "log"}, exporter.WebhookOptions{})
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(sinks).Should(HaveLen(2))
+				Expect(sinks.Close()).Should(Succeed())
+			})
+
+			It("should fail with unknown sinks", func() {
+
+				// When
+				_, err := exporter.NewSinks([]string{"kafka:localhost:9092"}, exporter.WebhookOptions{})
+				_, _, webhookErr := exporter.ParseSink("webhook:alerts")
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+				Expect(webhookErr).Should(HaveOccurred())
+			})
+		})
+	})
+})
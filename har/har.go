@@ -0,0 +1,315 @@
+package har
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+)
+
+const (
+	// Version of HAR format written
+	Version = "1.2"
+	// Primary upstream of an exported entry
+	Primary = "primary"
+	// Secondary upstream of an exported entry
+	Secondary = "secondary"
+	// Candidate upstream of an exported entry
+	Candidate = "candidate"
+)
+
+// HAR is an HTTP Archive document
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log contains all entries
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator of the archive
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is a request and its response. Exported entries contain the comparison as a custom field.
+type Entry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         Request     `json:"request"`
+	Response        Response    `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         Timings     `json:"timings"`
+	Diferencia      *Comparison `json:"_diferencia,omitempty"`
+}
+
+// Request of an entry
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// Response of an entry
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// NameValue is a header or a query parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie sent or received
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// PostData is the body of a request
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	// Encoding is base64 for binary bodies. HAR only defines it for responses, so it is a custom field.
+	Encoding string `json:"_encoding,omitempty"`
+}
+
+// Content is the body of a response
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	// Encoding is base64 for binary contents
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Timings of an entry in milliseconds. -1 means not available.
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Comparison is the custom field relating exported entries of the same comparison
+type Comparison struct {
+	// Comparison is the position of the interaction in the log, shared by primary, secondary and candidate entries
+	Comparison     int    `json:"comparison"`
+	Upstream       string `json:"upstream"`
+	DifferenceMode string `json:"differenceMode"`
+	Result         bool   `json:"result"`
+	// Error type if the upstream could not be called, so the response is empty
+	Error string `json:"error,omitempty"`
+}
+
+// Read an HAR document
+func Read(reader io.Reader) (*HAR, error) {
+	archive := &HAR{}
+	if err := json.NewDecoder(reader).Decode(archive); err != nil {
+		return nil, fmt.Errorf("Not a valid HAR document. %s", err.Error())
+	}
+	return archive, nil
+}
+
+// Write HAR document as indented JSON
+func (h *HAR) Write(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(h)
+}
+
+// Requests of all entries so they can be replayed. URLs are converted to request URIs and HTTP/2 pseudo headers are skipped.
+func (h *HAR) Requests() ([]exporter.Request, error) {
+	requests := make([]exporter.Request, 0, len(h.Log.Entries))
+
+	for i, entry := range h.Log.Entries {
+		parsed, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("Entry %d has an invalid URL %s. %s", i, entry.Request.URL, err.Error())
+		}
+
+		headers := http.Header{}
+		for _, header := range entry.Request.Headers {
+			if strings.HasPrefix(header.Name, ":") {
+				continue
+			}
+			headers.Add(header.Name, header.Value)
+		}
+
+		request := exporter.Request{
+			Method:  entry.Request.Method,
+			URI:     parsed.RequestURI(),
+			Headers: headers,
+		}
+		if entry.Request.PostData != nil {
+			request.Body = entry.Request.PostData.Text
+			request.BodyEncoding = entry.Request.PostData.Encoding
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
+
+// FromInteractions creates an HAR document with an entry for each upstream response of each interaction.
+// Entries of the same interaction share the comparison number of _diferencia field.
+func FromInteractions(interactions []exporter.Interactions) *HAR {
+	archive := &HAR{
+		Log: Log{
+			Version: Version,
+			Creator: Creator{Name: "Diferencia"},
+			Entries: []Entry{},
+		},
+	}
+
+	for i, interaction := range interactions {
+		archive.Log.Entries = append(archive.Log.Entries, entry(i, Primary, interaction, interaction.Primary))
+		if interaction.Secondary != nil {
+			archive.Log.Entries = append(archive.Log.Entries, entry(i, Secondary, interaction, *interaction.Secondary))
+		}
+		archive.Log.Entries = append(archive.Log.Entries, entry(i, Candidate, interaction, interaction.Candidate))
+	}
+
+	return archive
+}
+
+func entry(comparison int, upstream string, interaction exporter.Interactions, response exporter.Interaction) Entry {
+	elapsed := milliseconds(response.ElapsedTime)
+
+	request := Request{
+		Method:      interaction.Request.Method,
+		URL:         response.URL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     requestCookies(interaction.Request.Headers),
+		Headers:     nameValues(interaction.Request.Headers),
+		QueryString: queryString(response.URL),
+		HeadersSize: -1,
+		BodySize:    size(interaction.Request.RawBody()),
+	}
+	if len(interaction.Request.Body) > 0 {
+		request.PostData = &PostData{MimeType: interaction.Request.Headers.Get("Content-Type"), Text: interaction.Request.Body, Encoding: interaction.Request.BodyEncoding}
+	}
+	contentSize := size(response.RawContent())
+
+	return Entry{
+		StartedDateTime: interaction.Processed,
+		Time:            elapsed,
+		Request:         request,
+		Response: Response{
+			Status:      response.StatusCode,
+			StatusText:  http.StatusText(response.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     responseCookies(response.Cookies),
+			Headers:     nameValues(response.Headers),
+			Content: Content{
+				Size:     contentSize,
+				MimeType: response.Headers.Get("Content-Type"),
+				Text:     response.Content,
+				Encoding: response.ContentEncoding,
+			},
+			RedirectURL: response.Headers.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    contentSize,
+		},
+		Timings: Timings{Blocked: -1, DNS: -1, Connect: -1, Send: 0, Wait: elapsed, Receive: 0},
+		Diferencia: &Comparison{
+			Comparison:     comparison,
+			Upstream:       upstream,
+			DifferenceMode: interaction.DifferenceMode,
+			Result:         interaction.Result,
+			Error:          response.Error,
+		},
+	}
+}
+
+// size in bytes of a decoded body, 0 if it cannot be decoded
+func size(body []byte, err error) int {
+	if err != nil {
+		return 0
+	}
+	return len(body)
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
+
+// nameValues sorted by name so documents are reproducible
+func nameValues(values map[string][]string) []NameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []NameValue{}
+	for _, name := range names {
+		for _, value := range values[name] {
+			pairs = append(pairs, NameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+func queryString(rawURL string) []NameValue {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return []NameValue{}
+	}
+	return nameValues(parsed.Query())
+}
+
+func requestCookies(headers http.Header) []Cookie {
+	cookies := []Cookie{}
+	for _, cookie := range (&http.Request{Header: headers}).Cookies() {
+		cookies = append(cookies, Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+// responseCookies parses cookies stored in Set-Cookie format
+func responseCookies(setCookies []string) []Cookie {
+	cookies := []Cookie{}
+	for _, cookie := range (&http.Response{Header: http.Header{"Set-Cookie": setCookies}}).Cookies() {
+		cookies = append(cookies, Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		})
+	}
+	return cookies
+}
@@ -0,0 +1,13 @@
+package har_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDiferenciaHar(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Diferencia HAR Suite")
+}
@@ -0,0 +1,143 @@
+package har_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/har"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HAR", func() {
+
+	Describe("Import entries", func() {
+		Context("With a browser session", func() {
+			It("should convert entries to requests", func() {
+
+				// Given
+				document := `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "Browser", "version": "1"},
+    "entries": [
+      {
+        "startedDateTime": "2026-10-18T10:00:00.000Z",
+        "time": 12,
+        "request": {
+          "method": "POST",
+          "url": "https://shop.example.com/orders?source=web",
+          "httpVersion": "HTTP/2",
+          "headers": [{"name": ":authority", "value": "shop.example.com"}, {"name": "Content-Type", "value": "application/json"}],
+          "queryString": [{"name": "source", "value": "web"}],
+          "cookies": [],
+          "postData": {"mimeType": "application/json", "text": "{\"id\": 1}"},
+          "headersSize": -1,
+          "bodySize": 9
+        },
+        "response": {"status": 201, "statusText": "Created", "httpVersion": "HTTP/2", "headers": [], "cookies": [], "content": {"size": 0, "mimeType": ""}, "redirectURL": "", "headersSize": -1, "bodySize": 0},
+        "cache": {},
+        "timings": {"send": 0, "wait": 12, "receive": 0}
+      }
+    ]
+  }
+}`
+
+				// When
+				archive, err := har.Read(strings.NewReader(document))
+				Expect(err).Should(Succeed())
+				requests, err := archive.Requests()
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(requests).Should(HaveLen(1))
+				Expect(requests[0].Method).Should(Equal(http.MethodPost))
+				Expect(requests[0].URI).Should(Equal("/orders?source=web"))
+				Expect(requests[0].Headers).Should(Equal(http.Header{"Content-Type": []string{"application/json"}}))
+				Expect(requests[0].Body).Should(Equal(`{"id": 1}`))
+			})
+		})
+	})
+
+	Describe("Export interactions", func() {
+		Context("With stored interactions", func() {
+			It("should create an entry for each upstream", func() {
+
+				// Given
+				request := exporter.CreateRequest(http.MethodGet, "/users/1?verbose=true", http.Header{"Cookie": []string{"session=abc"}}, nil)
+				primary := exporter.CreateInteraction("http://primary/users/1?verbose=true", []byte(`{"id": 1}`), 200,
+					http.Header{"Content-Type": []string{"application/json"}}, []*http.Cookie{{Name: "tracking", Value: "1", Path: "/"}}, 20*time.Millisecond)
+				candidate := exporter.CreateInteraction("http://candidate/users/1?verbose=true", []byte(`{"id": 2}`), 200,
+					http.Header{"Content-Type": []string{"application/json"}}, nil, 30*time.Millisecond)
+				interactions := []exporter.Interactions{exporter.CreateInteractions(request, primary, nil, candidate, "Strict", false)}
+
+				// When
+				archive := har.FromInteractions(interactions)
+
+				// Then
+				Expect(archive.Log.Version).Should(Equal(har.Version))
+				Expect(archive.Log.Entries).Should(HaveLen(2))
+
+				primaryEntry := archive.Log.Entries[0]
+				Expect(primaryEntry.Request.URL).Should(Equal("http://primary/users/1?verbose=true"))
+				Expect(primaryEntry.Request.QueryString).Should(Equal([]har.NameValue{{Name: "verbose", Value: "true"}}))
+				Expect(primaryEntry.Request.Cookies).Should(Equal([]har.Cookie{{Name: "session", Value: "abc"}}))
+				Expect(primaryEntry.Response.Content.Text).Should(Equal(`{"id": 1}`))
+				Expect(primaryEntry.Response.Content.MimeType).Should(Equal("application/json"))
+				Expect(primaryEntry.Response.Cookies).Should(Equal([]har.Cookie{{Name: "tracking", Value: "1", Path: "/"}}))
+				Expect(primaryEntry.Time).Should(Equal(20.0))
+				Expect(primaryEntry.Diferencia).Should(Equal(&har.Comparison{Comparison: 0, Upstream: har.Primary, DifferenceMode: "Strict", Result: false}))
+
+				candidateEntry := archive.Log.Entries[1]
+				Expect(candidateEntry.Diferencia.Upstream).Should(Equal(har.Candidate))
+				Expect(candidateEntry.Timings.Wait).Should(Equal(30.0))
+			})
+
+			It("should write a document that can be read again", func() {
+
+				// Given
+				request := exporter.CreateRequest(http.MethodPost, "/orders", nil, []byte(`{"id": 1}`))
+				response := exporter.CreateInteraction("http://primary/orders", nil, 201, nil, nil, 0)
+				archive := har.FromInteractions([]exporter.Interactions{exporter.CreateInteractions(request, response, &response, response, "Strict", true)})
+				var output bytes.Buffer
+
+				// When
+				Expect(archive.Write(&output)).Should(Succeed())
+				read, err := har.Read(&output)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(read.Log.Entries).Should(HaveLen(3))
+				Expect(read.Log.Entries[1].Diferencia.Upstream).Should(Equal(har.Secondary))
+				requests, _ := read.Requests()
+				Expect(requests[0].URI).Should(Equal("/orders"))
+				Expect(requests[0].Body).Should(Equal(`{"id": 1}`))
+			})
+
+			It("should encode binary bodies as base64", func() {
+
+				// Given
+				binary := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}
+				request := exporter.CreateRequest(http.MethodPost, "/images", nil, binary)
+				response := exporter.CreateInteraction("http://primary/images/1", binary, 200, nil, nil, 0)
+				archive := har.FromInteractions([]exporter.Interactions{exporter.CreateInteractions(request, response, nil, response, "Strict", true)})
+				var output bytes.Buffer
+
+				// When
+				Expect(archive.Write(&output)).Should(Succeed())
+				read, err := har.Read(&output)
+
+				// Then
+				Expect(err).Should(Succeed())
+				content := read.Log.Entries[0].Response.Content
+				Expect(content.Encoding).Should(Equal("base64"))
+				Expect(content.Size).Should(Equal(len(binary)))
+				requests, _ := read.Requests()
+				Expect(requests[0].RawBody()).Should(Equal(binary))
+			})
+		})
+	})
+})
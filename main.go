@@ -1,10 +1,17 @@
 package main
 
 import (
+	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/lordofthejars/diferencia/core"
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/har"
 	"github.com/lordofthejars/diferencia/log"
+	"github.com/lordofthejars/diferencia/redact"
+	"github.com/lordofthejars/diferencia/replay"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -14,16 +21,33 @@ var rootCmd = &cobra.Command{
 	Short: "Interact with Diferencia",
 }
 
-func areHttpsClientAttributesCorrect(caCert, clientCert, clientKey string) bool {
-	return (len(caCert) == 0 && len(clientCert) == 0 && len(clientKey) == 0) || (len(caCert) > 0 && len(clientCert) > 0 && len(clientKey) > 0)
-}
-
 func main() {
 
 	var port int
 	var serviceName, primaryURL, secondaryURL, candidateURL, difference string
 	var allowUnsafeOperations, noiseDetection bool
 	var storeResults string
+	var storeResultsMaxSize, storeResultsBackups int
+	var storeResultsMaxAge string
+	var storeResultsCompress bool
+	var snapshotMode, snapshotDir, snapshotMaxAge string
+	var statsStore string
+	var errorDetailsSampling string
+	var routeTemplates []string
+	var inferRouteTemplates bool
+	var tracingEndpoint string
+	var sinks []string
+	var webhookSecret, webhookBatchInterval string
+	var webhookBatchSize, webhookMaxRetries int
+	var webhookRateLimit float64
+	var redactHeaders, redactPointers, redactPatterns []string
+	var redactMode string
+	var verdictMaxRegressionRate, verdictMaxRouteRegressionRate, verdictMaxLatencyRatio, verdictMinConfidence float64
+	var verdictMinSamples int
+	var latencyBudget string
+	var latencyBudgetRatio float64
+	var statusEquivalences []string
+	var errorDetailsEndpoint, errorDetailsTotal, errorDetailsMaxSize int
 	var prometheus bool
 	var prometheusPort int
 	var headers bool
@@ -38,6 +62,9 @@ func main() {
 	var returnResult bool
 
 	var adminPort int
+	var adminTokensFile, adminBasicAuthFile, adminCert, adminKey, adminClientCa, adminAuditLog string
+	var adminInsecure bool
+	var adminClientCertRoles []string
 
 	var cmdStart = &cobra.Command{
 		Use:   "start",
@@ -51,6 +78,39 @@ func main() {
 			config.Secondary = secondaryURL
 			config.Candidate = candidateURL
 			config.StoreResults = storeResults
+			config.StoreResultsMaxSize = storeResultsMaxSize
+			config.StoreResultsMaxAge = storeResultsMaxAge
+			config.StoreResultsCompress = storeResultsCompress
+			config.StoreResultsBackups = storeResultsBackups
+			config.SnapshotMode = snapshotMode
+			config.SnapshotDir = snapshotDir
+			config.SnapshotMaxAge = snapshotMaxAge
+			config.StatsStore = statsStore
+			config.ErrorDetailsSampling = errorDetailsSampling
+			config.ErrorDetailsEndpoint = errorDetailsEndpoint
+			config.ErrorDetailsTotal = errorDetailsTotal
+			config.ErrorDetailsMaxSize = errorDetailsMaxSize
+			config.RouteTemplates = routeTemplates
+			config.InferRouteTemplates = inferRouteTemplates
+			config.TracingEndpoint = tracingEndpoint
+			config.Sinks = sinks
+			config.WebhookSecret = webhookSecret
+			config.WebhookBatchSize = webhookBatchSize
+			config.WebhookBatchInterval = webhookBatchInterval
+			config.WebhookMaxRetries = webhookMaxRetries
+			config.WebhookRateLimit = webhookRateLimit
+			config.RedactHeaders = redactHeaders
+			config.RedactPointers = redactPointers
+			config.RedactPatterns = redactPatterns
+			config.RedactMode = redactMode
+			config.VerdictMaxRegressionRate = verdictMaxRegressionRate
+			config.VerdictMaxRouteRegressionRate = verdictMaxRouteRegressionRate
+			config.VerdictMinSamples = verdictMinSamples
+			config.VerdictMaxLatencyRatio = verdictMaxLatencyRatio
+			config.VerdictMinConfidence = verdictMinConfidence
+			config.LatencyBudget = latencyBudget
+			config.LatencyBudgetRatio = latencyBudgetRatio
+			config.StatusEquivalences = statusEquivalences
 			config.NoiseDetection = noiseDetection
 			config.AllowUnsafeOperations = allowUnsafeOperations
 			config.Headers = headers
@@ -68,6 +128,14 @@ func main() {
 			config.LevenshteinPercentage = levenshteinPercentage
 			config.Mirroring = mirroring
 			config.ReturnResult = returnResult
+			config.AdminTokensFile = adminTokensFile
+			config.AdminBasicAuthFile = adminBasicAuthFile
+			config.AdminCert = adminCert
+			config.AdminKey = adminKey
+			config.AdminClientCa = adminClientCa
+			config.AdminClientCertRoles = adminClientCertRoles
+			config.AdminAuditLog = adminAuditLog
+			config.AdminInsecure = adminInsecure
 
 			differenceMode, err := core.NewDifference(difference)
 
@@ -77,18 +145,8 @@ func main() {
 			}
 			config.DifferenceMode = differenceMode
 
-			if mirroring && returnResult {
-				logrus.Errorf("You cannot set Returning Result of comparision and mirroring at the same time.")
-				os.Exit(1)
-			}
-
-			if !areHttpsClientAttributesCorrect(caCert, clientCert, clientKey) {
-				logrus.Errorf("Https Client options should either not provided or all of them provided but not only some. caCert: %s, clientCert: %s, clientkey: %s.", caCert, clientCert, clientKey)
-				os.Exit(1)
-			}
-
-			if noiseDetection && len(secondaryURL) == 0 {
-				logrus.Errorf("If Noise Detection is enabled, you need to provide a secondary URL as well")
+			if err := config.Validate(); err != nil {
+				logrus.Error(err.Error())
 				os.Exit(1)
 			}
 
@@ -111,7 +169,46 @@ func main() {
 	cmdStart.Flags().StringVarP(&difference, "difference", "d", "Strict", "Difference mode to compare JSONs")
 	cmdStart.Flags().BoolVarP(&allowUnsafeOperations, "unsafe", "u", false, "Allow none safe operations like PUT, POST, PATCH, ...")
 	cmdStart.Flags().BoolVarP(&noiseDetection, "noisedetection", "n", false, "Enable noise detection. Secondary URL must be provided.")
-	cmdStart.Flags().StringVar(&storeResults, "storeResults", "", "Directory where output is set. If not specified then nothing is stored. Useful for local development.")
+	cmdStart.Flags().StringVar(&storeResults, "storeResults", "", "Directory (or file) where each interaction is appended as a JSON line. If not specified then nothing is stored. Useful for local development.")
+	cmdStart.Flags().IntVar(&storeResultsMaxSize, "storeResultsMaxSize", 0, "Size in megabytes of stored results before rotating them. 0 means no size rotation.")
+	cmdStart.Flags().StringVar(&storeResultsMaxAge, "storeResultsMaxAge", "", "Age (ie 24h) of stored results before rotating them. If not specified then there is no time rotation.")
+	cmdStart.Flags().BoolVar(&storeResultsCompress, "storeResultsCompress", false, "Compress rotated results with gzip.")
+	cmdStart.Flags().IntVar(&storeResultsBackups, "storeResultsBackups", 0, "Number of rotated results files kept. 0 means all of them are kept.")
+	cmdStart.Flags().StringVar(&snapshotMode, "snapshotMode", "", "Snapshot mode: record stores primary and secondary responses, compare uses them instead of calling primary. If not specified then snapshots are not used.")
+	cmdStart.Flags().StringVar(&snapshotDir, "snapshotDir", "", "Directory where snapshots are stored")
+	cmdStart.Flags().StringVar(&snapshotMaxAge, "snapshotMaxAge", "", "Age (ie 168h) after which a snapshot is stale and not used. If not specified then snapshots never are stale.")
+	cmdStart.Flags().StringVar(&statsStore, "statsStore", "", "File where stats are persisted so they survive restarts. If not specified then stats are kept in memory.")
+
+	cmdStart.Flags().StringVar(&errorDetailsSampling, "errorDetailsSampling", "ring", "Strategy to choose stored error details of an endpoint: ring (latest ones), reservoir (random sample) or unique (one for each different diff).")
+	cmdStart.Flags().IntVar(&errorDetailsEndpoint, "errorDetailsEndpoint", 20, "Maximum number of error details stored for each endpoint. Error counters are always exact.")
+	cmdStart.Flags().IntVar(&errorDetailsTotal, "errorDetailsTotal", 1000, "Maximum number of error details stored for all endpoints.")
+	cmdStart.Flags().IntVar(&errorDetailsMaxSize, "errorDetailsMaxSize", 65536, "Maximum size in bytes of URI, headers, body and diffs of each stored error detail.")
+
+	cmdStart.Flags().StringSliceVar(&routeTemplates, "routeTemplates", nil, "List of route templates like /users/{id} used to group stats and metrics.")
+	cmdStart.Flags().BoolVar(&inferRouteTemplates, "inferRouteTemplates", false, "Group stats and metrics of paths not matching any route template by replacing numeric, UUID and hash segments with {id}.")
+
+	cmdStart.Flags().StringVar(&tracingEndpoint, "tracingEndpoint", "", "OTLP over HTTP endpoint (ie http://localhost:4318) where traces of each comparison are exported. If not specified then traces are not exported.")
+
+	cmdStart.Flags().StringSliceVar(&sinks, "sinks", nil, "List of sinks receiving the result of every comparison: webhook:<url> posts regressions to url and log logs them.")
+	cmdStart.Flags().StringVar(&webhookSecret, "webhookSecret", "", "Secret used to sign webhook requests with HMAC-SHA256. It can also be set with "+exporter.WebhookSecretEnv+" environment variable.")
+	cmdStart.Flags().IntVar(&webhookBatchSize, "webhookBatchSize", 10, "Maximum number of regressions sent in each webhook request.")
+	cmdStart.Flags().StringVar(&webhookBatchInterval, "webhookBatchInterval", "5s", "Maximum time a regression waits to be sent to webhooks.")
+	cmdStart.Flags().IntVar(&webhookMaxRetries, "webhookMaxRetries", 3, "Number of retries of a failed webhook request.")
+	cmdStart.Flags().Float64Var(&webhookRateLimit, "webhookRateLimit", 0, "Maximum number of requests per second to each webhook. 0 means no limit.")
+
+	cmdStart.Flags().StringSliceVar(&redactHeaders, "redactHeaders", []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}, "List of headers whose values are redacted before storing, logging, sending or returning results.")
+	cmdStart.Flags().StringSliceVar(&redactPointers, "redactPointers", nil, "List of JSON Pointers of body values to redact. A * segment matches any field or array index (ie /users/*/password).")
+	cmdStart.Flags().StringArrayVar(&redactPatterns, "redactPatterns", nil, "Regular expression of text to redact anywhere like card numbers or emails. It can be repeated.")
+	cmdStart.Flags().StringVar(&redactMode, "redactMode", redact.MaskMode, "Redaction mode: mask replaces values with [REDACTED] and hash with a SHA-256 prefix so equal values can be correlated.")
+
+	cmdStart.Flags().Float64Var(&verdictMaxRegressionRate, "verdictMaxRegressionRate", 0, "Maximum percentage of regressions of all comparisons to pass the verdict.")
+	cmdStart.Flags().Float64Var(&verdictMaxRouteRegressionRate, "verdictMaxRouteRegressionRate", 0, "Maximum percentage of regressions of each route to pass the verdict. 0 means routes are not checked individually.")
+	cmdStart.Flags().IntVar(&verdictMinSamples, "verdictMinSamples", 0, "Minimum number of comparisons to give a verdict. Routes with less comparisons are not checked individually.")
+	cmdStart.Flags().Float64Var(&verdictMaxLatencyRatio, "verdictMaxLatencyRatio", 0, "Maximum ratio between candidate and primary average durations to pass the verdict. 0 means no limit.")
+	cmdStart.Flags().Float64Var(&verdictMinConfidence, "verdictMinConfidence", 0, "Minimum confidence percentage of statistical tests to fail the verdict. 0 means tests are not applied.")
+	cmdStart.Flags().StringVar(&latencyBudget, "latencyBudget", "", "Maximum extra time candidate can take compared to primary before the comparison is reported as slow (ie 100ms). Empty means no limit.")
+	cmdStart.Flags().StringArrayVar(&statusEquivalences, "statusEquivalences", nil, "Status codes considered equivalent by route like POST /users=200,201 or *=404,410. Use class to match status codes of the same class. It can be repeated.")
+	cmdStart.Flags().Float64Var(&latencyBudgetRatio, "latencyBudgetRatio", 0, "Maximum ratio between candidate and primary durations before the comparison is reported as slow (ie 1.5). 0 means no limit.")
 
 	cmdStart.Flags().StringVarP(&logLevel, "logLevel", "l", "error", "Set log level")
 
@@ -125,6 +222,14 @@ func main() {
 	cmdStart.Flags().IntVar(&prometheusPort, "prometheusPort", 8081, "Prometheus port")
 
 	cmdStart.Flags().IntVar(&adminPort, "adminPort", 8082, "Admin port")
+	cmdStart.Flags().StringVar(&adminTokensFile, "adminTokensFile", "", "File where each line is 'name role token' of bearer tokens allowed in admin endpoints. Tokens can also be set in DIFERENCIA_ADMIN_TOKENS environment variable.")
+	cmdStart.Flags().StringVar(&adminBasicAuthFile, "adminBasicAuthFile", "", "File where each line is 'name role bcrypt-hash' of users allowed in admin endpoints.")
+	cmdStart.Flags().StringVar(&adminCert, "adminCert", "", "Certificate path (PEM) to serve admin endpoints with https")
+	cmdStart.Flags().StringVar(&adminKey, "adminKey", "", "Key path (PEM) to serve admin endpoints with https")
+	cmdStart.Flags().StringVar(&adminClientCa, "adminClientCa", "", "Certificate Authority path (PEM) to verify client certificates of admin endpoints")
+	cmdStart.Flags().StringSliceVar(&adminClientCertRoles, "adminClientCertRoles", nil, "List of CommonName=role of client certificates allowed in admin endpoints. Roles are readonly and admin.")
+	cmdStart.Flags().StringVar(&adminAuditLog, "adminAuditLog", "", "File where configuration changes are audited. If not specified changes are only logged.")
+	cmdStart.Flags().BoolVar(&adminInsecure, "adminInsecure", false, "Allow anonymous queries and changes through admin endpoints when no admin authentication is configured. Otherwise every request is rejected.")
 
 	cmdStart.Flags().BoolVar(&insecureSkipVerify, "insecureSkipVerify", false, "Sets Insecure Skip Verify flag in Http Client")
 	cmdStart.Flags().StringVar(&caCert, "caCert", "", "Certificate Authority path (PEM)")
@@ -136,13 +241,208 @@ func main() {
 
 	cmdStart.Flags().BoolVarP(&mirroring, "mirroring", "m", false, "Starts Diferencia in mirroring mode which means that the output provided is the one provided by primary")
 	cmdStart.Flags().BoolVar(&returnResult, "returnResult", false, "Set Diferencia to return all avalable information about the current comparision and not only the http status code.")
-	cmdStart.MarkFlagRequired("primary")
 	cmdStart.MarkFlagRequired("candidate")
 
+	var input, inputFormat, target, order string
+	var concurrency int
+	var rate, failureThreshold float64
+	var seed int64
+	var timeout time.Duration
+
+	var cmdReplay = &cobra.Command{
+		Use:   "replay",
+		Short: "Replay recorded traffic through Diferencia",
+		Long:  `replay sends each recorded request to a running Diferencia proxy and prints a summary of equal, different and error responses per endpoint`,
+		Run: func(cmd *cobra.Command, args []string) {
+			log.Initialize(logLevel)
+
+			requests, err := replay.LoadFile(input, inputFormat)
+			if err != nil {
+				logrus.Errorf("Error reading %s. %s", input, err.Error())
+				os.Exit(1)
+			}
+
+			summary, err := replay.Run(requests, replay.Options{
+				Target:         target,
+				Concurrency:    concurrency,
+				Rate:           rate,
+				Order:          order,
+				Seed:           seed,
+				Timeout:        timeout,
+				RouteTemplates: routeTemplates,
+			})
+			if err != nil {
+				logrus.Error(err.Error())
+				os.Exit(1)
+			}
+
+			summary.Print(os.Stdout)
+
+			if summary.FailurePercentage() > failureThreshold {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmdReplay.Flags().StringVarP(&input, "input", "i", "", "File where each line is a recorded request (method, uri, headers and body) or an interaction stored with storeResults, or an HAR file")
+	cmdReplay.Flags().StringVar(&inputFormat, "inputFormat", "", "Format of input: jsonl or har. By default it is inferred from file extension.")
+	cmdReplay.Flags().StringVarP(&target, "target", "t", "", "Diferencia proxy URL")
+	cmdReplay.Flags().IntVar(&concurrency, "concurrency", 1, "Number of requests sent at the same time")
+	cmdReplay.Flags().Float64Var(&rate, "rate", 0, "Maximum number of requests per second. 0 means no limit.")
+	cmdReplay.Flags().StringVar(&order, "order", replay.RecordedOrder, "Order of requests: recorded or random")
+	cmdReplay.Flags().Int64Var(&seed, "seed", time.Now().UnixNano(), "Seed of random order, so a replay can be repeated")
+	cmdReplay.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "Timeout of each request")
+	cmdReplay.Flags().StringSliceVar(&routeTemplates, "routeTemplates", nil, "List of route templates like /users/{id} used to group endpoints in summary.")
+	cmdReplay.Flags().Float64Var(&failureThreshold, "failureThreshold", 0, "Maximum percentage of different and error responses before exiting with 1")
+	cmdReplay.Flags().StringVarP(&logLevel, "logLevel", "l", "error", "Set log level")
+	cmdReplay.MarkFlagRequired("input")
+	cmdReplay.MarkFlagRequired("target")
+
+	var output string
+	var onlyFailures bool
+
+	var cmdExport = &cobra.Command{
+		Use:   "export",
+		Short: "Export stored interactions as HAR",
+		Long:  `export converts interactions stored with storeResults to an HAR file, with an entry for each upstream response, so they can be inspected in HAR viewers`,
+		Run: func(cmd *cobra.Command, args []string) {
+			log.Initialize(logLevel)
+
+			interactions, err := exporter.LoadInteractions(input)
+			if err != nil {
+				logrus.Errorf("Error reading %s. %s", input, err.Error())
+				os.Exit(1)
+			}
+
+			if onlyFailures {
+				var failures []exporter.Interactions
+				for _, interaction := range interactions {
+					if !interaction.Result {
+						failures = append(failures, interaction)
+					}
+				}
+				interactions = failures
+			}
+
+			file, err := os.Create(output)
+			if err != nil {
+				logrus.Errorf("Error creating %s. %s", output, err.Error())
+				os.Exit(1)
+			}
+			defer file.Close()
+
+			if err := har.FromInteractions(interactions).Write(file); err != nil {
+				logrus.Errorf("Error writing %s. %s", output, err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmdExport.Flags().StringVarP(&input, "input", "i", "", "Interactions file stored with storeResults. Rotated files compressed with gzip are supported.")
+	cmdExport.Flags().StringVarP(&output, "output", "o", "", "HAR file to create")
+	cmdExport.Flags().BoolVar(&onlyFailures, "onlyFailures", false, "Export only interactions where primary and candidate are different")
+	cmdExport.Flags().StringVarP(&logLevel, "logLevel", "l", "error", "Set log level")
+	cmdExport.MarkFlagRequired("input")
+	cmdExport.MarkFlagRequired("output")
+
+	var compareSecondary, primaryHeaders, secondaryHeaders, candidateHeaders, outputFormat string
+	var primaryStatus, secondaryStatus, candidateStatus int
+
+	var cmdCompare = &cobra.Command{
+		Use:   "compare primary candidate",
+		Short: "Compare two saved responses",
+		Long:  `compare checks if two saved responses are equal with the same rules used by Diferencia proxy. It exits with 0 if they are equal, 1 if they are different and 2 if they cannot be compared`,
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			log.Initialize(logLevel)
+
+			config := core.DiferenciaConfiguration{
+				IgnoreHeadersValues:   ignoreHeadersValues,
+				IgnoreValues:          ignoreValuesOf,
+				IgnoreValuesFile:      ignoreValuesFile,
+				ForcePlainText:        forcePlainText,
+				LevenshteinPercentage: levenshteinPercentage,
+				StatusEquivalences:    statusEquivalences,
+				// Headers are compared when given
+				Headers: len(primaryHeaders) > 0 && len(candidateHeaders) > 0,
+			}
+
+			if outputFormat != "text" && outputFormat != "json" {
+				logrus.Errorf("Cannot find %s output. Valid outputs are text and json", outputFormat)
+				os.Exit(2)
+			}
+
+			differenceMode, err := core.NewDifference(difference)
+			if err != nil {
+				logrus.Errorf("Error while setting difference mode. %s", err.Error())
+				os.Exit(2)
+			}
+			config.DifferenceMode = differenceMode
+
+			primary, err := readPayload(args[0], primaryHeaders, primaryStatus)
+			if err != nil {
+				logrus.Errorf("Error reading primary. %s", err.Error())
+				os.Exit(2)
+			}
+			candidate, err := readPayload(args[1], candidateHeaders, candidateStatus)
+			if err != nil {
+				logrus.Errorf("Error reading candidate. %s", err.Error())
+				os.Exit(2)
+			}
+
+			var secondary *core.Communicationcontent
+			if len(compareSecondary) > 0 {
+				content, err := readPayload(compareSecondary, secondaryHeaders, secondaryStatus)
+				if err != nil {
+					logrus.Errorf("Error reading secondary. %s", err.Error())
+					os.Exit(2)
+				}
+				secondary = &content
+			}
+
+			result, err := core.Compare(config, primary, secondary, candidate)
+			if err != nil {
+				logrus.Error(err.Error())
+				os.Exit(2)
+			}
+
+			if outputFormat == "json" {
+				content, _ := result.MarshallJson()
+				fmt.Println(string(content))
+			} else {
+				printDifferences(result)
+			}
+
+			if !result.EqualContent {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmdCompare.Flags().StringVarP(&compareSecondary, "secondary", "s", "", "Secondary response used to detect and remove noise")
+	cmdCompare.Flags().StringVar(&primaryHeaders, "primaryHeaders", "", "File where each line is a primary response header like Name: value")
+	cmdCompare.Flags().StringVar(&secondaryHeaders, "secondaryHeaders", "", "File where each line is a secondary response header like Name: value")
+	cmdCompare.Flags().StringVar(&candidateHeaders, "candidateHeaders", "", "File where each line is a candidate response header like Name: value")
+	cmdCompare.Flags().IntVar(&primaryStatus, "primaryStatus", http.StatusOK, "Status code of primary response")
+	cmdCompare.Flags().IntVar(&secondaryStatus, "secondaryStatus", http.StatusOK, "Status code of secondary response")
+	cmdCompare.Flags().IntVar(&candidateStatus, "candidateStatus", http.StatusOK, "Status code of candidate response")
+	cmdCompare.Flags().StringVarP(&difference, "difference", "d", "Strict", "Difference mode to compare JSONs")
+	cmdCompare.Flags().StringSliceVar(&ignoreHeadersValues, "ignoreHeadersValues", nil, "List of headers key where their value must be ignored for comparision purposes.")
+	cmdCompare.Flags().StringArrayVar(&statusEquivalences, "statusEquivalences", nil, "Status codes considered equivalent like *=404,410 or *=class. Only rules of any method and route apply. It can be repeated.")
+	cmdCompare.Flags().StringSliceVar(&ignoreValuesOf, "ignoreValues", nil, "List of JSON Pointers of values that must be ignored for comparision purposes. Secondary must be provided.")
+	cmdCompare.Flags().StringVar(&ignoreValuesFile, "ignoreValuesFile", "", "File location where each line is a JSON pointers definition for ignoring values. Secondary must be provided.")
+	cmdCompare.Flags().BoolVar(&forcePlainText, "forcePlainText", false, "Force the received of content type as plain text instead of json")
+	cmdCompare.Flags().IntVar(&levenshteinPercentage, "levenshteinPercentage", 100, "Sets the minimum percentage to be equal in case of using plain text (40, 79, 90, ...)")
+	cmdCompare.Flags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text or json")
+	cmdCompare.Flags().StringVarP(&logLevel, "logLevel", "l", "error", "Set log level")
+
 	rootCmd.AddCommand(cmdStart)
+	rootCmd.AddCommand(cmdReplay)
+	rootCmd.AddCommand(cmdExport)
+	rootCmd.AddCommand(cmdCompare)
 
 	if err := rootCmd.Execute(); err != nil {
-		logrus.Errorf(err.Error())
+		logrus.Error(err.Error())
 		os.Exit(1)
 	}
 
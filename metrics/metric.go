@@ -1,25 +1,250 @@
 package metrics
 
 import (
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// RegisterNumberOfRegressions cpunter to Prometheus register
-func RegisterNumberOfRegressions(namespace string) *prometheus.CounterVec {
+const (
+	// Primary upstream label value
+	Primary = "primary"
+	// Candidate upstream label value
+	Candidate = "candidate"
+	// Secondary upstream label value
+	Secondary = "secondary"
+)
+
+const namespace = "diferencia"
+
+var comparisonLabels = []string{"service", "candidate", "method", "route"}
+
+// Comparison contains all metrics of the comparison pipeline registered in its own registry.
+// Service and candidate are labels, so metrics are registered only once and series of retired candidates can be removed.
+type Comparison struct {
+	sync.Mutex
+	// label values of each created series by metric, to be able to remove them
+	series                 map[prometheus.Collector]map[string][]string
+	registry               *prometheus.Registry
+	regressions            *prometheus.CounterVec
+	successes              *prometheus.CounterVec
+	total                  *prometheus.CounterVec
+	slow                   *prometheus.CounterVec
+	latency                *prometheus.HistogramVec
+	latencyRatio           *prometheus.HistogramVec
+	upstreamErrors         *prometheus.CounterVec
+	noiseDetectionFailures *prometheus.CounterVec
+	skipped                *prometheus.CounterVec
+	bodySize               *prometheus.HistogramVec
+}
+
+// Labels identifying a comparison
+type Labels struct {
+	Service   string
+	Candidate string
+	Method    string
+	Route     string
+}
+
+func (l Labels) values(extra ...string) []string {
+	return append([]string{l.Service, l.Candidate, l.Method, l.Route}, extra...)
+}
+
+// NewComparison creates and registers all metrics of the comparison pipeline in a dedicated registry
+func NewComparison() *Comparison {
+
+	c := &Comparison{
+		series:   make(map[prometheus.Collector]map[string][]string),
+		registry: prometheus.NewRegistry(),
+		regressions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_regressions_failures_total",
+			Help:      "Number of regressions detected by endpoints.",
+		}, comparisonLabels),
+		successes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_comparisons_success_total",
+			Help:      "Number of comparisons where primary and candidate are equal.",
+		}, comparisonLabels),
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_comparisons_total",
+			Help:      "Number of comparisons done.",
+		}, comparisonLabels),
+		slow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_comparisons_slow_total",
+			Help:      "Number of comparisons where candidate exceeds the latency budget.",
+		}, comparisonLabels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "service_upstream_latency_seconds",
+			Help:      "Latency of calls to primary, candidate and secondary.",
+			Buckets:   prometheus.DefBuckets,
+		}, append(comparisonLabels, "upstream")),
+		latencyRatio: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "service_candidate_primary_latency_ratio",
+			Help:      "Ratio between candidate and primary latencies.",
+			Buckets:   []float64{0.25, 0.5, 0.75, 1, 1.25, 1.5, 2, 3, 5, 10},
+		}, comparisonLabels),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_upstream_errors_total",
+			Help:      "Number of errors connecting to primary, candidate and secondary by type.",
+		}, append(comparisonLabels, "upstream", "type")),
+		noiseDetectionFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_noise_detection_failures_total",
+			Help:      "Number of comparisons where noise could not be detected.",
+		}, append(comparisonLabels, "reason")),
+		skipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_comparisons_skipped_total",
+			Help:      "Number of requests that were not compared.",
+		}, append(comparisonLabels, "reason")),
+		bodySize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "service_response_body_size_bytes",
+			Help:      "Size of response bodies of primary, candidate and secondary.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		}, append(comparisonLabels, "upstream")),
+	}
+
+	c.registry.MustRegister(c.regressions, c.successes, c.total, c.slow, c.latency, c.latencyRatio,
+		c.upstreamErrors, c.noiseDetectionFailures, c.skipped, c.bodySize)
+	c.registry.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	return c
+}
+
+// Retire removes all series of the given service and candidate, for example when candidate is changed at runtime
+func (c *Comparison) Retire(service, candidate string) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for collector, series := range c.series {
+		for key, values := range series {
+			if values[0] != service || values[1] != candidate {
+				continue
+			}
+			switch vec := collector.(type) {
+			case *prometheus.CounterVec:
+				vec.DeleteLabelValues(values...)
+			case *prometheus.HistogramVec:
+				vec.DeleteLabelValues(values...)
+			}
+			delete(series, key)
+		}
+	}
+}
+
+// track registers label values of a series so it can be removed later
+func (c *Comparison) track(collector prometheus.Collector, values []string) []string {
+	c.Lock()
+	defer c.Unlock()
+
+	series, ok := c.series[collector]
+	if !ok {
+		series = make(map[string][]string)
+		c.series[collector] = series
+	}
+	series[strings.Join(values, "\x00")] = values
+
+	return values
+}
+
+func (c *Comparison) counter(vec *prometheus.CounterVec, values []string) prometheus.Counter {
+	return vec.WithLabelValues(c.track(vec, values)...)
+}
+
+func (c *Comparison) histogram(vec *prometheus.HistogramVec, values []string) prometheus.Observer {
+	return vec.WithLabelValues(c.track(vec, values)...)
+}
+
+// Handler exposing metrics of the registry
+func (c *Comparison) Handler() http.Handler {
+	return promhttp.HandlerFor(c.registry, promhttp.HandlerOpts{})
+}
+
+// Registry where metrics are registered
+func (c *Comparison) Registry() *prometheus.Registry {
+	return c.registry
+}
+
+// Compared registers the result of a comparison. Calling methods of a nil Comparison does nothing.
+func (c *Comparison) Compared(labels Labels, equal bool) {
+	if c == nil {
+		return
+	}
+
+	c.counter(c.total, labels.values()).Inc()
+	if equal {
+		c.counter(c.successes, labels.values()).Inc()
+	} else {
+		c.counter(c.regressions, labels.values()).Inc()
+	}
+}
+
+// Slow registers a comparison where candidate exceeds the latency budget
+func (c *Comparison) Slow(labels Labels) {
+	if c == nil {
+		return
+	}
 
-	filteredNamespace := strings.Replace(namespace, ".", "_", -1)
+	c.counter(c.slow, labels.values()).Inc()
+}
 
-	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
-		Namespace: filteredNamespace,
-		Name:      "service_regressions_failures_total",
-		Help:      "Number of regressions detected by endpoints.",
-	},
-		[]string{"method", "path"},
-	)
+// UpstreamCalled registers latency and body size of a call to an upstream
+func (c *Comparison) UpstreamCalled(labels Labels, upstream string, elapsed time.Duration, bodySize int) {
+	if c == nil {
+		return
+	}
+
+	c.histogram(c.latency, labels.values(upstream)).Observe(elapsed.Seconds())
+	c.histogram(c.bodySize, labels.values(upstream)).Observe(float64(bodySize))
+}
+
+// LatencyRatio registers the ratio between candidate and primary latencies
+func (c *Comparison) LatencyRatio(labels Labels, primary, candidate time.Duration) {
+	if c == nil || primary <= 0 {
+		return
+	}
+
+	c.histogram(c.latencyRatio, labels.values()).Observe(float64(candidate) / float64(primary))
+}
+
+// UpstreamFailed registers an error connecting to an upstream
+func (c *Comparison) UpstreamFailed(labels Labels, upstream, errorType string) {
+	if c == nil {
+		return
+	}
+
+	c.counter(c.upstreamErrors, labels.values(upstream, errorType)).Inc()
+}
+
+// NoiseDetectionFailed registers a comparison where noise could not be detected
+func (c *Comparison) NoiseDetectionFailed(labels Labels, reason string) {
+	if c == nil {
+		return
+	}
+
+	c.counter(c.noiseDetectionFailures, labels.values(reason)).Inc()
+}
 
-	prometheus.MustRegister(counter)
+// Skipped registers a request that was not compared
+func (c *Comparison) Skipped(labels Labels, reason string) {
+	if c == nil {
+		return
+	}
 
-	return counter
+	c.counter(c.skipped, labels.values(reason)).Inc()
 }
@@ -0,0 +1,132 @@
+package metrics_test
+
+import (
+	"time"
+
+	"github.com/lordofthejars/diferencia/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var _ = Describe("Comparison Metrics", func() {
+
+	labels := metrics.Labels{Service: "now.httpbin.org", Candidate: "http://candidate", Method: "GET", Route: "/users/{id}"}
+
+	Describe("Register comparisons", func() {
+		Context("With results", func() {
+			It("should count totals, successes and regressions", func() {
+
+				// Given
+				comparison := metrics.NewComparison()
+
+				// When
+				comparison.Compared(labels, true)
+				comparison.Compared(labels, false)
+				comparison.Compared(labels, false)
+
+				// Then
+				families := gather(comparison)
+				Expect(counterValue(families, "diferencia_service_comparisons_total")).Should(Equal(float64(3)))
+				Expect(counterValue(families, "diferencia_service_comparisons_success_total")).Should(Equal(float64(1)))
+				Expect(counterValue(families, "diferencia_service_regressions_failures_total")).Should(Equal(float64(2)))
+			})
+
+			It("should observe latencies by upstream", func() {
+
+				// Given
+				comparison := metrics.NewComparison()
+
+				// When
+				comparison.UpstreamCalled(labels, metrics.Primary, 10*time.Millisecond, 100)
+				comparison.UpstreamCalled(labels, metrics.Candidate, 30*time.Millisecond, 100)
+				comparison.LatencyRatio(labels, 10*time.Millisecond, 30*time.Millisecond)
+
+				// Then
+				families := gather(comparison)
+				Expect(families["diferencia_service_upstream_latency_seconds"].Metric).Should(HaveLen(2))
+				Expect(families["diferencia_service_candidate_primary_latency_ratio"].Metric[0].Histogram.GetSampleSum()).Should(BeNumerically("~", 3, 0.001))
+			})
+		})
+
+		Context("With candidate changes", func() {
+			It("should remove series of retired candidate", func() {
+
+				// Given
+				comparison := metrics.NewComparison()
+				newCandidate := labels
+				newCandidate.Candidate = "http://new-candidate"
+
+				comparison.Compared(labels, true)
+				comparison.UpstreamFailed(labels, metrics.Candidate, "timeout")
+				comparison.Compared(newCandidate, true)
+
+				// When
+				comparison.Retire(labels.Service, labels.Candidate)
+
+				// Then
+				families := gather(comparison)
+				Expect(families["diferencia_service_comparisons_total"].Metric).Should(HaveLen(1))
+				Expect(labelValue(families["diferencia_service_comparisons_total"].Metric[0], "candidate")).Should(Equal("http://new-candidate"))
+				Expect(families).ShouldNot(HaveKey("diferencia_service_upstream_errors_total"))
+			})
+
+			It("should keep registering metrics of retired candidate", func() {
+
+				// Given
+				comparison := metrics.NewComparison()
+				comparison.Compared(labels, false)
+
+				// When
+				comparison.Retire(labels.Service, labels.Candidate)
+				comparison.Compared(labels, true)
+
+				// Then
+				families := gather(comparison)
+				Expect(counterValue(families, "diferencia_service_comparisons_total")).Should(Equal(float64(1)))
+				Expect(families).ShouldNot(HaveKey("diferencia_service_regressions_failures_total"))
+			})
+		})
+
+		Context("Without Prometheus enabled", func() {
+			It("should ignore registrations", func() {
+
+				// Given
+				var comparison *metrics.Comparison
+
+				// When
+				comparison.Compared(labels, true)
+				comparison.Skipped(labels, "unsafe_method")
+
+				// Then
+				Expect(comparison).Should(BeNil())
+			})
+		})
+	})
+})
+
+func gather(comparison *metrics.Comparison) map[string]*dto.MetricFamily {
+	families, err := comparison.Registry().Gather()
+	Expect(err).Should(Succeed())
+
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+func counterValue(families map[string]*dto.MetricFamily, name string) float64 {
+	family, ok := families[name]
+	Expect(ok).Should(BeTrue(), name)
+	return family.Metric[0].Counter.GetValue()
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, label := range metric.Label {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lordofthejars/diferencia/core"
+)
+
+// readPayload reads a saved response. Headers file is optional and, if it does not set the content type, it is inferred from payload extension.
+func readPayload(file, headersFile string, status int) (core.Communicationcontent, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return core.Communicationcontent{}, err
+	}
+
+	headers := http.Header{}
+	if len(headersFile) > 0 {
+		headers, err = readHeaders(headersFile)
+		if err != nil {
+			return core.Communicationcontent{}, err
+		}
+	}
+
+	if len(headers.Get("Content-Type")) == 0 {
+		if contentType := mime.TypeByExtension(filepath.Ext(file)); len(contentType) > 0 {
+			headers.Set("Content-Type", contentType)
+		}
+	}
+
+	return core.Communicationcontent{Content: content, StatusCode: status, Header: headers}, nil
+}
+
+// readHeaders reads a file where each line is a header like Name: value. Empty lines and lines starting with # are ignored.
+func readHeaders(file string) (http.Header, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	headers := http.Header{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Line %d of %s is not a header like Name: value", line, file)
+		}
+		headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return headers, scanner.Err()
+}
+
+// printDifferences of result as text
+func printDifferences(result core.Result) {
+	if result.EqualContent {
+		fmt.Println("Result: equal")
+		return
+	}
+
+	fmt.Println("Result: different")
+	if description := result.Diff.String(); len(description) > 0 {
+		fmt.Println(description)
+	}
+}
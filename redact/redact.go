@@ -0,0 +1,231 @@
+package redact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Mask replaces redacted values in mask mode
+	Mask = "[REDACTED]"
+	// MaskMode replaces redacted values with Mask
+	MaskMode = "mask"
+	// HashMode replaces redacted values with a hash, so equal values can still be correlated
+	HashMode = "hash"
+	// Wildcard matches any segment of a JSON Pointer
+	Wildcard = "*"
+)
+
+// Rules to redact sensitive data
+type Rules struct {
+	// Headers names (case insensitive) whose values are redacted
+	Headers []string
+	// Pointers are JSON Pointers of body values to redact. A * segment matches any field or array index.
+	Pointers []string
+	// Patterns are regular expressions of text to redact anywhere (ie card numbers or emails)
+	Patterns []string
+	// Mode is mask (default) or hash
+	Mode string
+}
+
+// Redactor removes sensitive data following rules. A nil Redactor does not redact anything.
+type Redactor struct {
+	headers  map[string]bool
+	pointers [][]string
+	patterns []*regexp.Regexp
+	hash     bool
+}
+
+// IsValidMode checks if mode is known. Empty mode means mask.
+func IsValidMode(mode string) bool {
+	return len(mode) == 0 || mode == MaskMode || mode == HashMode
+}
+
+// New creates a redactor for given rules
+func New(rules Rules) (*Redactor, error) {
+
+	if !IsValidMode(rules.Mode) {
+		return nil, fmt.Errorf("Cannot find %s redaction mode. Valid modes are %s and %s", rules.Mode, MaskMode, HashMode)
+	}
+
+	r := &Redactor{
+		headers: make(map[string]bool),
+		hash:    rules.Mode == HashMode,
+	}
+
+	for _, header := range rules.Headers {
+		r.headers[http.CanonicalHeaderKey(strings.TrimSpace(header))] = true
+	}
+
+	for _, pointer := range rules.Pointers {
+		if !strings.HasPrefix(pointer, "/") {
+			return nil, fmt.Errorf("Redaction pointer %s is not a valid JSON Pointer", pointer)
+		}
+		r.pointers = append(r.pointers, segments(pointer))
+	}
+
+	for _, pattern := range rules.Patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Redaction pattern %s is not valid. %s", pattern, err.Error())
+		}
+		r.patterns = append(r.patterns, compiled)
+	}
+
+	return r, nil
+}
+
+// segments of a JSON Pointer unescaping ~1 and ~0
+func segments(pointer string) []string {
+	parts := strings.Split(pointer[1:], "/")
+	for i, part := range parts {
+		parts[i] = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+	}
+	return parts
+}
+
+// value returns the replacement of a sensitive value
+func (r *Redactor) value(sensitive string) string {
+	if r.hash {
+		sum := sha256.Sum256([]byte(sensitive))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	return Mask
+}
+
+// Text redacts everything matching patterns
+func (r *Redactor) Text(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllStringFunc(text, r.value)
+	}
+	return text
+}
+
+// IsSensitiveHeader checks if values of header must be redacted
+func (r *Redactor) IsSensitiveHeader(name string) bool {
+	return r != nil && r.headers[http.CanonicalHeaderKey(name)]
+}
+
+// Headers returns a copy of headers with sensitive ones redacted
+func (r *Redactor) Headers(headers http.Header) http.Header {
+	if r == nil || headers == nil {
+		return headers
+	}
+
+	redacted := http.Header{}
+	for name, values := range headers {
+		for _, value := range values {
+			if r.IsSensitiveHeader(name) {
+				redacted.Add(name, r.value(value))
+			} else {
+				redacted.Add(name, r.Text(value))
+			}
+		}
+	}
+	return redacted
+}
+
+// Cookies redacts the values of cookies in Set-Cookie format if Set-Cookie header is sensitive, keeping their names
+func (r *Redactor) Cookies(cookies []string) []string {
+	if r == nil || cookies == nil {
+		return cookies
+	}
+
+	redacted := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		if r.IsSensitiveHeader("Set-Cookie") {
+			name := strings.SplitN(cookie, "=", 2)[0]
+			redacted = append(redacted, name+"="+r.value(cookie))
+		} else {
+			redacted = append(redacted, r.Text(cookie))
+		}
+	}
+	return redacted
+}
+
+// HeadersDiff redacts values of sensitive headers in a diff where each line is name:diff
+func (r *Redactor) HeadersDiff(diff string) string {
+	if r == nil || len(diff) == 0 {
+		return diff
+	}
+
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && r.IsSensitiveHeader(parts[0]) {
+			lines[i] = parts[0] + ":" + r.value(parts[1])
+		}
+	}
+	return r.Text(strings.Join(lines, "\n"))
+}
+
+// HasPointers checks if values of JSON documents are redacted
+func (r *Redactor) HasPointers() bool {
+	return r != nil && len(r.pointers) > 0
+}
+
+// Body redacts values of JSON documents matching pointers and then any text matching patterns
+func (r *Redactor) Body(body string) string {
+	if r == nil || len(body) == 0 {
+		return body
+	}
+
+	if len(r.pointers) > 0 {
+		var document interface{}
+		decoder := json.NewDecoder(strings.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&document); err == nil {
+			redacted := false
+			for _, pointer := range r.pointers {
+				document = r.redactPointer(document, pointer, &redacted)
+			}
+			// Keeps original format if nothing is redacted
+			if redacted {
+				var buffer bytes.Buffer
+				encoder := json.NewEncoder(&buffer)
+				encoder.SetEscapeHTML(false)
+				if err := encoder.Encode(document); err == nil {
+					body = strings.TrimSuffix(buffer.String(), "\n")
+				}
+			}
+		}
+	}
+
+	return r.Text(body)
+}
+
+func (r *Redactor) redactPointer(node interface{}, pointer []string, redacted *bool) interface{} {
+	if len(pointer) == 0 {
+		*redacted = true
+		encoded, _ := json.Marshal(node)
+		return r.value(string(encoded))
+	}
+
+	segment, rest := pointer[0], pointer[1:]
+
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if segment == Wildcard || segment == key {
+				typed[key] = r.redactPointer(child, rest, redacted)
+			}
+		}
+	case []interface{}:
+		for index, child := range typed {
+			if segment == Wildcard || segment == fmt.Sprint(index) {
+				typed[index] = r.redactPointer(child, rest, redacted)
+			}
+		}
+	}
+
+	return node
+}
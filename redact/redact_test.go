@@ -0,0 +1,149 @@
+package redact_test
+
+import (
+	"net/http"
+
+	"github.com/lordofthejars/diferencia/redact"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redactor", func() {
+
+	Describe("Redact headers", func() {
+		Context("With sensitive headers", func() {
+			It("should mask their values without modifying original headers", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Headers: []string{"authorization"}})
+				headers := http.Header{}
+				headers.Set("Authorization", "Bearer abc")
+				headers.Set("Accept", "application/json")
+
+				// When
+				redacted := redactor.Headers(headers)
+
+				// Then
+				Expect(redacted.Get("Authorization")).Should(Equal(redact.Mask))
+				Expect(redacted.Get("Accept")).Should(Equal("application/json"))
+				Expect(headers.Get("Authorization")).Should(Equal("Bearer abc"))
+			})
+
+			It("should keep cookie names", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Headers: []string{"Set-Cookie"}})
+
+				// When
+				redacted := redactor.Cookies([]string{"session=abc; Path=/"})
+
+				// Then
+				Expect(redacted).Should(Equal([]string{"session=" + redact.Mask}))
+			})
+
+			It("should redact header differences", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Headers: []string{"Authorization"}})
+
+				// When
+				redacted := redactor.HeadersDiff("Authorization:[Bearer a] => [Bearer b]\nAccept:[text/html] => [text/plain]")
+
+				// Then
+				Expect(redacted).Should(Equal("Authorization:" + redact.Mask + "\nAccept:[text/html] => [text/plain]"))
+			})
+		})
+	})
+
+	Describe("Redact bodies", func() {
+		Context("With JSON Pointers", func() {
+			It("should redact matching values including wildcards", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Pointers: []string{"/token", "/users/*/password"}})
+
+				// When
+				redacted := redactor.Body(`{"token": "abc", "users": [{"name": "alex", "password": "1234"}, {"name": "sam", "password": 5678}]}`)
+
+				// Then
+				Expect(redacted).Should(MatchJSON(`{"token": "[REDACTED]", "users": [{"name": "alex", "password": "[REDACTED]"}, {"name": "sam", "password": "[REDACTED]"}]}`))
+			})
+
+			It("should keep bodies without matches untouched", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Pointers: []string{"/token"}})
+				body := `{ "name" : "alex" }`
+
+				// When
+				redacted := redactor.Body(body)
+
+				// Then
+				Expect(redacted).Should(Equal(body))
+			})
+		})
+
+		Context("With patterns", func() {
+			It("should redact card numbers and emails in any text", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Patterns: []string{`\b\d{4}(?:[ -]?\d{4}){3}\b`, `[\w.+-]+@[\w-]+\.[\w.]+`}})
+
+				// When
+				redacted := redactor.Body("card 4111 1111 1111 1111 of alex@example.com")
+
+				// Then
+				Expect(redacted).Should(Equal("card [REDACTED] of [REDACTED]"))
+			})
+		})
+	})
+
+	Describe("Hash mode", func() {
+		Context("With equal values", func() {
+			It("should replace them with the same hash", func() {
+
+				// Given
+				redactor, _ := redact.New(redact.Rules{Patterns: []string{`\d+`}, Mode: redact.HashMode})
+
+				// When
+				first := redactor.Text("1234")
+				second := redactor.Text("1234")
+				other := redactor.Text("5678")
+
+				// Then
+				Expect(first).Should(HavePrefix("sha256:"))
+				Expect(first).Should(Equal(second))
+				Expect(first).ShouldNot(Equal(other))
+			})
+		})
+	})
+
+	Describe("Create redactor", func() {
+		Context("With invalid rules", func() {
+			It("should fail", func() {
+
+				// When
+				_, patternErr := redact.New(redact.Rules{Patterns: []string{"[0-9"}})
+				_, pointerErr := redact.New(redact.Rules{Pointers: []string{"token"}})
+				_, modeErr := redact.New(redact.Rules{Mode: "drop"})
+
+				// Then
+				Expect(patternErr).Should(HaveOccurred())
+				Expect(pointerErr).Should(HaveOccurred())
+				Expect(modeErr).Should(HaveOccurred())
+			})
+		})
+
+		Context("Without redactor", func() {
+			It("should not redact anything", func() {
+
+				// Given
+				var redactor *redact.Redactor
+
+				// Then
+				Expect(redactor.Body("alex@example.com")).Should(Equal("alex@example.com"))
+				Expect(redactor.IsSensitiveHeader("Authorization")).Should(BeFalse())
+			})
+		})
+	})
+})
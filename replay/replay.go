@@ -0,0 +1,329 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/har"
+	"github.com/lordofthejars/diferencia/route"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RecordedOrder sends requests in the same order they were recorded
+	RecordedOrder = "recorded"
+	// RandomOrder shuffles requests before sending them
+	RandomOrder = "random"
+	// JSONLFormat is a file where each line is a recorded request or a stored interaction
+	JSONLFormat = "jsonl"
+	// HARFormat is an HTTP Archive file
+	HARFormat = "har"
+
+	defaultTimeout = 30 * time.Second
+	maxLineSize    = 16 * 1024 * 1024
+)
+
+// Outcome of replaying a request through Diferencia
+type Outcome int
+
+const (
+	// Equal means primary and candidate responses are equal
+	Equal Outcome = iota
+	// Different means there is a regression
+	Different
+	// Error means Diferencia or the upstreams failed
+	Error
+)
+
+// Options of a replay
+type Options struct {
+	// Target is the URL of Diferencia proxy
+	Target string
+	// Concurrency is the number of requests in flight. Default is 1.
+	Concurrency int
+	// Rate is the maximum number of requests per second. 0 means no limit.
+	Rate float64
+	// Order is recorded (default) or random
+	Order string
+	// Seed of random order
+	Seed int64
+	// Timeout of each request. Default is 30 seconds.
+	Timeout time.Duration
+	// RouteTemplates used to group endpoints in summary. Not matched paths are inferred.
+	RouteTemplates []string
+}
+
+// IsValidOrder checks if order is known. Empty order means recorded.
+func IsValidOrder(order string) bool {
+	return len(order) == 0 || order == RecordedOrder || order == RandomOrder
+}
+
+// Counts of outcomes
+type Counts struct {
+	Equal     int `json:"equal"`
+	Different int `json:"different"`
+	Errors    int `json:"errors"`
+}
+
+// Total number of requests
+func (c Counts) Total() int {
+	return c.Equal + c.Different + c.Errors
+}
+
+func (c *Counts) add(outcome Outcome) {
+	switch outcome {
+	case Equal:
+		c.Equal++
+	case Different:
+		c.Different++
+	default:
+		c.Errors++
+	}
+}
+
+// Summary of a replay grouped by method and route
+type Summary struct {
+	Endpoints map[string]*Counts `json:"endpoints"`
+	Total     Counts             `json:"total"`
+}
+
+// FailurePercentage is the percentage of different and error outcomes
+func (s Summary) FailurePercentage() float64 {
+	if s.Total.Total() == 0 {
+		return 0
+	}
+	return float64(s.Total.Different+s.Total.Errors) * 100 / float64(s.Total.Total())
+}
+
+// Print summary as a table
+func (s Summary) Print(w io.Writer) {
+	endpoints := make([]string, 0, len(s.Endpoints))
+	for endpoint := range s.Endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ENDPOINT\tEQUAL\tDIFFERENT\tERRORS")
+	for _, endpoint := range endpoints {
+		counts := s.Endpoints[endpoint]
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\n", endpoint, counts.Equal, counts.Different, counts.Errors)
+	}
+	fmt.Fprintf(table, "TOTAL\t%d\t%d\t%d\n", s.Total.Equal, s.Total.Different, s.Total.Errors)
+	table.Flush()
+	fmt.Fprintf(w, "Failures: %.2f%%\n", s.FailurePercentage())
+}
+
+// LoadFile reads recorded requests of file in the given format. If format is empty, it is inferred from file extension.
+func LoadFile(file, format string) ([]exporter.Request, error) {
+	if len(format) == 0 {
+		format = JSONLFormat
+		if strings.EqualFold(filepath.Ext(file), ".har") {
+			format = HARFormat
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch format {
+	case JSONLFormat:
+		return Load(f)
+	case HARFormat:
+		archive, err := har.Read(f)
+		if err != nil {
+			return nil, err
+		}
+		return archive.Requests()
+	}
+
+	return nil, fmt.Errorf("Cannot find %s format. Valid formats are %s and %s", format, JSONLFormat, HARFormat)
+}
+
+// Load reads recorded requests where each line is either a stored interaction or a request
+func Load(reader io.Reader) ([]exporter.Request, error) {
+	var requests []exporter.Request
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		content := bytes.TrimSpace(scanner.Bytes())
+		if len(content) == 0 {
+			continue
+		}
+
+		recorded := struct {
+			exporter.Request
+			Interaction *exporter.Request `json:"request"`
+		}{}
+		if err := json.Unmarshal(content, &recorded); err != nil {
+			return nil, fmt.Errorf("Line %d is not a valid recorded request. %s", line, err.Error())
+		}
+
+		request := recorded.Request
+		if recorded.Interaction != nil {
+			request = *recorded.Interaction
+		}
+		if len(request.Method) == 0 || len(request.URI) == 0 {
+			return nil, fmt.Errorf("Line %d is not a valid recorded request. Method and uri are required", line)
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, scanner.Err()
+}
+
+// Run sends requests to target and summarizes their outcomes
+func Run(requests []exporter.Request, options Options) (Summary, error) {
+
+	target, err := url.Parse(options.Target)
+	if err != nil || len(target.Scheme) == 0 || len(target.Host) == 0 {
+		return Summary{}, fmt.Errorf("Target %s is not a valid URL", options.Target)
+	}
+
+	if !IsValidOrder(options.Order) {
+		return Summary{}, fmt.Errorf("Cannot find %s order. Valid orders are %s and %s", options.Order, RecordedOrder, RandomOrder)
+	}
+
+	matcher, err := route.NewMatcher(options.RouteTemplates, true)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	if options.Order == RandomOrder {
+		shuffled := make([]exporter.Request, len(requests))
+		copy(shuffled, requests)
+		random := rand.New(rand.NewSource(options.Seed))
+		random.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		requests = shuffled
+	}
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+
+	summary := Summary{Endpoints: make(map[string]*Counts)}
+	var mutex sync.Mutex
+	var workers sync.WaitGroup
+
+	pending := make(chan exporter.Request)
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for request := range pending {
+				outcome := send(client, target, request)
+				endpoint := request.Method + " " + matcher.Template(path(request.URI))
+
+				mutex.Lock()
+				if _, ok := summary.Endpoints[endpoint]; !ok {
+					summary.Endpoints[endpoint] = &Counts{}
+				}
+				summary.Endpoints[endpoint].add(outcome)
+				summary.Total.add(outcome)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	var ticker *time.Ticker
+	if options.Rate > 0 {
+		ticker = time.NewTicker(time.Duration(float64(time.Second) / options.Rate))
+		defer ticker.Stop()
+	}
+
+	for i, request := range requests {
+		if ticker != nil && i > 0 {
+			<-ticker.C
+		}
+		pending <- request
+	}
+	close(pending)
+	workers.Wait()
+
+	return summary, nil
+}
+
+// send replays request to target. Diferencia responds 412 when there is a regression.
+func send(client *http.Client, target *url.URL, recorded exporter.Request) Outcome {
+
+	uri, err := url.Parse(recorded.URI)
+	if err != nil {
+		return Error
+	}
+	replayed := *target
+	replayed.Path = strings.TrimSuffix(target.Path, "/") + uri.Path
+	replayed.RawPath = ""
+	replayed.RawQuery = uri.RawQuery
+
+	body, err := recorded.RawBody()
+	if err != nil {
+		return Error
+	}
+	request, err := http.NewRequest(recorded.Method, replayed.String(), bytes.NewReader(body))
+	if err != nil {
+		return Error
+	}
+	for name, values := range recorded.Headers {
+		// Recomputed by the client
+		if http.CanonicalHeaderKey(name) == "Content-Length" {
+			continue
+		}
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		logrus.Debugf("Error replaying %s %s. %s", recorded.Method, recorded.URI, err.Error())
+		return Error
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return Equal
+	case response.StatusCode == http.StatusPreconditionFailed:
+		return Different
+	}
+	return Error
+}
+
+// path of an uri which can be absolute
+func path(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	return parsed.Path
+}
@@ -0,0 +1,183 @@
+package replay_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/replay"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// proxy emulates Diferencia responding 200 when equal, 412 when different and 503 when upstreams fail
+type proxy struct {
+	sync.Mutex
+	received []*http.Request
+	bodies   []string
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	p.Lock()
+	p.received = append(p.received, r)
+	p.bodies = append(p.bodies, string(body))
+	p.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/users"):
+		w.WriteHeader(http.StatusOK)
+	case strings.HasPrefix(r.URL.Path, "/orders"):
+		w.WriteHeader(http.StatusPreconditionFailed)
+	default:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+var _ = Describe("Replay", func() {
+
+	Describe("Load recorded requests", func() {
+		Context("With requests and stored interactions", func() {
+			It("should read both formats", func() {
+
+				// Given
+				recorded := `{"method": "GET", "uri": "/users/1"}
+
+{"request": {"method": "POST", "uri": "/orders", "body": "{}"}, "primary": {"url": "http://localhost/orders"}, "result": true}
+`
+
+				// When
+				requests, err := replay.Load(strings.NewReader(recorded))
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(requests).Should(HaveLen(2))
+				Expect(requests[0].URI).Should(Equal("/users/1"))
+				Expect(requests[1].Method).Should(Equal(http.MethodPost))
+				Expect(requests[1].Body).Should(Equal("{}"))
+			})
+
+			It("should read HAR files", func() {
+
+				// Given
+				file, _ := ioutil.TempFile("", "session")
+				defer os.Remove(file.Name())
+				file.WriteString(`{"log": {"version": "1.2", "entries": [{"request": {"method": "GET", "url": "https://shop.example.com/users/1"}}]}}`)
+				file.Close()
+
+				// When
+				requests, err := replay.LoadFile(file.Name(), replay.HARFormat)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(requests).Should(Equal([]exporter.Request{{Method: http.MethodGet, URI: "/users/1", Headers: http.Header{}}}))
+			})
+
+			It("should fail with invalid lines", func() {
+
+				// When
+				_, err := replay.Load(strings.NewReader(`{"method": "GET", "uri": "/users/1"}` + "\n" + `{"uri": "/users/2"}`))
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).Should(ContainSubstring("Line 2"))
+			})
+		})
+	})
+
+	Describe("Run replay", func() {
+		Context("With a Diferencia proxy", func() {
+			It("should send requests and summarize outcomes by endpoint", func() {
+
+				// Given
+				server := &proxy{}
+				target := httptest.NewServer(server)
+				defer target.Close()
+
+				requests := []exporter.Request{
+					{Method: http.MethodGet, URI: "/users/1?verbose=true", Headers: http.Header{"Accept": []string{"application/json"}}},
+					{Method: http.MethodGet, URI: "/users/2"},
+					{Method: http.MethodPost, URI: "/orders", Body: `{"id": 1}`},
+					{Method: http.MethodGet, URI: "/stock"},
+				}
+
+				// When
+				summary, err := replay.Run(requests, replay.Options{Target: target.URL, Concurrency: 2})
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(summary.Endpoints["GET /users/{id}"]).Should(Equal(&replay.Counts{Equal: 2}))
+				Expect(summary.Endpoints["POST /orders"]).Should(Equal(&replay.Counts{Different: 1}))
+				Expect(summary.Endpoints["GET /stock"]).Should(Equal(&replay.Counts{Errors: 1}))
+				Expect(summary.Total).Should(Equal(replay.Counts{Equal: 2, Different: 1, Errors: 1}))
+				Expect(summary.FailurePercentage()).Should(Equal(50.0))
+
+				Expect(server.received).Should(HaveLen(4))
+				Expect(server.bodies).Should(ContainElement(`{"id": 1}`))
+			})
+
+			It("should keep recorded order and rate", func() {
+
+				// Given
+				server := &proxy{}
+				target := httptest.NewServer(server)
+				defer target.Close()
+
+				requests := []exporter.Request{
+					{Method: http.MethodGet, URI: "/users/1", Headers: http.Header{"Accept": []string{"application/json"}}},
+					{Method: http.MethodGet, URI: "/users/2"},
+					{Method: http.MethodGet, URI: "/users/3"},
+				}
+
+				// When
+				start := time.Now()
+				_, err := replay.Run(requests, replay.Options{Target: target.URL, Rate: 20})
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(time.Since(start)).Should(BeNumerically(">=", 90*time.Millisecond))
+				Expect(server.received[0].URL.Path).Should(Equal("/users/1"))
+				Expect(server.received[0].Header.Get("Accept")).Should(Equal("application/json"))
+				Expect(server.received[2].URL.Path).Should(Equal("/users/3"))
+			})
+
+			It("should fail with unknown order", func() {
+
+				// When
+				_, err := replay.Run(nil, replay.Options{Target: "http://localhost:8080", Order: "reverse"})
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Print summary", func() {
+		Context("With outcomes", func() {
+			It("should print a row per endpoint and total", func() {
+
+				// Given
+				summary := replay.Summary{
+					Endpoints: map[string]*replay.Counts{"GET /users/{id}": {Equal: 3, Different: 1}},
+					Total:     replay.Counts{Equal: 3, Different: 1},
+				}
+				var output bytes.Buffer
+
+				// When
+				summary.Print(&output)
+
+				// Then
+				Expect(output.String()).Should(ContainSubstring("GET /users/{id}"))
+				Expect(output.String()).Should(ContainSubstring("TOTAL"))
+				Expect(output.String()).Should(ContainSubstring("Failures: 25.00%"))
+			})
+		})
+	})
+})
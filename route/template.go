@@ -0,0 +1,102 @@
+package route
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Placeholder used for inferred variable segments
+const Placeholder = "{id}"
+
+var (
+	numericSegment = regexp.MustCompile(`^[0-9]+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashSegment    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+type template struct {
+	value    string
+	segments []string
+}
+
+// Matcher resolves the route template of a request path so stats and metrics are grouped by route and not by path
+type Matcher struct {
+	templates []template
+	infer     bool
+}
+
+// NewMatcher creates a matcher from explicit templates like /users/{id}/orders/{orderId}.
+// If infer is true, paths not matching any template get numeric, UUID and hash segments replaced by {id}.
+func NewMatcher(templates []string, infer bool) (*Matcher, error) {
+	matcher := &Matcher{infer: infer}
+
+	for _, value := range templates {
+		if !strings.HasPrefix(value, "/") {
+			return nil, fmt.Errorf("Route template %s must start with /", value)
+		}
+		matcher.templates = append(matcher.templates, template{value: value, segments: split(value)})
+	}
+
+	return matcher, nil
+}
+
+// Template returns the route template of the path. If no template is resolved, path is returned.
+func (m *Matcher) Template(path string) string {
+
+	if m == nil {
+		return path
+	}
+
+	segments := split(path)
+
+	for _, template := range m.templates {
+		if template.matches(segments) {
+			return template.value
+		}
+	}
+
+	if m.infer {
+		return infer(path)
+	}
+
+	return path
+}
+
+func (t template) matches(segments []string) bool {
+	if len(t.segments) != len(segments) {
+		return false
+	}
+
+	for i, segment := range t.segments {
+		if isVariable(segment) {
+			if len(segments[i]) == 0 {
+				return false
+			}
+			continue
+		}
+		if segment != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func infer(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if numericSegment.MatchString(segment) || uuidSegment.MatchString(segment) || hashSegment.MatchString(segment) {
+			segments[i] = Placeholder
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func isVariable(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func split(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
@@ -0,0 +1,86 @@
+package route_test
+
+import (
+	"github.com/lordofthejars/diferencia/route"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Route Template", func() {
+
+	Describe("Resolve template", func() {
+		Context("With explicit templates", func() {
+			It("should return matching template", func() {
+
+				// Given
+				matcher, err := route.NewMatcher([]string{"/users/{id}/orders/{orderId}", "/users/{id}"}, false)
+				Expect(err).Should(Succeed())
+
+				// When
+				orders := matcher.Template("/users/alex/orders/3")
+				user := matcher.Template("/users/alex")
+				other := matcher.Template("/products/1")
+
+				// Then
+				Expect(orders).Should(Equal("/users/{id}/orders/{orderId}"))
+				Expect(user).Should(Equal("/users/{id}"))
+				Expect(other).Should(Equal("/products/1"))
+			})
+
+			It("should fail with relative templates", func() {
+
+				// When
+				_, err := route.NewMatcher([]string{"users/{id}"}, false)
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+
+		Context("With inferred templates", func() {
+			It("should collapse numeric, uuid and hash segments", func() {
+
+				// Given
+				matcher, _ := route.NewMatcher(nil, true)
+
+				// When
+				numeric := matcher.Template("/users/1/orders")
+				uuid := matcher.Template("/users/9b2e54f1-3a1c-4f7e-8d0a-2f1c3b4d5e6f")
+				hash := matcher.Template("/files/d41d8cd98f00b204e9800998ecf8427e")
+				name := matcher.Template("/users/alex")
+
+				// Then
+				Expect(numeric).Should(Equal("/users/{id}/orders"))
+				Expect(uuid).Should(Equal("/users/{id}"))
+				Expect(hash).Should(Equal("/files/{id}"))
+				Expect(name).Should(Equal("/users/alex"))
+			})
+
+			It("should prefer explicit templates", func() {
+
+				// Given
+				matcher, _ := route.NewMatcher([]string{"/users/{userId}"}, true)
+
+				// When
+				template := matcher.Template("/users/1")
+
+				// Then
+				Expect(template).Should(Equal("/users/{userId}"))
+			})
+		})
+
+		Context("Without matcher", func() {
+			It("should return path", func() {
+
+				// Given
+				var matcher *route.Matcher
+
+				// When
+				template := matcher.Template("/users/1")
+
+				// Then
+				Expect(template).Should(Equal("/users/1"))
+			})
+		})
+	})
+})
@@ -0,0 +1,111 @@
+// Package significance tests if differences between primary and candidate are real or can be explained by noise
+package significance
+
+import "math"
+
+// Test result. Zero value means there is no data to test.
+type Test struct {
+	// PValue is the two-sided probability of observing this difference, or a bigger one, if primary and candidate behave the same
+	PValue float64 `json:"pValue"`
+	// Confidence is the percentage of confidence that the difference is real, that is (1 - PValue) * 100
+	Confidence float64 `json:"confidence"`
+	// EffectSize is the size of the difference. Positive values mean candidate is worse than primary.
+	EffectSize float64 `json:"effectSize"`
+}
+
+// Significant checks if the test reaches given confidence (0-100) with candidate being worse than primary
+func (t Test) Significant(confidence float64) bool {
+	return t.EffectSize > 0 && t.Confidence >= confidence
+}
+
+// MannWhitney runs Mann-Whitney U test over two histograms of durations.
+// Both histograms must use the same buckets, so durations in the same bucket are ties.
+// EffectSize is the rank-biserial correlation (-1 to 1), 1 meaning every candidate duration is greater than any primary one.
+func MannWhitney(primary, candidate []int64) Test {
+
+	var n1, n2 float64
+	for _, count := range primary {
+		n1 += float64(count)
+	}
+	for _, count := range candidate {
+		n2 += float64(count)
+	}
+
+	if n1 == 0 || n2 == 0 {
+		return Test{}
+	}
+
+	buckets := len(primary)
+	if len(candidate) > buckets {
+		buckets = len(candidate)
+	}
+
+	// Sum of candidate ranks, where each bucket gets the average rank of its durations
+	var rankSum, ties, seen float64
+	for bucket := 0; bucket < buckets; bucket++ {
+		a := countAt(primary, bucket)
+		b := countAt(candidate, bucket)
+		t := a + b
+		if t == 0 {
+			continue
+		}
+		rankSum += b * (seen + (t+1)/2)
+		ties += t*t*t - t
+		seen += t
+	}
+
+	u := rankSum - n2*(n2+1)/2
+	n := n1 + n2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+
+	effect := round(2*u/(n1*n2)-1, 4)
+	if variance <= 0 {
+		return test(1, effect)
+	}
+
+	z := (u - mean) / math.Sqrt(variance)
+	return test(math.Erfc(math.Abs(z)/math.Sqrt2), effect)
+}
+
+// TwoProportions runs a two-proportion z-test between primary and candidate failure rates, for example non-2xx responses.
+// EffectSize is the difference between candidate and primary rates in percentage points.
+func TwoProportions(primaryFailures, primaryTotal, candidateFailures, candidateTotal int) Test {
+
+	if primaryTotal == 0 || candidateTotal == 0 {
+		return Test{}
+	}
+
+	p1 := float64(primaryFailures) / float64(primaryTotal)
+	p2 := float64(candidateFailures) / float64(candidateTotal)
+	pooled := float64(primaryFailures+candidateFailures) / float64(primaryTotal+candidateTotal)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(primaryTotal) + 1/float64(candidateTotal)))
+
+	effect := round((p2-p1)*100, 4)
+	if se == 0 {
+		return test(1, effect)
+	}
+
+	z := (p2 - p1) / se
+	return test(math.Erfc(math.Abs(z)/math.Sqrt2), effect)
+}
+
+func test(pValue, effect float64) Test {
+	return Test{
+		PValue:     round(pValue, 4),
+		Confidence: round((1-pValue)*100, 2),
+		EffectSize: effect,
+	}
+}
+
+func countAt(counts []int64, bucket int) float64 {
+	if bucket < len(counts) {
+		return float64(counts[bucket])
+	}
+	return 0
+}
+
+func round(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,89 @@
+package significance_test
+
+import (
+	"github.com/lordofthejars/diferencia/significance"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Significance", func() {
+
+	Describe("Mann-Whitney U test", func() {
+		Context("With slower candidate", func() {
+			It("should be significant with maximum effect", func() {
+
+				// When
+				test := significance.MannWhitney([]int64{10}, []int64{0, 0, 0, 0, 0, 10})
+
+				// Then
+				Expect(test.EffectSize).Should(Equal(1.0))
+				Expect(test.Confidence).Should(BeNumerically(">", 99.9))
+				Expect(test.Significant(95)).Should(BeTrue())
+			})
+		})
+
+		Context("With same distributions", func() {
+			It("should not be significant", func() {
+
+				// When
+				test := significance.MannWhitney([]int64{5, 10, 5}, []int64{5, 10, 5})
+
+				// Then
+				Expect(test.EffectSize).Should(Equal(0.0))
+				Expect(test.PValue).Should(Equal(1.0))
+				Expect(test.Significant(95)).Should(BeFalse())
+			})
+		})
+
+		Context("With few samples", func() {
+			It("should not be significant", func() {
+
+				// When
+				test := significance.MannWhitney([]int64{1, 1}, []int64{0, 1, 1})
+
+				// Then
+				Expect(test.EffectSize).Should(BeNumerically(">", 0))
+				Expect(test.Significant(95)).Should(BeFalse())
+			})
+		})
+
+		Context("Without samples", func() {
+			It("should return zero test", func() {
+				Expect(significance.MannWhitney(nil, []int64{1})).Should(Equal(significance.Test{}))
+			})
+		})
+	})
+
+	Describe("Two-proportion test", func() {
+		Context("With more candidate failures", func() {
+			It("should be significant with rate difference as effect", func() {
+
+				// When
+				test := significance.TwoProportions(10, 100, 30, 100)
+
+				// Then
+				Expect(test.EffectSize).Should(Equal(20.0))
+				Expect(test.PValue).Should(BeNumerically("~", 0.0004, 0.0001))
+				Expect(test.Significant(99)).Should(BeTrue())
+			})
+		})
+
+		Context("With less candidate failures", func() {
+			It("should not be significant as candidate is better", func() {
+
+				// When
+				test := significance.TwoProportions(30, 100, 10, 100)
+
+				// Then
+				Expect(test.EffectSize).Should(Equal(-20.0))
+				Expect(test.Significant(95)).Should(BeFalse())
+			})
+		})
+
+		Context("Without failures", func() {
+			It("should not be significant", func() {
+				Expect(significance.TwoProportions(0, 100, 0, 100).PValue).Should(Equal(1.0))
+			})
+		})
+	})
+})
@@ -0,0 +1,259 @@
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// RecordMode stores primary and secondary responses while comparing
+	RecordMode = "record"
+	// CompareMode uses stored responses instead of calling primary
+	CompareMode = "compare"
+	// Base64Encoding marks contents stored as base64 because they are not valid UTF-8 text
+	Base64Encoding = "base64"
+)
+
+// ErrNotFound is returned when there is no snapshot of a request
+var ErrNotFound = errors.New("snapshot not found")
+
+// StaleError is returned when a snapshot is older than the maximum age
+type StaleError struct {
+	Recorded time.Time
+	MaxAge   time.Duration
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("snapshot recorded at %s is older than %s", e.Recorded.Format(time.RFC3339), e.MaxAge)
+}
+
+// IsValidMode checks if mode is known. Empty mode means no snapshots.
+func IsValidMode(mode string) bool {
+	return len(mode) == 0 || mode == RecordMode || mode == CompareMode
+}
+
+// Snapshot is the recorded response of an upstream to a request
+type Snapshot struct {
+	Key        string      `json:"key"`
+	Method     string      `json:"method"`
+	URI        string      `json:"uri"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Content    string      `json:"content"`
+	// ContentEncoding is base64 for binary contents, empty for text ones
+	ContentEncoding string        `json:"contentEncoding,omitempty"`
+	Cookies         []string      `json:"cookies,omitempty"`
+	ElapsedTime     time.Duration `json:"elapsedTimeNano"`
+	Recorded        time.Time     `json:"recordedDate"`
+}
+
+// SetContent stores content as text, encoded as base64 if it is not valid UTF-8
+func (s *Snapshot) SetContent(content []byte) {
+	if utf8.Valid(content) {
+		s.Content, s.ContentEncoding = string(content), ""
+		return
+	}
+	s.Content, s.ContentEncoding = base64.StdEncoding.EncodeToString(content), Base64Encoding
+}
+
+// RawContent returns the content as it was recorded
+func (s Snapshot) RawContent() ([]byte, error) {
+	switch s.ContentEncoding {
+	case "":
+		return []byte(s.Content), nil
+	case Base64Encoding:
+		return base64.StdEncoding.DecodeString(s.Content)
+	}
+	return nil, fmt.Errorf("Cannot find %s content encoding. Valid encoding is %s", s.ContentEncoding, Base64Encoding)
+}
+
+// HTTPCookies parses cookies stored in Set-Cookie format
+func (s Snapshot) HTTPCookies() []*http.Cookie {
+	return (&http.Response{Header: http.Header{"Set-Cookie": s.Cookies}}).Cookies()
+}
+
+// Cookies in Set-Cookie format to be stored
+func Cookies(cookies []*http.Cookie) []string {
+	var stored []string
+	for _, cookie := range cookies {
+		stored = append(stored, cookie.String())
+	}
+	return stored
+}
+
+// Key normalizes a request so equivalent requests share the snapshot.
+// Query parameters are sorted and JSON bodies are compacted with sorted fields.
+func Key(method, uri string, body []byte) string {
+	key := strings.ToUpper(method) + " "
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		key += uri
+	} else {
+		key += path.Clean("/" + parsed.Path)
+		if query := parsed.Query(); len(query) > 0 {
+			key += "?" + query.Encode()
+		}
+	}
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		var document interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&document); err == nil {
+			if canonical, err := json.Marshal(document); err == nil {
+				body = canonical
+			}
+		}
+		sum := sha256.Sum256(body)
+		key += " " + hex.EncodeToString(sum[:])
+	}
+
+	return key
+}
+
+// Miss is a request without a valid snapshot
+type Miss struct {
+	Upstream string     `json:"upstream"`
+	Method   string     `json:"method"`
+	URI      string     `json:"uri"`
+	Count    int        `json:"count"`
+	Recorded *time.Time `json:"recordedDate,omitempty"`
+}
+
+// Report of requests without a valid snapshot
+type Report struct {
+	Missing []Miss `json:"missing"`
+	Stale   []Miss `json:"stale"`
+}
+
+// Store keeps snapshots in a directory, one file for each upstream and request
+type Store struct {
+	sync.Mutex
+	dir     string
+	maxAge  time.Duration
+	missing map[string]*Miss
+	stale   map[string]*Miss
+}
+
+// NewStore creates a store in dir. Snapshots older than maxAge are stale. 0 means they never are.
+func NewStore(dir string, maxAge time.Duration) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{
+		dir:     dir,
+		maxAge:  maxAge,
+		missing: make(map[string]*Miss),
+		stale:   make(map[string]*Miss),
+	}, nil
+}
+
+func (s *Store) file(upstream, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, upstream, hex.EncodeToString(sum[:])+".json")
+}
+
+// Save snapshot of upstream replacing the previous one
+func (s *Store) Save(upstream string, snapshot Snapshot) error {
+	file := s.file(upstream, snapshot.Key)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	// Written in a temporal file first so a snapshot is never read half written
+	temporal := file + ".tmp"
+	if err := ioutil.WriteFile(temporal, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporal, file)
+}
+
+// Load snapshot of upstream for the request. It returns ErrNotFound or *StaleError if there is no valid snapshot, and both are reported.
+func (s *Store) Load(upstream, method, uri string, body []byte) (Snapshot, error) {
+	key := Key(method, uri, body)
+
+	content, err := ioutil.ReadFile(s.file(upstream, key))
+	if os.IsNotExist(err) {
+		s.report(s.missing, upstream, method, uri, nil)
+		return Snapshot{}, ErrNotFound
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshot := Snapshot{}
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot of %s %s is not valid. %s", method, uri, err.Error())
+	}
+
+	if s.maxAge > 0 && time.Since(snapshot.Recorded) > s.maxAge {
+		s.report(s.stale, upstream, method, uri, &snapshot.Recorded)
+		return snapshot, &StaleError{Recorded: snapshot.Recorded, MaxAge: s.maxAge}
+	}
+
+	return snapshot, nil
+}
+
+func (s *Store) report(misses map[string]*Miss, upstream, method, uri string, recorded *time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	id := upstream + " " + method + " " + uri
+	miss, ok := misses[id]
+	if !ok {
+		miss = &Miss{Upstream: upstream, Method: method, URI: uri}
+		misses[id] = miss
+	}
+	miss.Count++
+	miss.Recorded = recorded
+}
+
+// Report returns requests without a valid snapshot since the store was created. A nil store has an empty report.
+func (s *Store) Report() Report {
+	if s == nil {
+		return Report{Missing: []Miss{}, Stale: []Miss{}}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return Report{Missing: sorted(s.missing), Stale: sorted(s.stale)}
+}
+
+func sorted(misses map[string]*Miss) []Miss {
+	ids := make([]string, 0, len(misses))
+	for id := range misses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// To avoid null representation on JSON conversion
+	list := []Miss{}
+	for _, id := range ids {
+		list = append(list, *misses[id])
+	}
+	return list
+}
@@ -0,0 +1,131 @@
+package snapshot_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/lordofthejars/diferencia/snapshot"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+
+	Describe("Normalize requests", func() {
+		Context("With equivalent requests", func() {
+			It("should share the key", func() {
+
+				// Then
+				Expect(snapshot.Key("get", "/users?size=10&page=1", nil)).Should(Equal(snapshot.Key(http.MethodGet, "/users?page=1&size=10", nil)))
+				Expect(snapshot.Key(http.MethodPost, "/users", []byte(`{"name": "alex", "age": 30}`))).Should(Equal(snapshot.Key(http.MethodPost, "/users", []byte(`{"age":30,"name":"alex"}`))))
+			})
+		})
+
+		Context("With different requests", func() {
+			It("should not share the key", func() {
+
+				// Then
+				Expect(snapshot.Key(http.MethodGet, "/users?page=1", nil)).ShouldNot(Equal(snapshot.Key(http.MethodGet, "/users?page=2", nil)))
+				Expect(snapshot.Key(http.MethodPost, "/users", []byte(`{"name": "alex"}`))).ShouldNot(Equal(snapshot.Key(http.MethodPost, "/users", []byte(`{"name": "sam"}`))))
+				Expect(snapshot.Key(http.MethodGet, "/users", nil)).ShouldNot(Equal(snapshot.Key(http.MethodDelete, "/users", nil)))
+			})
+		})
+	})
+
+	Describe("Store snapshots", func() {
+
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "snapshots")
+			if err != nil {
+				Fail(fmt.Sprintf("Unable to create temporal directory. Reason: %q", err))
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		Context("With recorded responses", func() {
+			It("should load them by upstream and request", func() {
+
+				// Given
+				store, err := snapshot.NewStore(dir, 0)
+				Expect(err).Should(Succeed())
+				recorded := snapshot.Snapshot{
+					Key:        snapshot.Key(http.MethodGet, "/users/1", nil),
+					Method:     http.MethodGet,
+					URI:        "/users/1",
+					StatusCode: 200,
+					Headers:    http.Header{"Content-Type": []string{"application/json"}},
+					Content:    `{"id": 1}`,
+					Cookies:    snapshot.Cookies([]*http.Cookie{{Name: "session", Value: "abc"}}),
+					Recorded:   time.Now(),
+				}
+
+				// When
+				Expect(store.Save("primary", recorded)).Should(Succeed())
+				loaded, err := store.Load("primary", http.MethodGet, "/users/1", nil)
+				_, secondaryErr := store.Load("secondary", http.MethodGet, "/users/1", nil)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(loaded.Content).Should(Equal(`{"id": 1}`))
+				Expect(loaded.Headers.Get("Content-Type")).Should(Equal("application/json"))
+				Expect(loaded.HTTPCookies()[0].Value).Should(Equal("abc"))
+				Expect(secondaryErr).Should(Equal(snapshot.ErrNotFound))
+			})
+		})
+
+		Context("With binary responses", func() {
+			It("should load them as they were recorded", func() {
+
+				// Given
+				store, err := snapshot.NewStore(dir, 0)
+				Expect(err).Should(Succeed())
+				binary := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}
+				recorded := snapshot.Snapshot{Key: snapshot.Key(http.MethodGet, "/images/1", nil), Method: http.MethodGet, URI: "/images/1", StatusCode: 200, Recorded: time.Now()}
+				recorded.SetContent(binary)
+
+				// When
+				Expect(store.Save("primary", recorded)).Should(Succeed())
+				loaded, err := store.Load("primary", http.MethodGet, "/images/1", nil)
+
+				// Then
+				Expect(err).Should(Succeed())
+				Expect(loaded.ContentEncoding).Should(Equal(snapshot.Base64Encoding))
+				Expect(loaded.RawContent()).Should(Equal(binary))
+			})
+		})
+
+		Context("With missing and stale snapshots", func() {
+			It("should report them", func() {
+
+				// Given
+				store, _ := snapshot.NewStore(dir, time.Hour)
+				store.Save("primary", snapshot.Snapshot{Key: snapshot.Key(http.MethodGet, "/users/1", nil), Recorded: time.Now().Add(-2 * time.Hour)})
+
+				// When
+				_, staleErr := store.Load("primary", http.MethodGet, "/users/1", nil)
+				_, missingErr := store.Load("primary", http.MethodGet, "/users/2", nil)
+				store.Load("primary", http.MethodGet, "/users/2", nil)
+
+				// Then
+				_, stale := staleErr.(*snapshot.StaleError)
+				Expect(stale).Should(BeTrue())
+				Expect(missingErr).Should(Equal(snapshot.ErrNotFound))
+
+				report := store.Report()
+				Expect(report.Stale).Should(HaveLen(1))
+				Expect(report.Stale[0].URI).Should(Equal("/users/1"))
+				Expect(report.Stale[0].Recorded).ShouldNot(BeNil())
+				Expect(report.Missing).Should(Equal([]snapshot.Miss{{Upstream: "primary", Method: http.MethodGet, URI: "/users/2", Count: 2}}))
+			})
+		})
+	})
+})
@@ -0,0 +1,141 @@
+// Package status decides when different status codes of primary and candidate are equivalent
+package status
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AnyRoute matches every route
+	AnyRoute = "*"
+	// Class matches status codes of the same class, like 200 and 204
+	Class = "class"
+)
+
+type rule struct {
+	method string
+	route  string
+	class  bool
+	sets   [][]int
+}
+
+// Equivalences of status codes by route. Nil Equivalences only consider equal status codes as equivalent.
+type Equivalences struct {
+	rules []rule
+}
+
+// New creates equivalences from rules like [METHOD ]ROUTE=SETS, where ROUTE is a route template or * for any route,
+// and SETS is a list of sets of equivalent status codes separated by ; (ie POST /users=200,201 or *=404,410;301,308).
+// Using class as set matches status codes of the same class (ie /health=class).
+func New(rules []string) (*Equivalences, error) {
+
+	equivalences := &Equivalences{}
+
+	for _, value := range rules {
+		r, err := parse(value)
+		if err != nil {
+			return nil, err
+		}
+		equivalences.rules = append(equivalences.rules, r)
+	}
+
+	return equivalences, nil
+}
+
+func parse(value string) (rule, error) {
+
+	separator := strings.LastIndex(value, "=")
+	if separator < 0 {
+		return rule{}, fmt.Errorf("Status equivalence %s must be like [METHOD ]ROUTE=SETS", value)
+	}
+
+	r := rule{}
+	target := strings.Fields(value[:separator])
+	switch len(target) {
+	case 1:
+		r.route = target[0]
+	case 2:
+		r.method = strings.ToUpper(target[0])
+		r.route = target[1]
+	default:
+		return rule{}, fmt.Errorf("Status equivalence %s must be like [METHOD ]ROUTE=SETS", value)
+	}
+
+	if r.route != AnyRoute && !strings.HasPrefix(r.route, "/") {
+		return rule{}, fmt.Errorf("Route %s of status equivalence %s must start with / or be *", r.route, value)
+	}
+
+	for _, set := range strings.Split(value[separator+1:], ";") {
+		set = strings.TrimSpace(set)
+		if set == Class {
+			r.class = true
+			continue
+		}
+
+		var codes []int
+		for _, code := range strings.Split(set, ",") {
+			parsed, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil || parsed < 100 || parsed > 599 {
+				return rule{}, fmt.Errorf("Status code %s of status equivalence %s is not valid", code, value)
+			}
+			codes = append(codes, parsed)
+		}
+		if len(codes) < 2 {
+			return rule{}, fmt.Errorf("Set %s of status equivalence %s must contain at least two status codes or be %s", set, value, Class)
+		}
+		r.sets = append(r.sets, codes)
+	}
+
+	return r, nil
+}
+
+// Equivalent checks if primary and candidate status codes are the same or equivalent for the method and route template of the request.
+// Status codes are equivalent if any rule matching the request says so.
+func (e *Equivalences) Equivalent(method, route string, primary, candidate int) bool {
+
+	if primary == candidate {
+		return true
+	}
+
+	if e == nil {
+		return false
+	}
+
+	for _, r := range e.rules {
+		if r.matches(method, route) && r.equivalent(primary, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r rule) matches(method, route string) bool {
+	return (len(r.method) == 0 || r.method == method) && (r.route == AnyRoute || r.route == route)
+}
+
+func (r rule) equivalent(primary, candidate int) bool {
+
+	if r.class && primary/100 == candidate/100 {
+		return true
+	}
+
+	for _, set := range r.sets {
+		if contains(set, primary) && contains(set, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(set []int, code int) bool {
+	for _, value := range set {
+		if value == code {
+			return true
+		}
+	}
+	return false
+}
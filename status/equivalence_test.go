@@ -0,0 +1,65 @@
+package status_test
+
+import (
+	"github.com/lordofthejars/diferencia/status"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Status Equivalences", func() {
+
+	Describe("Equivalent status codes", func() {
+		Context("With equivalence sets", func() {
+			It("should match codes of the same set in matching routes", func() {
+
+				// Given
+				equivalences, err := status.New([]string{"POST /users=200,201", "*=404,410;301,308"})
+				Expect(err).Should(Succeed())
+
+				// Then
+				Expect(equivalences.Equivalent("POST", "/users", 200, 201)).Should(BeTrue())
+				Expect(equivalences.Equivalent("GET", "/users", 200, 201)).Should(BeFalse())
+				Expect(equivalences.Equivalent("POST", "/orders", 200, 201)).Should(BeFalse())
+				Expect(equivalences.Equivalent("GET", "/orders", 410, 404)).Should(BeTrue())
+				Expect(equivalences.Equivalent("GET", "/orders", 301, 308)).Should(BeTrue())
+				Expect(equivalences.Equivalent("GET", "/orders", 301, 404)).Should(BeFalse())
+			})
+		})
+
+		Context("With class matching", func() {
+			It("should match codes of the same class", func() {
+
+				// Given
+				equivalences, err := status.New([]string{"/health=class"})
+				Expect(err).Should(Succeed())
+
+				// Then
+				Expect(equivalences.Equivalent("GET", "/health", 200, 204)).Should(BeTrue())
+				Expect(equivalences.Equivalent("GET", "/health", 200, 500)).Should(BeFalse())
+			})
+		})
+
+		Context("Without equivalences", func() {
+			It("should only match equal codes", func() {
+
+				// Given
+				var equivalences *status.Equivalences
+
+				// Then
+				Expect(equivalences.Equivalent("GET", "/", 200, 200)).Should(BeTrue())
+				Expect(equivalences.Equivalent("GET", "/", 200, 201)).Should(BeFalse())
+			})
+		})
+	})
+
+	Describe("Parse equivalences", func() {
+		Context("With invalid rules", func() {
+			It("should fail", func() {
+				for _, rule := range []string{"/users", "users=200,201", "/users=200", "/users=200,abc", "/users=200,999", "GET POST /users=200,201"} {
+					_, err := status.New([]string{rule})
+					Expect(err).Should(HaveOccurred(), rule)
+				}
+			})
+		})
+	})
+})
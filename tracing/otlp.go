@@ -0,0 +1,339 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	tracesPath      = "/v1/traces"
+	defaultTimeout  = 10 * time.Second
+	shutdownTimeout = 5 * time.Second
+	maxRetries      = 5
+	retryBackoff    = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+	maxRetryTime    = time.Minute
+	batchSize       = 512
+	batchInterval   = 5 * time.Second
+	maxQueuedSpans  = 2048
+	headersVariable = "OTEL_EXPORTER_OTLP_HEADERS"
+	timeoutVariable = "OTEL_EXPORTER_OTLP_TIMEOUT"
+	tracesVariable  = "OTEL_EXPORTER_OTLP_TRACES_"
+	serviceNameKey  = "service.name"
+	jsonContentType = "application/json"
+)
+
+// OTLP JSON encoding of an export request
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	TraceState        string     `json:"traceState,omitempty"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Events            []event    `json:"events,omitempty"`
+	Status            status     `json:"status"`
+}
+
+// Exporter sends ended spans in batches to an OTLP over HTTP endpoint from a background goroutine
+type Exporter struct {
+	url         string
+	serviceName string
+	headers     http.Header
+	client      *http.Client
+	spans       chan *Span
+	done        chan struct{}
+	stopped     chan struct{}
+	stop        sync.Once
+	// closed when pending spans could not be sent in time, so retries are abandoned
+	abort     chan struct{}
+	abortOnce sync.Once
+}
+
+// NewExporter sends spans of serviceName to endpoint (ie http://localhost:4318). Spans are sent to /v1/traces if endpoint has no path.
+func NewExporter(endpoint, serviceName string) (*Exporter, error) {
+
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" || len(endpointURL.Host) == 0 {
+		return nil, fmt.Errorf("Tracing endpoint %s must be an http or https URL like http://localhost:4318", endpoint)
+	}
+	if len(endpointURL.Path) == 0 || endpointURL.Path == "/" {
+		endpointURL.Path = tracesPath
+	}
+
+	headers, err := parseHeaders(variable(headersVariable))
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultTimeout
+	if value := variable(timeoutVariable); len(value) > 0 {
+		milliseconds, err := strconv.Atoi(value)
+		if err != nil || milliseconds < 0 {
+			return nil, fmt.Errorf("%s must be a number of milliseconds", timeoutVariable)
+		}
+		timeout = time.Duration(milliseconds) * time.Millisecond
+	}
+
+	e := &Exporter{
+		url:         endpointURL.String(),
+		serviceName: serviceName,
+		headers:     headers,
+		client:      &http.Client{Timeout: timeout},
+		spans:       make(chan *Span, maxQueuedSpans),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		abort:       make(chan struct{}),
+	}
+
+	go e.run()
+
+	return e, nil
+}
+
+// variable returns the value of the traces specific environment variable, or the general one if it is not set
+func variable(name string) string {
+	if value := os.Getenv(strings.Replace(name, "OTEL_EXPORTER_OTLP_", tracesVariable, 1)); len(value) > 0 {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// parseHeaders in format key1=value1,key2=value2 with URL encoded values
+func parseHeaders(value string) (http.Header, error) {
+	headers := http.Header{}
+	for _, pair := range strings.Split(value, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s must be like key1=value1,key2=value2", headersVariable)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("Value of %s header in %s is not valid. %s", parts[0], headersVariable, err.Error())
+		}
+		headers.Add(strings.TrimSpace(parts[0]), decoded)
+	}
+	return headers, nil
+}
+
+// export queues span. It is dropped if the queue is full, so requests never wait for the collector.
+func (e *Exporter) export(span *Span) {
+	select {
+	case e.spans <- span:
+	default:
+		logrus.Debugf("Span %s dropped since tracing queue is full", span.name)
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.send(batch)
+			batch = nil
+		case <-e.done:
+			for {
+				select {
+				case span := <-e.spans:
+					batch = append(batch, span)
+				default:
+					e.send(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// Close sends pending spans, waiting at most 5 seconds, and stops the exporter
+func (e *Exporter) Close() error {
+	if e == nil {
+		return nil
+	}
+
+	e.stop.Do(func() {
+		close(e.done)
+	})
+
+	select {
+	case <-e.stopped:
+		return nil
+	case <-time.After(shutdownTimeout):
+		e.abortOnce.Do(func() {
+			close(e.abort)
+		})
+		return fmt.Errorf("Pending spans have not been sent to %s in %s", e.url, shutdownTimeout)
+	}
+}
+
+// send posts the batch retrying throttled or unavailable responses with exponential backoff, as OTLP requires.
+// Retries stop after a maximum time or when Close stops waiting, so pending spans never delay shutdown.
+func (e *Exporter) send(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := e.encode(batch)
+	if err != nil {
+		logrus.Errorf("Error serializing %d spans for %s. %s", len(batch), e.url, err.Error())
+		return
+	}
+
+	backoff := retryBackoff
+	deadline := time.Now().Add(maxRetryTime)
+	for attempt := 0; ; attempt++ {
+		retry, retryAfter, err := e.post(body)
+		if err == nil {
+			return
+		}
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		if !retry || attempt >= maxRetries || !e.wait(wait, deadline) {
+			logrus.Errorf("Error exporting %d spans to %s. %s", len(batch), e.url, err.Error())
+			return
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// wait sleeps before a retry. It returns false without waiting if retry would be after deadline, or as soon as retries are abandoned.
+func (e *Exporter) wait(wait time.Duration, deadline time.Time) bool {
+	if time.Now().Add(wait).After(deadline) {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-e.abort:
+		return false
+	}
+}
+
+func (e *Exporter) encode(batch []*Span) ([]byte, error) {
+
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		spans = append(spans, span.otlp())
+	}
+
+	return json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []keyValue{stringAttribute(serviceNameKey, e.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: instrumentationName}, Spans: spans}},
+	}}})
+}
+
+// post sends body once. It returns if the request can be retried and the wait asked by the collector, if any.
+func (e *Exporter) post(body []byte) (bool, time.Duration, error) {
+
+	request, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	for name, values := range e.headers {
+		request.Header[name] = values
+	}
+	request.Header.Set("Content-Type", jsonContentType)
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return true, 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	switch status := response.StatusCode; {
+	case status >= 200 && status < 300:
+		return false, 0, nil
+	case status == http.StatusTooManyRequests || status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		return true, retryAfter(response.Header), fmt.Errorf("collector responded with %d status code", response.StatusCode)
+	}
+
+	return false, 0, fmt.Errorf("collector responded with %d status code", response.StatusCode)
+}
+
+// retryAfter returns the wait of Retry-After header in seconds or as a date, up to the maximum backoff. 0 means not set.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if len(value) == 0 {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	}
+
+	if wait > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
@@ -0,0 +1,232 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kinds of spans as defined by OTLP
+const (
+	internalKind = 1
+	serverKind   = 2
+	clientKind   = 3
+)
+
+// Error status code as defined by OTLP
+const errorStatus = 2
+
+// spanContext identifies a span inside a trace, so it can be propagated
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+	// W3C tracestate of the incoming request, propagated as it is
+	state string
+}
+
+func (c spanContext) isValid() bool {
+	return c.traceID != [16]byte{} && c.spanID != [8]byte{}
+}
+
+type contextKey struct{}
+
+func contextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+func spanFrom(ctx context.Context) *Span {
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+// Span is an operation of a trace. It is only exported if its trace has an Exporter and is sampled.
+type Span struct {
+	mutex      sync.Mutex
+	context    spanContext
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes []keyValue
+	events     []event
+	status     status
+	ended      bool
+	exporter   *Exporter
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value value  `json:"value"`
+}
+
+// value of an attribute. Only one of the fields is set, int64 is encoded as string following OTLP JSON.
+type value struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type event struct {
+	Name         string     `json:"name"`
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func stringAttribute(key, v string) keyValue {
+	return keyValue{Key: key, Value: value{StringValue: &v}}
+}
+
+func intAttribute(key string, v int) keyValue {
+	encoded := strconv.Itoa(v)
+	return keyValue{Key: key, Value: value{IntValue: &encoded}}
+}
+
+func boolAttribute(key string, v bool) keyValue {
+	return keyValue{Key: key, Value: value{BoolValue: &v}}
+}
+
+// newSpan creates a span exported with exporter, child of parent or the root of a new trace if parent is not valid
+func newSpan(exporter *Exporter, parent spanContext, name string, kind int, attributes ...keyValue) *Span {
+
+	span := &Span{
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+		exporter: exporter,
+	}
+
+	if parent.isValid() {
+		span.context = parent
+		span.parentID = parent.spanID
+	} else {
+		rand.Read(span.context.traceID[:])
+		span.context.sampled = true
+	}
+	rand.Read(span.context.spanID[:])
+
+	span.setAttributes(attributes...)
+
+	return span
+}
+
+// startChild creates a span child of the span of r, exported with the same exporter
+func startChild(r *http.Request, name string, kind int, attributes ...keyValue) (*http.Request, *Span) {
+	var (
+		exporter *Exporter
+		parent   spanContext
+	)
+	if current := spanFrom(r.Context()); current != nil {
+		exporter, parent = current.exporter, current.context
+	}
+
+	span := newSpan(exporter, parent, name, kind, attributes...)
+	return r.WithContext(contextWithSpan(r.Context(), span)), span
+}
+
+func (s *Span) recording() bool {
+	return s.exporter != nil && s.context.sampled
+}
+
+// setAttributes adds attributes, replacing the ones with the same key
+func (s *Span) setAttributes(attributes ...keyValue) {
+	if !s.recording() {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, attribute := range attributes {
+		replaced := false
+		for i := range s.attributes {
+			if s.attributes[i].Key == attribute.Key {
+				s.attributes[i] = attribute
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.attributes = append(s.attributes, attribute)
+		}
+	}
+}
+
+func (s *Span) setError(message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status = status{Code: errorStatus, Message: message}
+}
+
+// recordError adds an exception event with the type and message of err
+func (s *Span) recordError(err error) {
+	if !s.recording() {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.events = append(s.events, event{
+		Name:         "exception",
+		TimeUnixNano: unixNano(time.Now()),
+		Attributes: []keyValue{
+			stringAttribute("exception.type", fmt.Sprintf("%T", err)),
+			stringAttribute("exception.message", err.Error()),
+		},
+	})
+}
+
+// End finishes the span and queues it to be exported. Calling it more than once has no effect.
+func (s *Span) End() {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mutex.Unlock()
+
+	if s.recording() {
+		s.exporter.export(s)
+	}
+}
+
+// otlp returns the span in OTLP JSON format
+func (s *Span) otlp() otlpSpan {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.context.traceID[:]),
+		SpanID:            hex.EncodeToString(s.context.spanID[:]),
+		TraceState:        s.context.state,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(s.end),
+		Attributes:        s.attributes,
+		Events:            s.events,
+		Status:            s.status,
+	}
+	if s.parentID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	return span
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,146 @@
+// Package tracing creates spans of comparisons and exports them using OTLP over HTTP with JSON encoding
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	instrumentationName = "github.com/lordofthejars/diferencia"
+	// maximum size of diffs recorded as span attributes
+	maxDiffSize   = 1024
+	truncatedMark = "...(truncated)"
+)
+
+const (
+	// NoiseDetection span name
+	NoiseDetection = "noise detection"
+	// Comparison span name
+	Comparison = "comparison"
+)
+
+// W3C trace context headers
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+// StartRequest creates the span of a proxied request to route and path, continuing the trace of the incoming request if any.
+// Route and path are exported as they are, so they must not contain sensitive data.
+// Span and its children are sent to exporter, a nil exporter means they are not exported. Returned request carries the span.
+func StartRequest(exporter *Exporter, r *http.Request, route, path, candidate string) (*http.Request, *Span) {
+	span := newSpan(exporter, extract(r.Header), r.Method+" "+route, serverKind,
+		stringAttribute("http.request.method", r.Method),
+		stringAttribute("http.route", route),
+		stringAttribute("url.path", path),
+		stringAttribute("diferencia.candidate", candidate),
+	)
+
+	return r.WithContext(contextWithSpan(r.Context(), span)), span
+}
+
+// StartUpstream creates the span of a call to primary, candidate or secondary
+func StartUpstream(r *http.Request, upstream, fullURL string) (*http.Request, *Span) {
+	return startChild(r, upstream, clientKind,
+		stringAttribute("http.request.method", r.Method),
+		stringAttribute("url.full", fullURL),
+		stringAttribute("diferencia.upstream", upstream),
+	)
+}
+
+// Start creates an internal span of the comparison pipeline, like noise detection or comparison
+func Start(r *http.Request, name string) (*http.Request, *Span) {
+	return startChild(r, name, internalKind)
+}
+
+// Inject adds the trace context of ctx to headers, so upstreams continue the trace
+func Inject(ctx context.Context, header http.Header) {
+	span := spanFrom(ctx)
+	if span == nil || !span.context.isValid() {
+		return
+	}
+	sc := span.context
+
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	header.Set(traceparentHeader, "00-"+hex.EncodeToString(sc.traceID[:])+"-"+hex.EncodeToString(sc.spanID[:])+"-"+flags)
+	if len(sc.state) > 0 {
+		header.Set(tracestateHeader, sc.state)
+	}
+}
+
+// extract returns the trace context of headers. It is not valid if headers do not contain a valid traceparent.
+func extract(header http.Header) spanContext {
+	parts := strings.Split(strings.TrimSpace(header.Get(traceparentHeader)), "-")
+	// Future versions may add fields, but the ones of version 00 keep their place
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 {
+		return spanContext{}
+	}
+
+	var sc spanContext
+	version, traceID, spanID, flags := []byte{0}, sc.traceID[:], sc.spanID[:], []byte{0}
+	for i, field := range [][]byte{version, traceID, spanID, flags} {
+		if len(parts[i]) != 2*len(field) || strings.ToLower(parts[i]) != parts[i] {
+			return spanContext{}
+		}
+		if _, err := hex.Decode(field, []byte(parts[i])); err != nil {
+			return spanContext{}
+		}
+	}
+	if !sc.isValid() {
+		return spanContext{}
+	}
+	sc.sampled = flags[0]&1 == 1
+	sc.state = strings.Join(header[http.CanonicalHeaderKey(tracestateHeader)], ",")
+
+	return sc
+}
+
+// Responded records the response of an upstream
+func Responded(span *Span, status, bodySize int) {
+	span.setAttributes(
+		intAttribute("http.response.status_code", status),
+		intAttribute("http.response.body.size", bodySize),
+	)
+	if status >= http.StatusInternalServerError {
+		span.setError(http.StatusText(status))
+	}
+}
+
+// Failed records the error of the span
+func Failed(span *Span, err error) {
+	span.recordError(err)
+	span.setError(err.Error())
+}
+
+// Compared records the result of the comparison and a summary of the differences
+func Compared(span *Span, equal bool, statusDiff, headersDiff, bodyDiff string) {
+	span.setAttributes(boolAttribute("diferencia.result", equal))
+	if len(statusDiff) > 0 {
+		span.setAttributes(stringAttribute("diferencia.diff.status", truncate(statusDiff)))
+	}
+	if len(headersDiff) > 0 {
+		span.setAttributes(stringAttribute("diferencia.diff.headers", truncate(headersDiff)))
+	}
+	if len(bodyDiff) > 0 {
+		span.setAttributes(stringAttribute("diferencia.diff.body", truncate(bodyDiff)))
+	}
+}
+
+// truncate cuts value to the maximum diff size without splitting a multi-byte character
+func truncate(value string) string {
+	if len(value) <= maxDiffSize {
+		return value
+	}
+	size := maxDiffSize
+	for size > 0 && !utf8.RuneStart(value[size]) {
+		size--
+	}
+	return value[:size] + truncatedMark
+}
@@ -0,0 +1,292 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+
+	"github.com/lordofthejars/diferencia/tracing"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// span as encoded by OTLP JSON
+type span struct {
+	TraceId      string `json:"traceId"`
+	SpanId       string `json:"spanId"`
+	ParentSpanId string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Attributes   []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+	Events []struct {
+		Name string `json:"name"`
+	} `json:"events"`
+	Status struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+// collector is a stand-in of an OTLP over HTTP collector accepting JSON
+type collector struct {
+	sync.Mutex
+	spans   []span
+	headers http.Header
+	// status codes responded in order before accepting spans
+	status []int
+	calls  int
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []span `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&request) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.calls++
+	if len(c.status) > 0 {
+		status := c.status[0]
+		c.status = c.status[1:]
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+		return
+	}
+	c.headers = r.Header
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			c.spans = append(c.spans, scopeSpans.Spans...)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *collector) byName() map[string]span {
+	c.Lock()
+	defer c.Unlock()
+
+	spans := make(map[string]span)
+	for _, span := range c.spans {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func stringAttribute(span span, key string) string {
+	for _, keyValue := range span.Attributes {
+		if keyValue.Key == key {
+			return keyValue.Value.StringValue
+		}
+	}
+	return ""
+}
+
+var _ = Describe("Tracing", func() {
+
+	Describe("Export spans", func() {
+		Context("With OTLP collector", func() {
+			It("should export request span with upstream and comparison children", func() {
+
+				// Given
+				otlp := &collector{}
+				server := httptest.NewServer(otlp)
+				defer server.Close()
+
+				exporter, err := tracing.NewExporter(server.URL, "now.httpbin.org")
+				Expect(err).Should(Succeed())
+
+				incoming := httptest.NewRequest(http.MethodGet, "http://localhost:8080/users/1", nil)
+
+				// When
+				request, span := tracing.StartRequest(exporter, incoming, "/users/{id}", incoming.URL.Path, "http://candidate")
+				_, primarySpan := tracing.StartUpstream(request, "primary", "http://primary/users/1")
+				tracing.Responded(primarySpan, http.StatusOK, 10)
+				primarySpan.End()
+				_, comparisonSpan := tracing.Start(request, tracing.Comparison)
+				tracing.Compared(comparisonSpan, false, "", "", "Body differs")
+				comparisonSpan.End()
+				span.End()
+
+				Expect(exporter.Close()).Should(Succeed())
+
+				// Then
+				spans := otlp.byName()
+				Expect(spans).Should(HaveKey("GET /users/{id}"))
+				Expect(spans).Should(HaveKey("primary"))
+				Expect(spans).Should(HaveKey(tracing.Comparison))
+
+				root := spans["GET /users/{id}"]
+				Expect(spans["primary"].ParentSpanId).Should(Equal(root.SpanId))
+				Expect(spans[tracing.Comparison].ParentSpanId).Should(Equal(root.SpanId))
+				Expect(stringAttribute(spans[tracing.Comparison], "diferencia.diff.body")).Should(ContainSubstring("Body differs"))
+				Expect(stringAttribute(spans["primary"], "diferencia.upstream")).Should(Equal("primary"))
+				Expect(root.Kind).Should(Equal(2))
+				Expect(spans["primary"].Kind).Should(Equal(3))
+			})
+
+			It("should export failures with configured headers", func() {
+
+				// Given
+				otlp := &collector{}
+				server := httptest.NewServer(otlp)
+				defer server.Close()
+				os.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20abc")
+				defer os.Unsetenv("OTEL_EXPORTER_OTLP_HEADERS")
+
+				exporter, err := tracing.NewExporter(server.URL, "now.httpbin.org")
+				Expect(err).Should(Succeed())
+
+				// When
+				request, span := tracing.StartRequest(exporter, httptest.NewRequest(http.MethodGet, "/", nil), "/", "/", "http://candidate")
+				_, primarySpan := tracing.StartUpstream(request, "primary", "http://primary/")
+				tracing.Failed(primarySpan, context.DeadlineExceeded)
+				primarySpan.End()
+				span.End()
+
+				Expect(exporter.Close()).Should(Succeed())
+
+				// Then
+				primary := otlp.byName()["primary"]
+				Expect(primary.Status.Code).Should(Equal(2))
+				Expect(primary.Events).Should(HaveLen(1))
+				Expect(primary.Events[0].Name).Should(Equal("exception"))
+				Expect(otlp.headers.Get("Authorization")).Should(Equal("Bearer abc"))
+			})
+		})
+
+		Context("With throttling collector", func() {
+			It("should retry until spans are accepted", func() {
+
+				// Given
+				otlp := &collector{status: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}}
+				server := httptest.NewServer(otlp)
+				defer server.Close()
+				exporter, err := tracing.NewExporter(server.URL, "now.httpbin.org")
+				Expect(err).Should(Succeed())
+
+				// When
+				_, span := tracing.StartRequest(exporter, httptest.NewRequest(http.MethodGet, "/", nil), "/", "/", "http://candidate")
+				span.End()
+				Expect(exporter.Close()).Should(Succeed())
+
+				// Then
+				Expect(otlp.byName()).Should(HaveKey("GET /"))
+				otlp.Lock()
+				defer otlp.Unlock()
+				Expect(otlp.calls).Should(Equal(3))
+			})
+
+			It("should not retry rejected spans", func() {
+
+				// Given
+				otlp := &collector{status: []int{http.StatusBadRequest}}
+				server := httptest.NewServer(otlp)
+				defer server.Close()
+				exporter, err := tracing.NewExporter(server.URL, "now.httpbin.org")
+				Expect(err).Should(Succeed())
+
+				// When
+				_, span := tracing.StartRequest(exporter, httptest.NewRequest(http.MethodGet, "/", nil), "/", "/", "http://candidate")
+				span.End()
+				Expect(exporter.Close()).Should(Succeed())
+
+				// Then
+				otlp.Lock()
+				defer otlp.Unlock()
+				Expect(otlp.calls).Should(Equal(1))
+				Expect(otlp.spans).Should(BeEmpty())
+			})
+		})
+
+		Context("With two exporters", func() {
+			It("should export spans of each request to its own exporter", func() {
+
+				// Given
+				first, second := &collector{}, &collector{}
+				firstServer, secondServer := httptest.NewServer(first), httptest.NewServer(second)
+				defer firstServer.Close()
+				defer secondServer.Close()
+				firstExporter, err := tracing.NewExporter(firstServer.URL, "first")
+				Expect(err).Should(Succeed())
+				secondExporter, err := tracing.NewExporter(secondServer.URL, "second")
+				Expect(err).Should(Succeed())
+
+				// When
+				request, span := tracing.StartRequest(firstExporter, httptest.NewRequest(http.MethodGet, "/", nil), "/first", "/first", "http://candidate")
+				_, comparisonSpan := tracing.Start(request, tracing.Comparison)
+				comparisonSpan.End()
+				span.End()
+				_, span = tracing.StartRequest(secondExporter, httptest.NewRequest(http.MethodGet, "/", nil), "/second", "/second", "http://candidate")
+				span.End()
+				_, span = tracing.StartRequest(nil, httptest.NewRequest(http.MethodGet, "/", nil), "/none", "/none", "http://candidate")
+				span.End()
+
+				Expect(firstExporter.Close()).Should(Succeed())
+				Expect(secondExporter.Close()).Should(Succeed())
+
+				// Then
+				Expect(first.byName()).Should(HaveLen(2))
+				Expect(first.byName()).Should(HaveKey("GET /first"))
+				Expect(first.byName()).Should(HaveKey(tracing.Comparison))
+				Expect(second.byName()).Should(HaveLen(1))
+				Expect(second.byName()).Should(HaveKey("GET /second"))
+			})
+		})
+
+		Context("With invalid endpoint", func() {
+			It("should fail", func() {
+
+				// When
+				_, err := tracing.NewExporter("localhost:4318", "now.httpbin.org")
+
+				// Then
+				Expect(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Propagate trace context", func() {
+		Context("With incoming traceparent", func() {
+			It("should continue the trace and inject it to upstreams", func() {
+
+				// Given
+				otlp := &collector{}
+				server := httptest.NewServer(otlp)
+				defer server.Close()
+
+				exporter, err := tracing.NewExporter(server.URL, "now.httpbin.org")
+				Expect(err).Should(Succeed())
+
+				incoming := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+				incoming.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+				// When
+				request, span := tracing.StartRequest(exporter, incoming, "/", incoming.URL.Path, "http://candidate")
+				upstream := http.Header{}
+				tracing.Inject(request.Context(), upstream)
+				span.End()
+
+				Expect(exporter.Close()).Should(Succeed())
+
+				// Then
+				Expect(upstream.Get("traceparent")).Should(HavePrefix("00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+				Expect(upstream.Get("traceparent")).ShouldNot(ContainSubstring("00f067aa0ba902b7"))
+			})
+		})
+	})
+})
@@ -0,0 +1,259 @@
+// Package verdict decides if a candidate can be promoted from the stats of its comparisons
+package verdict
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/significance"
+)
+
+const (
+	// Pass means candidate can be promoted
+	Pass = "pass"
+	// Fail means candidate breaks at least one rule
+	Fail = "fail"
+	// Inconclusive means there are not enough comparisons to decide
+	Inconclusive = "inconclusive"
+)
+
+// Rules to pass. Zero values of MaxRouteRegressionRate and MaxLatencyRatio disable their checks.
+type Rules struct {
+	// MaxRegressionRate is the maximum percentage of regressions of all comparisons
+	MaxRegressionRate float64 `json:"maxRegressionRate"`
+	// MaxRouteRegressionRate is the maximum percentage of regressions of each route
+	MaxRouteRegressionRate float64 `json:"maxRouteRegressionRate,omitempty"`
+	// MinSamples is the minimum number of comparisons to decide. Routes with less comparisons are not checked individually.
+	MinSamples int `json:"minSamples,omitempty"`
+	// MaxLatencyRatio is the maximum ratio between candidate and primary average durations, overall and of each route
+	MaxLatencyRatio float64 `json:"maxLatencyRatio,omitempty"`
+	// MinConfidence is the minimum confidence percentage of statistical tests to fail. A latency ratio greater than the maximum
+	// with less confidence gives an inconclusive verdict, and a candidate non-2xx rate greater than the primary one with more confidence fails.
+	// Zero means tests are not applied.
+	MinConfidence float64 `json:"minConfidence,omitempty"`
+}
+
+// Route results of the comparisons of a method and route
+type Route struct {
+	Method         string            `json:"method"`
+	Path           string            `json:"path"`
+	Samples        int               `json:"samples"`
+	Regressions    int               `json:"regressions"`
+	RegressionRate float64           `json:"regressionRate"`
+	Slow           int               `json:"slow,omitempty"`
+	SlowRate       float64           `json:"slowRate,omitempty"`
+	LatencyRatio   float64           `json:"latencyRatio,omitempty"`
+	LatencyTest    significance.Test `json:"latencyTest"`
+	StatusTest     significance.Test `json:"statusTest"`
+	Reasons        []string          `json:"reasons,omitempty"`
+}
+
+// Verdict of the candidate with the reasons of the result and the routes breaking any rule
+type Verdict struct {
+	Result         string            `json:"result"`
+	Reasons        []string          `json:"reasons,omitempty"`
+	Samples        int               `json:"samples"`
+	Regressions    int               `json:"regressions"`
+	RegressionRate float64           `json:"regressionRate"`
+	Slow           int               `json:"slow,omitempty"`
+	SlowRate       float64           `json:"slowRate,omitempty"`
+	LatencyRatio   float64           `json:"latencyRatio,omitempty"`
+	LatencyTest    significance.Test `json:"latencyTest"`
+	StatusTest     significance.Test `json:"statusTest"`
+	Rules          Rules             `json:"rules"`
+	FailingRoutes  []Route           `json:"failingRoutes,omitempty"`
+	// UncertainRoutes break the rules without enough confidence
+	UncertainRoutes []Route `json:"uncertainRoutes,omitempty"`
+}
+
+// Validate checks that all limits are in range
+func (r Rules) Validate() error {
+	if r.MaxRegressionRate < 0 || r.MaxRegressionRate > 100 || r.MaxRouteRegressionRate < 0 || r.MaxRouteRegressionRate > 100 {
+		return fmt.Errorf("Verdict regression rates must be between 0 and 100")
+	}
+	if r.MinConfidence < 0 || r.MinConfidence > 100 {
+		return fmt.Errorf("Verdict min confidence must be between 0 and 100")
+	}
+	if r.MinSamples < 0 || r.MaxLatencyRatio < 0 {
+		return fmt.Errorf("Verdict min samples and max latency ratio cannot be negative")
+	}
+	return nil
+}
+
+// latency accumulates average durations weighted by their samples, and durations and non-2xx responses to be tested
+type latency struct {
+	primary            float64
+	candidate          float64
+	primaryHistogram   exporter.LatencyHistogram
+	candidateHistogram exporter.LatencyHistogram
+	primaryNon2xx      int
+	candidateNon2xx    int
+}
+
+func (l *latency) add(entry exporter.Entry) {
+	l.primary += float64(entry.AveragePrimaryDuration) * float64(entry.Observed())
+	l.candidate += float64(entry.AverageCandidateDuration) * float64(entry.Observed())
+	l.primaryHistogram.Merge(entry.PrimaryHistogram)
+	l.candidateHistogram.Merge(entry.CandidateHistogram)
+	l.primaryNon2xx += entry.PrimaryNon2xx
+	l.candidateNon2xx += entry.CandidateNon2xx
+}
+
+// latencyTest of all added durations
+func (l latency) latencyTest() significance.Test {
+	return significance.MannWhitney(l.primaryHistogram.Counts, l.candidateHistogram.Counts)
+}
+
+// statusTest of all added non-2xx responses
+func (l latency) statusTest() significance.Test {
+	observed := int(l.primaryHistogram.Count())
+	return significance.TwoProportions(l.primaryNon2xx, observed, l.candidateNon2xx, observed)
+}
+
+// check applies latency ratio and status rules. Breaks with enough confidence are returned as failures, the other ones as uncertain.
+func (rules Rules) check(latencyRatio float64, latencyTest, statusTest significance.Test) (failures, uncertain []string) {
+
+	if rules.MaxLatencyRatio > 0 && latencyRatio > rules.MaxLatencyRatio {
+		reason := fmt.Sprintf("Latency ratio %.2f is greater than %.2f", latencyRatio, rules.MaxLatencyRatio)
+		switch {
+		case rules.MinConfidence == 0:
+			failures = append(failures, reason)
+		case latencyTest.Significant(rules.MinConfidence):
+			failures = append(failures, fmt.Sprintf("%s with %.2f%% confidence", reason, latencyTest.Confidence))
+		default:
+			uncertain = append(uncertain, fmt.Sprintf("%s but confidence %.2f%% is lower than %.2f%%", reason, latencyTest.Confidence, rules.MinConfidence))
+		}
+	}
+
+	if rules.MinConfidence > 0 && statusTest.Significant(rules.MinConfidence) {
+		failures = append(failures, fmt.Sprintf("Non-2xx rate of candidate is %.2f points greater than primary with %.2f%% confidence", statusTest.EffectSize, statusTest.Confidence))
+	}
+
+	return
+}
+
+// ratio between candidate and primary. It is 0 if there is no primary duration.
+func (l latency) ratio() float64 {
+	if l.primary <= 0 {
+		return 0
+	}
+	return round(l.candidate / l.primary)
+}
+
+// Evaluate rules against stats entries
+func Evaluate(entries []exporter.Entry, rules Rules) Verdict {
+
+	verdict := Verdict{Rules: rules}
+	var total latency
+
+	for _, entry := range entries {
+		samples := entry.Success + entry.Errors
+		verdict.Samples += samples
+		verdict.Regressions += entry.Errors
+		verdict.Slow += entry.Slow
+		total.add(entry)
+
+		if samples == 0 || samples < rules.MinSamples {
+			continue
+		}
+
+		var routeLatency latency
+		routeLatency.add(entry)
+		route := Route{
+			Method:         entry.Endpoint.Method,
+			Path:           entry.Endpoint.Path,
+			Samples:        samples,
+			Regressions:    entry.Errors,
+			RegressionRate: rate(entry.Errors, samples),
+			Slow:           entry.Slow,
+			SlowRate:       rate(entry.Slow, samples),
+			LatencyRatio:   routeLatency.ratio(),
+			LatencyTest:    entry.LatencyTest,
+			StatusTest:     entry.StatusTest,
+		}
+
+		if rules.MaxRouteRegressionRate > 0 && route.RegressionRate > rules.MaxRouteRegressionRate {
+			route.Reasons = append(route.Reasons, fmt.Sprintf("Regression rate %.2f%% is greater than %.2f%%", route.RegressionRate, rules.MaxRouteRegressionRate))
+		}
+		failures, uncertain := rules.check(route.LatencyRatio, route.LatencyTest, route.StatusTest)
+		route.Reasons = append(route.Reasons, failures...)
+
+		if len(route.Reasons) > 0 {
+			verdict.FailingRoutes = append(verdict.FailingRoutes, route)
+		} else if len(uncertain) > 0 {
+			route.Reasons = uncertain
+			verdict.UncertainRoutes = append(verdict.UncertainRoutes, route)
+		}
+	}
+
+	verdict.RegressionRate = rate(verdict.Regressions, verdict.Samples)
+	verdict.SlowRate = rate(verdict.Slow, verdict.Samples)
+	verdict.LatencyRatio = total.ratio()
+	verdict.LatencyTest = total.latencyTest()
+	verdict.StatusTest = total.statusTest()
+
+	sortRoutes(verdict.FailingRoutes)
+	sortRoutes(verdict.UncertainRoutes)
+
+	if verdict.Samples == 0 || verdict.Samples < rules.MinSamples {
+		verdict.Result = Inconclusive
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%d comparisons done but at least %d are required", verdict.Samples, max(rules.MinSamples, 1)))
+		return verdict
+	}
+
+	if verdict.RegressionRate > rules.MaxRegressionRate {
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("Regression rate %.2f%% is greater than %.2f%%", verdict.RegressionRate, rules.MaxRegressionRate))
+	}
+	failures, uncertain := rules.check(verdict.LatencyRatio, verdict.LatencyTest, verdict.StatusTest)
+	verdict.Reasons = append(verdict.Reasons, failures...)
+	if len(verdict.FailingRoutes) > 0 {
+		verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%d routes break the rules", len(verdict.FailingRoutes)))
+	}
+	if len(verdict.UncertainRoutes) > 0 {
+		uncertain = append(uncertain, fmt.Sprintf("%d routes break the rules without enough confidence", len(verdict.UncertainRoutes)))
+	}
+
+	switch {
+	case len(verdict.Reasons) > 0:
+		verdict.Result = Fail
+	case len(uncertain) > 0:
+		// Not rejected nor promoted because of noise
+		verdict.Result = Inconclusive
+		verdict.Reasons = uncertain
+	default:
+		verdict.Result = Pass
+	}
+
+	return verdict
+}
+
+// sortRoutes by path and method
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+}
+
+// rate as percentage rounded to two decimals
+func rate(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return round(float64(part) * 100 / float64(total))
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
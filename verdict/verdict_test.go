@@ -0,0 +1,211 @@
+package verdict_test
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lordofthejars/diferencia/exporter"
+	"github.com/lordofthejars/diferencia/verdict"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func entry(path string, success, errors int, primary, candidate float32) exporter.Entry {
+	return exporter.Entry{
+		Endpoint:                 exporter.URLCall{Method: http.MethodGet, Path: path},
+		Success:                  success,
+		Errors:                   errors,
+		AveragePrimaryDuration:   primary,
+		AverageCandidateDuration: candidate,
+	}
+}
+
+// observed returns the entry of samples comparisons of path, where candidate fails every failEvery requests
+func observed(path string, samples int, primary, candidate time.Duration, failEvery int) exporter.Entry {
+	stats := exporter.NewURLCounterMap()
+	for i := 0; i < samples; i++ {
+		status := http.StatusOK
+		if failEvery > 0 && i%failEvery == 0 {
+			status = http.StatusInternalServerError
+		}
+		// A bit of jitter so durations are not all ties
+		jitter := time.Duration(i%5) * time.Millisecond
+		stats.IncSuccess(http.MethodGet, path, exporter.Observation{PrimaryElapsedTime: primary + jitter, CandidateElapsedTime: candidate + jitter, PrimaryStatus: http.StatusOK, CandidateStatus: status})
+	}
+	return stats.FindEntry(http.MethodGet, path)
+}
+
+var _ = Describe("Verdict", func() {
+
+	Describe("Evaluate rules", func() {
+		Context("Without regressions", func() {
+			It("should pass", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{entry("/users", 10, 0, 10, 12)}, verdict.Rules{MinSamples: 10})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Pass))
+				Expect(result.Reasons).Should(BeEmpty())
+				Expect(result.Samples).Should(Equal(10))
+				Expect(result.LatencyRatio).Should(Equal(1.2))
+			})
+		})
+
+		Context("With not enough samples", func() {
+			It("should be inconclusive", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{entry("/users", 5, 5, 10, 10)}, verdict.Rules{MinSamples: 100})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Inconclusive))
+				Expect(result.Reasons).Should(ConsistOf("10 comparisons done but at least 100 are required"))
+			})
+
+			It("should be inconclusive without comparisons", func() {
+
+				// When
+				result := verdict.Evaluate(nil, verdict.Rules{})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Inconclusive))
+			})
+		})
+
+		Context("With regressions", func() {
+			It("should fail with overall rate", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{entry("/users", 98, 2, 10, 10), entry("/orders", 100, 0, 10, 10)}, verdict.Rules{MaxRegressionRate: 0.5})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Fail))
+				Expect(result.RegressionRate).Should(Equal(1.0))
+				Expect(result.Reasons).Should(ConsistOf("Regression rate 1.00% is greater than 0.50%"))
+				Expect(result.FailingRoutes).Should(BeEmpty())
+			})
+
+			It("should fail with the routes breaking route rate", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{entry("/users", 90, 10, 10, 10), entry("/orders", 900, 0, 10, 10), entry("/items", 1, 1, 10, 10)},
+					verdict.Rules{MaxRegressionRate: 5, MaxRouteRegressionRate: 5, MinSamples: 10})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Fail))
+				Expect(result.RegressionRate).Should(BeNumerically("<", 5))
+				Expect(result.FailingRoutes).Should(HaveLen(1))
+				Expect(result.FailingRoutes[0].Path).Should(Equal("/users"))
+				Expect(result.FailingRoutes[0].RegressionRate).Should(Equal(10.0))
+				Expect(result.FailingRoutes[0].Reasons).Should(ConsistOf("Regression rate 10.00% is greater than 5.00%"))
+			})
+		})
+
+		Context("With slower candidate", func() {
+			It("should fail with latency ratio", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{entry("/users", 100, 0, 10, 30), entry("/orders", 100, 0, 10, 10)}, verdict.Rules{MaxLatencyRatio: 1.5})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Fail))
+				Expect(result.LatencyRatio).Should(Equal(2.0))
+				Expect(result.FailingRoutes).Should(HaveLen(1))
+				Expect(result.FailingRoutes[0].LatencyRatio).Should(Equal(3.0))
+			})
+
+			It("should report slow comparisons beside regressions", func() {
+
+				// Given
+				slow := entry("/users", 100, 0, 10, 30)
+				slow.Slow = 25
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{slow, entry("/orders", 100, 0, 10, 10)}, verdict.Rules{MaxRouteRegressionRate: 1, MaxLatencyRatio: 1.5})
+
+				// Then
+				Expect(result.Slow).Should(Equal(25))
+				Expect(result.SlowRate).Should(Equal(12.5))
+				Expect(result.FailingRoutes[0].SlowRate).Should(Equal(25.0))
+			})
+
+			It("should include latency of regressions", func() {
+
+				// Given
+				stats := exporter.NewURLCounterMap()
+				stats.IncSuccess(http.MethodGet, "/users", exporter.Observation{PrimaryElapsedTime: 10 * time.Millisecond, CandidateElapsedTime: 10 * time.Millisecond})
+				stats.IncErr(http.MethodGet, "/orders", exporter.Observation{PrimaryElapsedTime: 10 * time.Millisecond, CandidateElapsedTime: 50 * time.Millisecond}, exporter.ErrorData{})
+
+				// When
+				result := verdict.Evaluate(stats.Entries(), verdict.Rules{MaxLatencyRatio: 1.5})
+
+				// Then
+				Expect(result.LatencyRatio).Should(Equal(3.0))
+				Expect(result.FailingRoutes).Should(HaveLen(1))
+				Expect(result.FailingRoutes[0].Path).Should(Equal("/orders"))
+			})
+		})
+	})
+
+	Describe("Evaluate rules with confidence", func() {
+		Context("With slower candidate", func() {
+			It("should fail when latency difference is significant", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{observed("/users", 100, 10*time.Millisecond, 30*time.Millisecond, 0)}, verdict.Rules{MaxLatencyRatio: 1.5, MinConfidence: 95})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Fail))
+				Expect(result.LatencyTest.Confidence).Should(BeNumerically(">=", 95))
+				Expect(result.LatencyTest.EffectSize).Should(Equal(1.0))
+				Expect(result.FailingRoutes).Should(HaveLen(1))
+			})
+
+			It("should be inconclusive when there are not enough samples to be confident", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{observed("/users", 2, 10*time.Millisecond, 16*time.Millisecond, 0)}, verdict.Rules{MaxLatencyRatio: 1.5, MinConfidence: 95})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Inconclusive))
+				Expect(result.FailingRoutes).Should(BeEmpty())
+				Expect(result.UncertainRoutes).Should(HaveLen(1))
+				Expect(result.Reasons[0]).Should(ContainSubstring("confidence"))
+			})
+		})
+
+		Context("With candidate returning more non-2xx responses", func() {
+			It("should fail when difference is significant", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{observed("/users", 200, 10*time.Millisecond, 10*time.Millisecond, 4)}, verdict.Rules{MaxRegressionRate: 100, MinConfidence: 99})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Fail))
+				Expect(result.StatusTest.EffectSize).Should(Equal(25.0))
+				Expect(result.FailingRoutes[0].Reasons[0]).Should(ContainSubstring("Non-2xx rate"))
+			})
+
+			It("should pass when tests are not applied", func() {
+
+				// When
+				result := verdict.Evaluate([]exporter.Entry{observed("/users", 200, 10*time.Millisecond, 10*time.Millisecond, 4)}, verdict.Rules{MaxRegressionRate: 100})
+
+				// Then
+				Expect(result.Result).Should(Equal(verdict.Pass))
+			})
+		})
+	})
+
+	Describe("Validate rules", func() {
+		Context("With rates out of range", func() {
+			It("should fail", func() {
+				Expect(verdict.Rules{MaxRegressionRate: 101}.Validate()).ShouldNot(Succeed())
+				Expect(verdict.Rules{MinSamples: -1}.Validate()).ShouldNot(Succeed())
+				Expect(verdict.Rules{MinConfidence: 101}.Validate()).ShouldNot(Succeed())
+				Expect(verdict.Rules{MaxRegressionRate: 1, MaxLatencyRatio: 1.5}.Validate()).Should(Succeed())
+			})
+		})
+	})
+})